@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MYOB-Technology/dataform/pkg/db"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/spf13/cobra"
+)
+
+var (
+	clonePITR          bool
+	cloneInstanceClass string
+	cloneTTL           time.Duration
+)
+
+// cloneCmd represents the clone command
+var cloneCmd = &cobra.Command{
+	Use:   "clone [source rds name] [target rds name]",
+	Short: "Clone an RDS instance into a new development instance",
+	Args:  cobra.ExactArgs(2),
+	Run:   cloneFunc,
+}
+
+func init() {
+	cloneCmd.Flags().BoolVarP(&clonePITR, "pitr", "", false, "restore the latest restorable time instead of taking a snapshot")
+	cloneCmd.Flags().StringVarP(&cloneInstanceClass, "class", "c", "", "db instance class/size, defaults to the source class")
+	cloneCmd.Flags().DurationVarP(&cloneTTL, "ttl", "t", 72*time.Hour, "time until the clone is tagged as expired")
+	RootCmd.AddCommand(cloneCmd)
+}
+
+func cloneFunc(cmd *cobra.Command, args []string) {
+	session := getAwsSession()
+	manager := db.NewManager(rds.New(session))
+	source, target := args[0], args[1]
+	go manager.SigHandler()
+
+	opts := db.CloneOptions{TTL: cloneTTL}
+	if cloneInstanceClass != "" {
+		opts.DBInstanceClass = &cloneInstanceClass
+	}
+
+	if !clonePITR {
+		snapshot, err := manager.CreateCloneSnapshot(source, target)
+		if err != nil {
+			fmt.Printf("failed to snapshot instance %s: %v\n", source, getAwsError(err))
+			return
+		}
+		fmt.Printf("creating snapshot %s\n", *snapshot.Name)
+		defer deleteCloneSnapshot(manager, *snapshot.Name)
+		for poll := range manager.WaitForSnapshot(*snapshot.Name, 20, 3600) {
+			if poll.Err != nil {
+				fmt.Printf("snapshot transitioned to error condition: %v\n", poll.Err)
+				return
+			}
+			fmt.Printf("%s snapshot %s\n", poll.Status, *snapshot.Name)
+		}
+		opts.Snapshot = *snapshot.Name
+	}
+
+	fmt.Printf("cloning instance %s to %s\n", source, target)
+	instance, err := manager.Clone(source, target, opts)
+	if err != nil {
+		fmt.Printf("failed to clone instance: %v\n", getAwsError(err))
+		return
+	}
+	if !waitForAvailable(manager, *instance.Name) {
+		return
+	}
+
+	if _, err := manager.ApplyProfile(*instance.Name, db.Development); err != nil {
+		fmt.Printf("failed to apply development profile: %v\n", getAwsError(err))
+		return
+	}
+	// the instance stays available until the modification starts
+	for poll := range manager.WaitForModifying(*instance.Name, 10, 300) {
+		if poll.Err != nil && poll.Status != "timeout" {
+			fmt.Printf("instance transitioned to error condition: %v\n", poll.Err)
+			return
+		}
+	}
+	if !waitForAvailable(manager, *instance.Name) {
+		return
+	}
+
+	clone, err := manager.Stat(*instance.Name)
+	if err != nil {
+		fmt.Printf("%s: %s\n", *instance.Name, getAwsError(err))
+		return
+	}
+	fmt.Printf("cloned %s %s:%d\n", *clone.Name, *clone.Address, *clone.Port)
+}
+
+// deleteCloneSnapshot deletes the snapshot a clone was restored from
+func deleteCloneSnapshot(manager *db.Manager, name string) {
+	if _, err := manager.DeleteSnapshot(name); err != nil {
+		fmt.Printf("failed to delete snapshot %s: %v\n", name, getAwsError(err))
+		return
+	}
+	fmt.Printf("deleted snapshot %s\n", name)
+}
+
+// waitForAvailable prints the status of an instance until it is final and reports whether it is available
+func waitForAvailable(manager *db.Manager, name string) bool {
+	status := ""
+	for poll := range manager.WaitForFinalState(name, 20, 3600) {
+		if poll.Err != nil {
+			fmt.Printf("instance transitioned to error condition: %v\n", poll.Err)
+			return false
+		}
+		status = poll.Status
+		fmt.Printf("%s instance %s\n", poll.Status, name)
+	}
+	return status == db.StatusAvailable
+}
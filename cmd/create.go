@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/MYOB-Technology/dataform/pkg/db"
+	"github.com/MYOB-Technology/dataform/pkg/secrets"
 	"github.com/aws/aws-sdk-go/service/rds"
 	"github.com/spf13/cobra"
 )
@@ -11,6 +12,10 @@ import (
 var (
 	dbMasterUsername      string
 	dbMasterPassword      string
+	dbPasswordStdin       bool
+	dbPasswordFile        string
+	dbPasswordOut         string
+	dbSecretsSink         string
 	dbInstanceClass       string
 	dbEngine              string
 	dbEngineVersion       string
@@ -39,7 +44,11 @@ var createCmd = &cobra.Command{
 
 func init() {
 	createCmd.Flags().StringVarP(&dbMasterUsername, "username", "u", "admin", "db master username")
-	createCmd.Flags().StringVarP(&dbMasterPassword, "password", "p", "", "db master password")
+	createCmd.Flags().StringVarP(&dbMasterPassword, "password", "p", "", "db master password, generated when not supplied")
+	createCmd.Flags().BoolVarP(&dbPasswordStdin, "password-stdin", "", false, "read the db master password from stdin")
+	createCmd.Flags().StringVarP(&dbPasswordFile, "password-file", "", "", "read the db master password from a file")
+	createCmd.Flags().StringVarP(&dbPasswordOut, "password-out", "", "", "write the db master password to a file, - for stdout")
+	createCmd.Flags().StringVarP(&dbSecretsSink, "secrets-sink", "", "", secretsSinkUsage)
 	createCmd.Flags().StringVarP(&dbEngine, "engine", "e", "postgres", "db engine")
 	createCmd.Flags().StringVarP(&dbEngineVersion, "version", "v", "9.6.3", "db engine version")
 	createCmd.Flags().StringVarP(&dbInstanceClass, "class", "c", "db.t2.small", "db instance class/size")
@@ -63,9 +72,36 @@ func createFunc(cmd *cobra.Command, args []string) {
 	manager := db.NewManager(rds.New(session))
 	name := args[0]
 
+	password, generated, err := masterPassword(manager, dbEngine, dbMasterPassword, dbPasswordStdin, dbPasswordFile)
+	if err != nil {
+		fmt.Printf("failed to create instance: %v\n", err)
+		return
+	}
+	sink, closeSink, err := getSecretSink(dbSecretsSink)
+	if err != nil {
+		fmt.Printf("failed to create instance: %v\n", err)
+		return
+	}
+	defer closeSink()
+	if sink != nil && !createWait {
+		fmt.Println("--secrets-sink needs --wait, the instance has no address until it is available")
+		return
+	}
+	if generated && dbPasswordOut == "" && sink == nil {
+		fmt.Println("refusing to set a generated master password without --password-out or --secrets-sink")
+		return
+	}
+	var writePassword func(string) error
+	if dbPasswordOut != "" {
+		if writePassword, err = openSecret(dbPasswordOut); err != nil {
+			fmt.Printf("failed to open password output: %v\n", err)
+			return
+		}
+	}
+
 	dbinput := &db.DB{}
 	dbinput.MasterUsername = &dbMasterUsername
-	dbinput.MasterUserPassword = &dbMasterPassword
+	dbinput.MasterUserPassword = &password
 	dbinput.Engine = &dbEngine
 	dbinput.EngineVersion = &dbEngineVersion
 	dbinput.DBInstanceClass = &dbInstanceClass
@@ -100,16 +136,42 @@ func createFunc(cmd *cobra.Command, args []string) {
 		fmt.Printf("failed to create instance: %v", getAwsError(err))
 		return
 	}
+	if writePassword != nil {
+		if err := writePassword(password); err != nil {
+			fmt.Printf("failed to write master password: %v\n", err)
+		}
+	}
+	failed := false
 	if createWait {
 		go manager.SigHandler()
 		status := manager.WaitForFinalState(*instance.Name, 20, 1800)
 		for poll := range status {
 			if poll.Err != nil {
-				fmt.Printf("instance transitioned to error condition: %v", err)
-				return
+				fmt.Printf("instance transitioned to error condition: %v\n", poll.Err)
+				failed = true
+				break
 			}
 			fmt.Printf("%s instance %s\n", poll.Status, *instance.Name)
 		}
 	}
+	// the master password is set even when the instance failed
+	if sink != nil {
+		secret := &secrets.Secret{
+			Name:     name,
+			Engine:   dbEngine,
+			Port:     int(dbPort),
+			Username: dbMasterUsername,
+			Password: password,
+		}
+		if i, err := manager.Stat(name); err == nil && i != nil && i.Address != nil {
+			secret.Host = *i.Address
+		}
+		if err := sink.Write(secret); err != nil {
+			fmt.Printf("failed to store master password: %v\n", err)
+		}
+	}
+	if failed {
+		return
+	}
 	fmt.Printf("created %s %s\n", *instance.Name, *instance.ARN)
 }
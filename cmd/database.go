@@ -0,0 +1,161 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/MYOB-Technology/dataform/pkg/db"
+	"github.com/MYOB-Technology/dataform/pkg/postgres"
+	"github.com/MYOB-Technology/dataform/pkg/secrets"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/spf13/cobra"
+)
+
+const masterPasswordEnv = "DFM_MASTER_PASSWORD"
+
+var (
+	databaseMasterUsername string
+	databaseMasterPassword string
+	databasePasswordStdin  bool
+	databaseSSLMode        string
+	databaseSSLRootCert    string
+	databaseSSLCert        string
+	databaseSSLKey         string
+	databaseConnectTimeout time.Duration
+)
+
+// databaseCmd represents the database command
+var databaseCmd = &cobra.Command{
+	Use:   "database",
+	Short: "Manage logical databases on an RDS PostgreSQL instance",
+}
+
+func init() {
+	databaseCmd.PersistentFlags().StringVarP(&databaseMasterUsername, "username", "u", "", "db master username, defaults to the instance master username")
+	databaseCmd.PersistentFlags().StringVarP(&databaseMasterPassword, "password", "p", "", "db master password, defaults to $"+masterPasswordEnv)
+	databaseCmd.PersistentFlags().BoolVarP(&databasePasswordStdin, "password-stdin", "", false, "read the db master password from stdin")
+	databaseCmd.PersistentFlags().StringVarP(&databaseSSLMode, "sslmode", "", postgres.SSLRequire, "disable, require, verify-ca or verify-full")
+	databaseCmd.PersistentFlags().StringVarP(&databaseSSLRootCert, "sslrootcert", "", "", "CA bundle to verify the server with, defaults to the RDS CA bundle")
+	databaseCmd.PersistentFlags().StringVarP(&databaseSSLCert, "sslcert", "", "", "client certificate file")
+	databaseCmd.PersistentFlags().StringVarP(&databaseSSLKey, "sslkey", "", "", "client certificate key file")
+	databaseCmd.PersistentFlags().DurationVarP(&databaseConnectTimeout, "connect-timeout", "", 10*time.Second, "time to wait for a connection")
+	RootCmd.AddCommand(databaseCmd)
+}
+
+// connectInstance resolves the endpoint of an RDS instance and connects to it as the master user
+func connectInstance(name string) (*postgres.Conn, error) {
+	password := databaseMasterPassword
+	if password == "" && databasePasswordStdin {
+		var err error
+		password, err = readPassword(true, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+	return connectInstanceAs(name, databaseMasterUsername, password)
+}
+
+// connectInstanceAs resolves the endpoint of an RDS instance and connects to it
+// as a user, defaulting to the instance master username and to the password in
+// $DFM_MASTER_PASSWORD
+func connectInstanceAs(name, username, password string) (*postgres.Conn, error) {
+	o, instance, err := instanceOptions(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if username == "" && instance.MasterUsername != nil {
+		username = *instance.MasterUsername
+	}
+	if password == "" {
+		password = os.Getenv(masterPasswordEnv)
+	}
+	if password == "" {
+		return nil, fmt.Errorf("db master password required, use --password, --password-stdin or $%s", masterPasswordEnv)
+	}
+
+	o.User, o.Password = username, password
+	return postgres.Open(o)
+}
+
+// instanceOptions resolves the endpoint of an RDS instance and returns the
+// options to connect to it, without a user, and the instance
+func instanceOptions(name string) (postgres.Options, *db.DB, error) {
+	session := getAwsSession()
+	manager := db.NewManager(rds.New(session))
+
+	instance, err := manager.Stat(name)
+	if err != nil {
+		return postgres.Options{}, nil, fmt.Errorf("%s: %s", name, getAwsError(err))
+	}
+	if instance == nil || instance.Address == nil || instance.Port == nil {
+		return postgres.Options{}, nil, fmt.Errorf("%s: instance has no endpoint", name)
+	}
+
+	return postgres.Options{
+		Host:            *instance.Address,
+		Port:            int(*instance.Port),
+		SSLMode:         databaseSSLMode,
+		SSLRootCert:     databaseSSLRootCert,
+		SSLCert:         databaseSSLCert,
+		SSLKey:          databaseSSLKey,
+		ConnectTimeout:  databaseConnectTimeout,
+		ApplicationName: "dfm",
+	}, instance, nil
+}
+
+// descriptorSecrets returns the credentials of the users in a DatabaseDescriptor
+func descriptorSecrets(dd *postgres.DatabaseDescriptor) []*secrets.Secret {
+	var xs []*secrets.Secret
+	for _, u := range dd.AllUsers() {
+		// users that kept their password have none to store
+		if u.Password == "" {
+			continue
+		}
+		xs = append(xs, &secrets.Secret{
+			Name:     u.Name,
+			Engine:   "postgres",
+			Host:     dd.Host,
+			Port:     dd.Port,
+			Database: dd.Database.Name,
+			Username: u.Name,
+			Password: u.Password,
+		})
+	}
+	return xs
+}
+
+// storeDescriptor writes the credentials of a DatabaseDescriptor to sink, if any,
+// and blanks the stored passwords so they stay off the terminal
+func storeDescriptor(sink secrets.SecretSink, dd *postgres.DatabaseDescriptor) error {
+	if sink == nil {
+		return nil
+	}
+	if err := sink.Write(descriptorSecrets(dd)...); err != nil {
+		return err
+	}
+	for _, u := range dd.AllUsers() {
+		u.Password = ""
+	}
+	return nil
+}
+
+// printJSON prints v as indented JSON
+func printJSON(v interface{}) {
+	b, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		fmt.Printf("failed to encode output: %v\n", err)
+		return
+	}
+	fmt.Println(string(b))
+}
+
+// loadTemplate reads a role template file, or returns the default template when path is empty
+func loadTemplate(path string) (*postgres.Template, error) {
+	if path == "" {
+		return postgres.DefaultTemplate, nil
+	}
+	return postgres.LoadTemplateFile(path)
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/MYOB-Technology/dataform/pkg/postgres"
+	"github.com/spf13/cobra"
+)
+
+// databaseAddUserCmd represents the database adduser command
+var databaseAddUserCmd = &cobra.Command{
+	Use:   "adduser [rds name] [database name] [admin|write|read]",
+	Short: "Add a login user to a group role of a database",
+	Long: `Add a login user to a group role of a database.
+
+Databases have a NOLOGIN group role per level, such as foobaz_write, holding
+the privileges. The new user is a member of the group, named after the database
+and level with a number, as in foobaz-write-2, and gets the connection limit and
+settings of its template role. Levels other than admin, write and read are the
+groups of the --template the database was created from.
+
+With --print-sql the psql script adding the user is printed instead, with its
+password redacted or read from a psql variable with --psql-variables.`,
+	Args: cobra.ExactArgs(3),
+	Run:  databaseAddUserFunc,
+}
+
+func init() {
+	databaseAddUserCmd.Flags().StringVarP(&databaseTemplate, "template", "t", "", "YAML role template the database was created from")
+	databaseAddUserCmd.Flags().StringVarP(&databaseOutput, "output", "o", "text", "output format, text or json")
+	databaseAddUserCmd.Flags().StringVarP(&databaseSecretsSink, "secrets-sink", "", "", secretsSinkUsage)
+	databaseAddUserCmd.Flags().BoolVarP(&databasePrintSQL, "print-sql", "", false, "print the psql script adding the user without running it")
+	databaseAddUserCmd.Flags().BoolVarP(&databasePSQLVars, "psql-variables", "", false, "read the password from a psql variable in the --print-sql script")
+	databaseCmd.AddCommand(databaseAddUserCmd)
+}
+
+func databaseAddUserFunc(cmd *cobra.Command, args []string) {
+	name, dbname, level := args[0], args[1], args[2]
+	if databaseOutput != "text" && databaseOutput != "json" {
+		fmt.Printf("unknown output format %s\n", databaseOutput)
+		return
+	}
+
+	template, err := loadTemplate(databaseTemplate)
+	if err != nil {
+		fmt.Printf("failed to add user: %v\n", err)
+		return
+	}
+
+	if databasePrintSQL {
+		conn, err := connectInstance(name)
+		if err != nil {
+			fmt.Printf("failed to connect: %v\n", err)
+			return
+		}
+		defer conn.Close()
+
+		p, _, err := conn.PlanAddUser(dbname, template, level)
+		if err != nil {
+			fmt.Printf("failed to plan adding %s user to database %s: %v\n", level, dbname, err)
+			return
+		}
+		if err := postgres.RenderPlan(os.Stdout, p, scriptPasswords()); err != nil {
+			fmt.Printf("failed to print plan: %v\n", err)
+		}
+		return
+	}
+
+	sink, closeSink, err := getSecretSink(databaseSecretsSink)
+	if err != nil {
+		fmt.Printf("failed to add user: %v\n", err)
+		return
+	}
+	defer closeSink()
+
+	conn, err := connectInstance(name)
+	if err != nil {
+		fmt.Printf("failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	u, err := conn.AddUser(dbname, template, level)
+	if err != nil {
+		fmt.Printf("failed to add %s user to database %s: %v\n", level, dbname, err)
+		return
+	}
+
+	dd := &postgres.DatabaseDescriptor{
+		Host:     conn.Host,
+		Port:     conn.Port,
+		Database: &postgres.Database{Name: dbname},
+		Users:    []*postgres.User{u},
+	}
+	if err := storeDescriptor(sink, dd); err != nil {
+		fmt.Printf("failed to store database credentials: %v\n", err)
+	}
+
+	printDescriptor(dd)
+}
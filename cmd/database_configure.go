@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	databaseConfigureUser     string
+	databaseConfigureLimit    int
+	databaseConfigureSettings []string
+	databaseConfigureReset    []string
+)
+
+// databaseConfigureCmd represents the database configure command
+var databaseConfigureCmd = &cobra.Command{
+	Use:   "configure [rds name] [database name]",
+	Short: "Set connection limits and settings of a database or its users",
+	Long: `Set connection limits and settings of a database or its users.
+
+Without --user, --connection-limit limits the connections to the database.
+With --user, it limits the connections of that user, and --set and --reset
+change its settings, such as statement_timeout or
+idle_in_transaction_session_timeout, for the sessions it opens afterwards. The
+user must belong to one of the database's group roles.`,
+	Args: cobra.ExactArgs(2),
+	Run:  databaseConfigureFunc,
+}
+
+func init() {
+	databaseConfigureCmd.Flags().StringVarP(&databaseConfigureUser, "user", "", "", "user to configure, such as foobaz-writer")
+	databaseConfigureCmd.Flags().IntVarP(&databaseConfigureLimit, "connection-limit", "", -1, "connection limit, -1 for unlimited")
+	databaseConfigureCmd.Flags().StringArrayVarP(&databaseConfigureSettings, "set", "", nil, "setting of the user, such as statement_timeout=30s, repeated for each setting")
+	databaseConfigureCmd.Flags().StringArrayVarP(&databaseConfigureReset, "reset", "", nil, "setting of the user to reset to the server default, repeated for each setting")
+	databaseConfigureCmd.Flags().StringVarP(&databaseTemplate, "template", "t", "", "YAML role template the database was created from")
+	databaseCmd.AddCommand(databaseConfigureCmd)
+}
+
+func databaseConfigureFunc(cmd *cobra.Command, args []string) {
+	name, dbname := args[0], args[1]
+	limit := cmd.Flags().Changed("connection-limit")
+	settings := map[string]string{}
+	for _, kv := range databaseConfigureSettings {
+		i := strings.Index(kv, "=")
+		if i < 0 {
+			fmt.Printf("setting %s must be name=value\n", kv)
+			return
+		}
+		if i == len(kv)-1 {
+			fmt.Printf("setting %s needs a value, use --reset to remove it\n", kv[:i])
+			return
+		}
+		settings[kv[:i]] = kv[i+1:]
+	}
+	for _, k := range databaseConfigureReset {
+		settings[k] = ""
+	}
+	if databaseConfigureUser == "" && len(settings) > 0 {
+		fmt.Printf("--set and --reset need --user\n")
+		return
+	}
+	if !limit && len(settings) == 0 {
+		fmt.Printf("nothing to configure, use --connection-limit, --set or --reset\n")
+		return
+	}
+
+	template, err := loadTemplate(databaseTemplate)
+	if err != nil {
+		fmt.Printf("failed to configure database: %v\n", err)
+		return
+	}
+
+	conn, err := connectInstance(name)
+	if err != nil {
+		fmt.Printf("failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	if databaseConfigureUser == "" {
+		if err := conn.SetDatabaseConnectionLimit(dbname, databaseConfigureLimit); err != nil {
+			fmt.Printf("failed to configure database %s: %v\n", dbname, err)
+		}
+		return
+	}
+
+	if err := conn.CheckDatabaseUser(dbname, template, databaseConfigureUser); err != nil {
+		fmt.Printf("failed to configure user %s: %v\n", databaseConfigureUser, err)
+		return
+	}
+
+	if limit {
+		if err := conn.SetConnectionLimit(databaseConfigureUser, databaseConfigureLimit); err != nil {
+			fmt.Printf("failed to configure user %s: %v\n", databaseConfigureUser, err)
+			return
+		}
+	}
+	if len(settings) > 0 {
+		if err := conn.SetRoleSettings(databaseConfigureUser, settings); err != nil {
+			fmt.Printf("failed to configure user %s: %v\n", databaseConfigureUser, err)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/MYOB-Technology/dataform/pkg/postgres"
+	"github.com/spf13/cobra"
+)
+
+var (
+	databaseCopySchemas        []string
+	databaseCopyOwner          string
+	databaseCopyParallel       int
+	databaseCopyTargetUsername string
+	databaseCopyTargetPassword string
+	databaseCopyMask           string
+)
+
+// databaseCopyCmd represents the database copy command
+var databaseCopyCmd = &cobra.Command{
+	Use:   "copy [source rds name] [source database] [target rds name] [target database]",
+	Short: "Copy a database to another database, on the same or another instance",
+	Long: `Copy a database to another database, on the same or another instance.
+
+The schemas, extensions, enum types, sequences, functions, tables, constraints,
+indexes, views and triggers of the source are recreated in the target, which
+should be empty, such as a database made with database create. The rows are
+streamed with COPY from a single snapshot of the source, several tables at a
+time, and the row counts of both sides are checked.
+
+--owner sets the role owning the copied objects, such as foobaz_admin for a
+database made with database create. The target is reached as
+--target-username, defaulting to the target master username, with
+--target-password, defaulting to --password or $` + masterPasswordEnv + `.
+
+--mask masks the target with a rules file once the copy is done, as database
+mask does, and refuses targets tagged environment=production. If the copy or
+the masking fails, the copied tables are truncated and the command exits with
+status 1.`,
+	Args: cobra.ExactArgs(4),
+	Run:  databaseCopyFunc,
+}
+
+func init() {
+	databaseCopyCmd.Flags().StringSliceVarP(&databaseCopySchemas, "schema", "s", nil, "schemas to copy, defaults to all")
+	databaseCopyCmd.Flags().StringVarP(&databaseCopyOwner, "owner", "", "", "role owning the copied objects, defaults to the target user")
+	databaseCopyCmd.Flags().IntVarP(&databaseCopyParallel, "parallel", "j", 4, "number of tables to copy at once")
+	databaseCopyCmd.Flags().StringVarP(&databaseCopyTargetUsername, "target-username", "", "", "db master username of the target instance")
+	databaseCopyCmd.Flags().StringVarP(&databaseCopyTargetPassword, "target-password", "", "", "db master password of the target instance")
+	databaseCopyCmd.Flags().StringVarP(&databaseCopyMask, "mask", "", "", "YAML masking rules to apply to the target")
+	databaseCopyCmd.Flags().StringVarP(&databaseMaskSalt, "salt", "", "", "salt of the masking hashes, defaults to $"+maskSaltEnv+" or the rules salt")
+	databaseCopyCmd.Flags().StringVarP(&databaseOutput, "output", "o", "text", "output format, text or json")
+	databaseCmd.AddCommand(databaseCopyCmd)
+}
+
+func databaseCopyFunc(cmd *cobra.Command, args []string) {
+	source, srcdb, target, dstdb := args[0], args[1], args[2], args[3]
+	if databaseOutput != "text" && databaseOutput != "json" {
+		fmt.Printf("unknown output format %s\n", databaseOutput)
+		return
+	}
+
+	var rules *postgres.MaskRules
+	if databaseCopyMask != "" {
+		var err error
+		if rules, err = loadMaskRules(databaseCopyMask); err != nil {
+			fmt.Printf("failed to copy database: %v\n", err)
+			return
+		}
+		production, err := isProductionInstance(target)
+		if err != nil {
+			fmt.Printf("failed to copy database: %v\n", err)
+			return
+		}
+		if production {
+			fmt.Printf("refusing to mask database %s: %s is tagged as production\n", dstdb, target)
+			return
+		}
+	}
+
+	src, err := connectInstance(source)
+	if err != nil {
+		fmt.Printf("failed to connect: %v\n", err)
+		return
+	}
+	defer src.Close()
+
+	password := databaseCopyTargetPassword
+	if password == "" {
+		password = databaseMasterPassword
+	}
+	dst, err := connectInstanceAs(target, databaseCopyTargetUsername, password)
+	if err != nil {
+		fmt.Printf("failed to connect: %v\n", err)
+		return
+	}
+	defer dst.Close()
+
+	o := postgres.CopyOptions{
+		Schemas:  databaseCopySchemas,
+		Owner:    databaseCopyOwner,
+		Parallel: databaseCopyParallel,
+		Mask:     rules,
+	}
+	if databaseOutput == "text" {
+		o.Progress = func(p *postgres.TableCopy) {
+			if p.Done {
+				fmt.Printf("copied\t%s\t%d rows\n", p.Table, p.Rows)
+			} else {
+				fmt.Printf("copying\t%s\t%d rows\n", p.Table, p.Rows)
+			}
+		}
+		o.MaskOptions.Progress = printMaskProgress
+	}
+	var masked []*postgres.MaskedTable
+	if databaseOutput == "json" {
+		o.MaskOptions.Progress = func(t *postgres.MaskedTable) {
+			if t.Done {
+				masked = append(masked, t)
+			}
+		}
+	}
+
+	copied, err := src.CopyDatabase(srcdb, dst, dstdb, o)
+	if databaseOutput == "json" {
+		printJSON(copied)
+		if rules != nil && err == nil {
+			printJSON(masked)
+		}
+	}
+	if err != nil {
+		fmt.Printf("failed to copy database %s to %s: %v\n", srcdb, dstdb, err)
+		if rules != nil {
+			// the target was emptied of the unmasked rows, fail scripts expecting masked data
+			os.Exit(1)
+		}
+		return
+	}
+	if databaseOutput == "text" {
+		fmt.Printf("copied database %s to %s on %s\n", srcdb, dstdb, target)
+	}
+}
@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/MYOB-Technology/dataform/pkg/postgres"
+	"github.com/spf13/cobra"
+)
+
+var (
+	databaseOutput      string
+	databaseSecretsSink string
+	databaseTemplate    string
+	databaseSchemas     []string
+	databasePlan        bool
+	databasePrintSQL    bool
+	databasePSQLVars    bool
+	databaseRotate      bool
+)
+
+// databaseCreateCmd represents the database create command
+var databaseCreateCmd = &cobra.Command{
+	Use:   "create [rds name] [database name]",
+	Short: "Create a database with admin, writer and reader users",
+	Long: `Create a database with admin, writer and reader users.
+
+With --print-sql the psql script creating the database on a server without it
+or its users is printed without connecting, for review. It runs as the master
+user given with --username, or admin, with passwords redacted or read from psql
+variables such as foobaz_admin_password with --psql-variables:
+
+  psql -v foobaz_admin_password=... -f create.sql
+
+Rerunning it on an existing database applies the grants again. Users that
+already exist keep their passwords and are shown without one, unless
+--rotate-passwords is given.`,
+	Args: cobra.ExactArgs(2),
+	Run:  databaseCreateFunc,
+}
+
+func init() {
+	databaseCreateCmd.Flags().StringVarP(&databaseOutput, "output", "o", "text", "output format, text or json")
+	databaseCreateCmd.Flags().StringVarP(&databaseSecretsSink, "secrets-sink", "", "", secretsSinkUsage)
+	databaseCreateCmd.Flags().StringVarP(&databaseTemplate, "template", "t", "", "YAML role template, defaults to admin, writer and reader")
+	databaseCreateCmd.Flags().StringSliceVarP(&databaseSchemas, "schema", "s", nil, "schemas to create and grant on, replacing those of the template")
+	databaseCreateCmd.Flags().BoolVarP(&databasePlan, "plan", "", false, "print the SQL to run and to undo it without running it")
+	databaseCreateCmd.Flags().BoolVarP(&databasePrintSQL, "print-sql", "", false, "print the psql script creating the database without connecting")
+	databaseCreateCmd.Flags().BoolVarP(&databasePSQLVars, "psql-variables", "", false, "read passwords from psql variables in the --print-sql script")
+	databaseCreateCmd.Flags().BoolVarP(&databaseRotate, "rotate-passwords", "", false, "set new passwords on users that already exist, which otherwise keep theirs")
+	databaseCmd.AddCommand(databaseCreateCmd)
+}
+
+func databaseCreateFunc(cmd *cobra.Command, args []string) {
+	name, dbname := args[0], args[1]
+	if databaseOutput != "text" && databaseOutput != "json" {
+		fmt.Printf("unknown output format %s\n", databaseOutput)
+		return
+	}
+
+	template, err := loadTemplate(databaseTemplate)
+	if err != nil {
+		fmt.Printf("failed to create database: %v\n", err)
+		return
+	}
+
+	template = template.WithSchemas(databaseSchemas...)
+
+	if databasePrintSQL {
+		printCreateSQL(dbname, template)
+		return
+	}
+
+	if databasePlan {
+		conn, err := connectInstance(name)
+		if err != nil {
+			fmt.Printf("failed to connect: %v\n", err)
+			return
+		}
+		defer conn.Close()
+
+		p, err := conn.PlanCreateDatabase(dbname, template, databaseRotate)
+		if err != nil {
+			fmt.Printf("failed to plan database %s: %v\n", dbname, err)
+			return
+		}
+		printPlan(p)
+		return
+	}
+
+	sink, closeSink, err := getSecretSink(databaseSecretsSink)
+	if err != nil {
+		fmt.Printf("failed to create database: %v\n", err)
+		return
+	}
+	defer closeSink()
+
+	conn, err := connectInstance(name)
+	if err != nil {
+		fmt.Printf("failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	dd, err := conn.CreateDatabaseFromTemplate(dbname, template, databaseRotate)
+	if err != nil {
+		fmt.Printf("failed to create database %s: %v\n", dbname, err)
+		return
+	}
+
+	if err := storeDescriptor(sink, dd); err != nil {
+		fmt.Printf("failed to store database credentials: %v\n", err)
+		return
+	}
+
+	printDescriptor(dd)
+}
+
+// printDescriptor prints a DatabaseDescriptor in the selected output format
+func printDescriptor(dd *postgres.DatabaseDescriptor) {
+	if databaseOutput == "json" {
+		printJSON(dd)
+		return
+	}
+
+	fmt.Printf("host\t%s\n", dd.Host)
+	fmt.Printf("port\t%d\n", dd.Port)
+	fmt.Printf("database\t%s\n", dd.Database.Name)
+	for _, u := range []struct {
+		role string
+		user *postgres.User
+	}{{"admin", dd.Admin}, {"writer", dd.Writer}, {"reader", dd.Reader}} {
+		if u.user != nil {
+			fmt.Printf("%s\t%s\t%s\n", u.role, u.user.Name, u.user.Password)
+		}
+	}
+	for _, u := range dd.Users {
+		fmt.Printf("user\t%s\t%s\n", u.Name, u.Password)
+	}
+}
+
+// printCreateSQL prints the psql script creating a database from a template
+func printCreateSQL(dbname string, template *postgres.Template) {
+	dd, err := postgres.NewDatabaseDescriptor(dbname, template)
+	if err != nil {
+		fmt.Printf("failed to render database %s: %v\n", dbname, err)
+		return
+	}
+
+	master := databaseMasterUsername
+	if master == "" {
+		master = "admin"
+	}
+	if err := postgres.RenderCreateDatabase(os.Stdout, dd, template, master, scriptPasswords()); err != nil {
+		fmt.Printf("failed to render database %s: %v\n", dbname, err)
+	}
+}
+
+// scriptPasswords returns how --print-sql scripts show passwords
+func scriptPasswords() postgres.Passwords {
+	if databasePSQLVars {
+		return postgres.PasswordVariables
+	}
+	return postgres.RedactPasswords
+}
+
+// printPlan prints the SQL of a plan followed by that of its reverse
+func printPlan(p *postgres.Plan) {
+	if err := p.Write(os.Stdout); err != nil {
+		fmt.Printf("failed to print plan: %v\n", err)
+		return
+	}
+	if r := p.Reverse(); len(r.Steps) > 0 {
+		fmt.Println("-- reverse")
+		if err := r.Write(os.Stdout); err != nil {
+			fmt.Printf("failed to print plan: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	databaseDropYes bool
+)
+
+// databaseDropCmd represents the database drop command
+var databaseDropCmd = &cobra.Command{
+	Use:   "drop [rds name] [database name]",
+	Short: "Drop a database and its admin, writer and reader users",
+	Long: `Drop a database and its admin, writer and reader users.
+
+With --print-sql the psql script dropping the database and the users found on
+the server is printed instead, to run as the master user.`,
+	Args: cobra.ExactArgs(2),
+	Run:  databaseDropFunc,
+}
+
+func init() {
+	databaseDropCmd.Flags().BoolVarP(&databaseDropYes, "yes", "y", false, "drop without asking for confirmation")
+	databaseDropCmd.Flags().StringVarP(&databaseTemplate, "template", "t", "", "YAML role template the database was created from")
+	databaseDropCmd.Flags().BoolVarP(&databasePlan, "plan", "", false, "print the SQL to run without running it")
+	databaseDropCmd.Flags().BoolVarP(&databasePrintSQL, "print-sql", "", false, "print the psql script dropping the database without running it")
+	databaseCmd.AddCommand(databaseDropCmd)
+}
+
+func databaseDropFunc(cmd *cobra.Command, args []string) {
+	name, dbname := args[0], args[1]
+
+	template, err := loadTemplate(databaseTemplate)
+	if err != nil {
+		fmt.Printf("failed to drop database: %v\n", err)
+		return
+	}
+
+	if databasePlan || databasePrintSQL {
+		conn, err := connectInstance(name)
+		if err != nil {
+			fmt.Printf("failed to connect: %v\n", err)
+			return
+		}
+		defer conn.Close()
+
+		p, err := conn.PlanDropDatabase(dbname, template)
+		if err != nil {
+			fmt.Printf("failed to plan dropping database %s: %v\n", dbname, err)
+			return
+		}
+		if databasePrintSQL {
+			if err := p.WriteScript(os.Stdout); err != nil {
+				fmt.Printf("failed to print plan: %v\n", err)
+			}
+			return
+		}
+		printPlan(p)
+		return
+	}
+
+	if !databaseDropYes && !confirm(fmt.Sprintf("drop database %s and its users on %s?", dbname, name)) {
+		fmt.Println("aborted")
+		return
+	}
+
+	conn, err := connectInstance(name)
+	if err != nil {
+		fmt.Printf("failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	if err := conn.DropDatabaseFromTemplate(dbname, template); err != nil {
+		fmt.Printf("failed to drop database %s: %v\n", dbname, err)
+		return
+	}
+	fmt.Printf("dropped database %s\n", dbname)
+}
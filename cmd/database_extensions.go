@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/MYOB-Technology/dataform/pkg/postgres"
+	"github.com/spf13/cobra"
+)
+
+var (
+	databaseExtensionsInstall []string
+	databaseExtensionsUpdate  []string
+	databaseExtensionsSchema  string
+)
+
+// databaseExtensionsCmd represents the database extensions command
+var databaseExtensionsCmd = &cobra.Command{
+	Use:   "extensions [rds name] [database name]",
+	Short: "List, install or update the extensions of a database",
+	Long: `List, install or update the extensions of a database.
+
+Without flags the extensions available on the instance are listed with the
+versions installed in the database. --install creates the missing extensions in
+the schema they are qualified with, as in app.pg_trgm, or in --schema. Without
+either Postgres picks the first schema of the search path, and extensions that
+require a schema are created in it. --update updates installed extensions to
+their default versions.`,
+	Args: cobra.ExactArgs(2),
+	Run:  databaseExtensionsFunc,
+}
+
+func init() {
+	databaseExtensionsCmd.Flags().StringSliceVarP(&databaseExtensionsInstall, "install", "i", nil, "extensions to install, such as pgcrypto,uuid-ossp")
+	databaseExtensionsCmd.Flags().StringVarP(&databaseExtensionsSchema, "schema", "s", "", "schema to install unqualified extensions in")
+	databaseExtensionsCmd.Flags().StringSliceVarP(&databaseExtensionsUpdate, "update", "", nil, "installed extensions to update")
+	databaseExtensionsCmd.Flags().StringVarP(&databaseOutput, "output", "o", "text", "output format, text or json")
+	databaseCmd.AddCommand(databaseExtensionsCmd)
+}
+
+func databaseExtensionsFunc(cmd *cobra.Command, args []string) {
+	name, dbname := args[0], args[1]
+	if databaseOutput != "text" && databaseOutput != "json" {
+		fmt.Printf("unknown output format %s\n", databaseOutput)
+		return
+	}
+
+	conn, err := connectInstance(name)
+	if err != nil {
+		fmt.Printf("failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	var exts []*postgres.ExtensionInfo
+	if len(databaseExtensionsInstall) > 0 {
+		installed, err := conn.EnsureExtensions(dbname, databaseExtensionsInstall, databaseExtensionsSchema)
+		if err != nil {
+			fmt.Printf("failed to install extensions in %s: %v\n", dbname, err)
+			return
+		}
+		exts = append(exts, installed...)
+	}
+	if len(databaseExtensionsUpdate) > 0 {
+		updated, err := conn.UpdateExtensions(dbname, databaseExtensionsUpdate)
+		if err != nil {
+			fmt.Printf("failed to update extensions in %s: %v\n", dbname, err)
+			return
+		}
+		exts = append(exts, updated...)
+	}
+	if len(databaseExtensionsInstall) == 0 && len(databaseExtensionsUpdate) == 0 {
+		exts, err = conn.ListExtensions(dbname)
+		if err != nil {
+			fmt.Printf("failed to list extensions in %s: %v\n", dbname, err)
+			return
+		}
+	}
+
+	if databaseOutput == "json" {
+		printJSON(exts)
+		return
+	}
+	for _, e := range exts {
+		installed := e.InstalledVersion
+		if installed == "" {
+			installed = "-"
+		}
+		fmt.Printf("%s\t%s\t%s\t%s\n", e.Name, installed, e.DefaultVersion, e.Schema)
+	}
+}
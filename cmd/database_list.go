@@ -0,0 +1,74 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	databaseListRoles bool
+)
+
+// databaseListCmd represents the database list command
+var databaseListCmd = &cobra.Command{
+	Use:   "list [rds name]",
+	Short: "List the databases or roles on an RDS instance",
+	Args:  cobra.ExactArgs(1),
+	Run:   databaseListFunc,
+}
+
+func init() {
+	databaseListCmd.Flags().BoolVarP(&databaseListRoles, "roles", "r", false, "list roles instead of databases")
+	databaseListCmd.Flags().StringVarP(&databaseOutput, "output", "o", "text", "output format, text or json")
+	databaseCmd.AddCommand(databaseListCmd)
+}
+
+func databaseListFunc(cmd *cobra.Command, args []string) {
+	name := args[0]
+	if databaseOutput != "text" && databaseOutput != "json" {
+		fmt.Printf("unknown output format %s\n", databaseOutput)
+		return
+	}
+
+	conn, err := connectInstance(name)
+	if err != nil {
+		fmt.Printf("failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	if databaseListRoles {
+		roles, err := conn.ListRoles()
+		if err != nil {
+			fmt.Printf("failed to list roles on %s: %v\n", name, err)
+			return
+		}
+		if databaseOutput == "json" {
+			printJSON(roles)
+			return
+		}
+		for _, r := range roles {
+			login := "nologin"
+			if r.Login {
+				login = "login"
+			}
+			fmt.Printf("%s\t%s\t%s\n", r.Name, login, strings.Join(r.MemberOf, ","))
+		}
+		return
+	}
+
+	dbs, err := conn.ListDatabases()
+	if err != nil {
+		fmt.Printf("failed to list databases on %s: %v\n", name, err)
+		return
+	}
+	if databaseOutput == "json" {
+		printJSON(dbs)
+		return
+	}
+	for _, d := range dbs {
+		fmt.Printf("%s\t%s\t%s\t%d\n", d.Name, d.Owner, d.Encoding, d.Size)
+	}
+}
@@ -0,0 +1,153 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/MYOB-Technology/dataform/pkg/db"
+	"github.com/MYOB-Technology/dataform/pkg/postgres"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/spf13/cobra"
+)
+
+const maskSaltEnv = "DFM_MASK_SALT"
+
+var (
+	databaseMaskRules     string
+	databaseMaskSalt      string
+	databaseMaskBatchSize int
+	databaseMaskYes       bool
+)
+
+// databaseMaskCmd represents the database mask command
+var databaseMaskCmd = &cobra.Command{
+	Use:   "mask [rds name] [database name]",
+	Short: "Mask personal data in a database in place",
+	Long: `Mask personal data in a database in place, such as a clone of production.
+
+The rules file lists columns, as table.column or schema.table.column, with a
+strategy: hash, null, fake_email, truncate (with length) or constant (with
+value). hash and fake_email are salted and deterministic, so masked values still
+join. The salt is read from --salt, $` + maskSaltEnv + ` or the rules file:
+
+  salt: ...
+  rules:
+    - column: users.email
+      strategy: fake_email
+    - column: users.notes
+      strategy: truncate
+      length: 20
+
+The database is masked in one transaction, so a failure masks nothing and the
+rules can run again, and nothing is committed until every table is masked.
+--batch-size only sets how many rows each UPDATE masks between progress reports.
+Instances tagged environment=production are refused.`,
+	Args: cobra.ExactArgs(2),
+	Run:  databaseMaskFunc,
+}
+
+func init() {
+	databaseMaskCmd.Flags().StringVarP(&databaseMaskRules, "file", "f", "", "YAML masking rules")
+	databaseMaskCmd.Flags().StringVarP(&databaseMaskSalt, "salt", "", "", "salt of the hashes, defaults to $"+maskSaltEnv+" or the rules salt")
+	databaseMaskCmd.Flags().IntVarP(&databaseMaskBatchSize, "batch-size", "", 10000, "rows each UPDATE masks between progress reports, all in one transaction")
+	databaseMaskCmd.Flags().BoolVarP(&databaseMaskYes, "yes", "y", false, "mask without asking for confirmation")
+	databaseMaskCmd.Flags().StringVarP(&databaseOutput, "output", "o", "text", "output format, text or json")
+	databaseCmd.AddCommand(databaseMaskCmd)
+}
+
+func databaseMaskFunc(cmd *cobra.Command, args []string) {
+	name, dbname := args[0], args[1]
+	if databaseOutput != "text" && databaseOutput != "json" {
+		fmt.Printf("unknown output format %s\n", databaseOutput)
+		return
+	}
+
+	if databaseMaskRules == "" {
+		fmt.Println("masking rules required, use --file")
+		return
+	}
+	rules, err := loadMaskRules(databaseMaskRules)
+	if err != nil {
+		fmt.Printf("failed to mask database: %v\n", err)
+		return
+	}
+
+	production, err := isProductionInstance(name)
+	if err != nil {
+		fmt.Printf("failed to mask database: %v\n", err)
+		return
+	}
+	if production {
+		fmt.Printf("refusing to mask database %s: %s is tagged as production\n", dbname, name)
+		return
+	}
+
+	if !databaseMaskYes && !confirm(fmt.Sprintf("mask database %s on %s in place?", dbname, name)) {
+		fmt.Println("aborted")
+		return
+	}
+
+	conn, err := connectInstance(name)
+	if err != nil {
+		fmt.Printf("failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	o := postgres.MaskOptions{BatchSize: databaseMaskBatchSize}
+	if databaseOutput == "text" {
+		o.Progress = printMaskProgress
+	}
+
+	masked, err := conn.MaskDatabase(dbname, rules, o)
+	if databaseOutput == "json" {
+		printJSON(masked)
+	}
+	if err != nil {
+		fmt.Printf("failed to mask database %s: %v\n", dbname, err)
+	}
+}
+
+// loadMaskRules reads a masking rules file, with the salt of --salt or $DFM_MASK_SALT when set,
+// and checks it has a salt
+func loadMaskRules(path string) (*postgres.MaskRules, error) {
+	rules, err := postgres.LoadMaskRulesFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if databaseMaskSalt != "" {
+		rules.Salt = databaseMaskSalt
+	} else if salt := os.Getenv(maskSaltEnv); salt != "" {
+		rules.Salt = salt
+	}
+	if rules.Salt == "" {
+		return nil, fmt.Errorf("masking rules need a salt, use --salt, $%s or salt in the rules file", maskSaltEnv)
+	}
+	return rules, nil
+}
+
+// printMaskProgress prints the progress of the masking of a table
+func printMaskProgress(t *postgres.MaskedTable) {
+	if t.Done {
+		fmt.Printf("masked\t%s\t%d rows\n", t.Table, t.Rows)
+	} else {
+		fmt.Printf("masking\t%s\t%d rows\n", t.Table, t.Rows)
+	}
+}
+
+// isProductionInstance reports whether an RDS instance is tagged as production
+func isProductionInstance(name string) (bool, error) {
+	manager := db.NewManager(rds.New(getAwsSession()))
+	instance, err := manager.Stat(name)
+	if err != nil {
+		return false, fmt.Errorf("%s: %s", name, getAwsError(err))
+	}
+	if instance == nil {
+		return false, fmt.Errorf("%s: instance not found", name)
+	}
+	tags, err := manager.ListInstanceTags(instance)
+	if err != nil {
+		return false, fmt.Errorf("%s: %s", name, getAwsError(err))
+	}
+	return db.IsProduction(tags), nil
+}
@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/MYOB-Technology/dataform/pkg/postgres"
+	"github.com/spf13/cobra"
+)
+
+const adminPasswordEnv = "DFM_ADMIN_PASSWORD"
+
+var (
+	databaseMigrateDown        int
+	databaseMigrateStatus      bool
+	databaseMigrateSchema      string
+	databaseAdminPassword      string
+	databaseAdminPasswordStdin bool
+)
+
+// databaseMigrateCmd represents the database migrate command
+var databaseMigrateCmd = &cobra.Command{
+	Use:   "migrate [rds name] [database name] [migrations directory]",
+	Short: "Apply versioned SQL migrations to a database",
+	Long: `Apply versioned SQL migrations to a database.
+
+Migrations are VERSION_NAME.up.sql files with optional VERSION_NAME.down.sql
+files, as in 0001_create_users.up.sql. Pending migrations are applied in version
+order, each in a transaction, and recorded with a checksum in the
+dfm_schema_migrations table. An advisory lock keeps concurrent runs out.
+
+They run as the admin user of the database in use, its alternate after a
+rotation with --dual, so the objects they create belong to its admin group. Its
+password is read from --admin-password, --admin-password-stdin or
+$` + adminPasswordEnv + `. The master password is not needed.`,
+	Args: cobra.ExactArgs(3),
+	Run:  databaseMigrateFunc,
+}
+
+func init() {
+	databaseMigrateCmd.Flags().IntVarP(&databaseMigrateDown, "down", "", 0, "undo this many of the latest applied migrations instead")
+	databaseMigrateCmd.Flags().BoolVarP(&databaseMigrateStatus, "status", "", false, "list the migrations and whether they are applied")
+	databaseMigrateCmd.Flags().StringVarP(&databaseMigrateSchema, "migrations-schema", "", "public", "schema of the dfm_schema_migrations table")
+	databaseMigrateCmd.Flags().StringVarP(&databaseAdminPassword, "admin-password", "", "", "password of the admin user, defaults to $"+adminPasswordEnv)
+	databaseMigrateCmd.Flags().BoolVarP(&databaseAdminPasswordStdin, "admin-password-stdin", "", false, "read the password of the admin user from stdin")
+	databaseMigrateCmd.Flags().StringVarP(&databaseTemplate, "template", "t", "", "YAML role template the database was created from")
+	databaseMigrateCmd.Flags().StringVarP(&databaseOutput, "output", "o", "text", "output format, text or json")
+	databaseCmd.AddCommand(databaseMigrateCmd)
+}
+
+func databaseMigrateFunc(cmd *cobra.Command, args []string) {
+	name, dbname, dir := args[0], args[1], args[2]
+	if databaseOutput != "text" && databaseOutput != "json" {
+		fmt.Printf("unknown output format %s\n", databaseOutput)
+		return
+	}
+
+	template, err := loadTemplate(databaseTemplate)
+	if err != nil {
+		fmt.Printf("failed to migrate database: %v\n", err)
+		return
+	}
+	ms, err := postgres.LoadMigrations(dir)
+	if err != nil {
+		fmt.Printf("failed to migrate database: %v\n", err)
+		return
+	}
+
+	password := databaseAdminPassword
+	if password == "" {
+		if password, err = readPassword(databaseAdminPasswordStdin, ""); err != nil {
+			fmt.Printf("failed to migrate database: %v\n", err)
+			return
+		}
+	}
+	if password == "" {
+		password = os.Getenv(adminPasswordEnv)
+	}
+	if password == "" {
+		fmt.Printf("admin password required, use --admin-password, --admin-password-stdin or $%s\n", adminPasswordEnv)
+		return
+	}
+
+	o, _, err := instanceOptions(name)
+	if err != nil {
+		fmt.Printf("failed to connect: %v\n", err)
+		return
+	}
+	o.Database = dbname
+	conn, admin, err := postgres.OpenOwner(o, template, password)
+	if err != nil {
+		fmt.Printf("failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	set := &postgres.MigrationSet{
+		Database:   dbname,
+		As:         admin,
+		Migrations: ms,
+		Schema:     databaseMigrateSchema,
+	}
+
+	if databaseMigrateStatus {
+		applied, err := conn.AppliedMigrations(set)
+		if err != nil {
+			fmt.Printf("failed to list migrations of %s: %v\n", dbname, err)
+			return
+		}
+		printMigrationStatus(ms, applied)
+		return
+	}
+
+	verb := "applied"
+	var done []*postgres.AppliedMigration
+	if databaseMigrateDown > 0 {
+		verb = "reverted"
+		done, err = conn.MigrateDown(set, databaseMigrateDown)
+	} else {
+		done, err = conn.MigrateUp(set)
+	}
+	if databaseOutput == "json" {
+		printJSON(done)
+	} else {
+		for _, a := range done {
+			fmt.Printf("%s\t%d\t%s\n", verb, a.Version, a.Name)
+		}
+	}
+	if err != nil {
+		fmt.Printf("failed to migrate database %s: %v\n", dbname, err)
+		return
+	}
+	if len(done) == 0 && databaseOutput == "text" {
+		fmt.Printf("no migrations %s\n", verb)
+	}
+}
+
+// printMigrationStatus prints the migrations of a directory with the time they
+// were applied, in the selected output format
+func printMigrationStatus(ms []*postgres.Migration, applied []*postgres.AppliedMigration) {
+	if databaseOutput == "json" {
+		printJSON(applied)
+		return
+	}
+
+	at := map[int64]time.Time{}
+	for _, a := range applied {
+		at[a.Version] = a.AppliedAt
+	}
+	for _, m := range ms {
+		status := "pending"
+		if t, ok := at[m.Version]; ok {
+			status = t.Format(time.RFC3339)
+		}
+		fmt.Printf("%d\t%s\t%s\n", m.Version, m.Name, status)
+	}
+}
@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+var (
+	databaseRotateDual bool
+)
+
+// databaseRotateCmd represents the database rotate command
+var databaseRotateCmd = &cobra.Command{
+	Use:   "rotate [rds name] [database name]",
+	Short: "Rotate the passwords of a database's users",
+	Long: `Rotate the passwords of the users of a database created from a template, by
+default the admin, writer and reader users.
+
+With --dual each user has an alternate login user in the same group role. The
+user not currently in use gets the new password and becomes active, so
+applications keep connecting with the old credentials until they pick up the
+new ones.`,
+	Args: cobra.ExactArgs(2),
+	Run:  databaseRotateFunc,
+}
+
+func init() {
+	databaseRotateCmd.Flags().BoolVarP(&databaseRotateDual, "dual", "", false, "rotate by switching between each user and its alternate")
+	databaseRotateCmd.Flags().StringVarP(&databaseTemplate, "template", "t", "", "YAML role template the database was created from")
+	databaseRotateCmd.Flags().StringVarP(&databaseOutput, "output", "o", "text", "output format, text or json")
+	databaseRotateCmd.Flags().StringVarP(&databaseSecretsSink, "secrets-sink", "", "", secretsSinkUsage)
+	databaseCmd.AddCommand(databaseRotateCmd)
+}
+
+func databaseRotateFunc(cmd *cobra.Command, args []string) {
+	name, dbname := args[0], args[1]
+	if databaseOutput != "text" && databaseOutput != "json" {
+		fmt.Printf("unknown output format %s\n", databaseOutput)
+		return
+	}
+
+	template, err := loadTemplate(databaseTemplate)
+	if err != nil {
+		fmt.Printf("failed to rotate credentials: %v\n", err)
+		return
+	}
+
+	sink, closeSink, err := getSecretSink(databaseSecretsSink)
+	if err != nil {
+		fmt.Printf("failed to rotate credentials: %v\n", err)
+		return
+	}
+	defer closeSink()
+
+	conn, err := connectInstance(name)
+	if err != nil {
+		fmt.Printf("failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	current, err := conn.DescribeDatabase(dbname, template)
+	if err != nil {
+		fmt.Printf("failed to describe database %s: %v\n", dbname, err)
+		return
+	}
+
+	dd, rotateErr := conn.RotateDatabaseCredentials(current, template, databaseRotateDual)
+	if dd == nil || len(dd.AllUsers()) == 0 {
+		fmt.Printf("failed to rotate credentials of database %s: %v\n", dbname, rotateErr)
+		return
+	}
+
+	if err := storeDescriptor(sink, dd); err != nil {
+		// the old passwords no longer work, print the new ones rather than lose them
+		fmt.Printf("failed to store database credentials: %v\n", err)
+	}
+
+	printDescriptor(dd)
+	if rotateErr != nil {
+		fmt.Printf("failed to rotate credentials of database %s, only the users above were rotated: %v\n", dbname, rotateErr)
+	}
+}
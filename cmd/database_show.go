@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// databaseShowCmd represents the database show command
+var databaseShowCmd = &cobra.Command{
+	Use:   "show [rds name] [database name]",
+	Short: "Show which roles hold which privileges on the schemas and tables of a database",
+	Args:  cobra.ExactArgs(2),
+	Run:   databaseShowFunc,
+}
+
+func init() {
+	databaseShowCmd.Flags().StringVarP(&databaseOutput, "output", "o", "text", "output format, text or json")
+	databaseCmd.AddCommand(databaseShowCmd)
+}
+
+func databaseShowFunc(cmd *cobra.Command, args []string) {
+	name, dbname := args[0], args[1]
+	if databaseOutput != "text" && databaseOutput != "json" {
+		fmt.Printf("unknown output format %s\n", databaseOutput)
+		return
+	}
+
+	conn, err := connectInstance(name)
+	if err != nil {
+		fmt.Printf("failed to connect: %v\n", err)
+		return
+	}
+	defer conn.Close()
+
+	grants, err := conn.ShowGrants(dbname)
+	if err != nil {
+		fmt.Printf("failed to show grants on %s: %v\n", dbname, err)
+		return
+	}
+	if databaseOutput == "json" {
+		printJSON(grants)
+		return
+	}
+
+	// one line per object and role, grants arrive ordered by both
+	var object, role string
+	var privs []string
+	flush := func() {
+		if len(privs) > 0 {
+			fmt.Printf("%s\t%s\t%s\n", object, role, strings.Join(privs, ","))
+		}
+	}
+	for _, g := range grants {
+		o := g.Schema
+		if g.Table != "" {
+			o = g.Schema + "." + g.Table
+		}
+		if o != object || g.Role != role {
+			flush()
+			object, role, privs = o, g.Role, nil
+		}
+		p := g.Privilege
+		if g.Grantable {
+			p += "*"
+		}
+		privs = append(privs, p)
+	}
+	flush()
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/MYOB-Technology/dataform/pkg/db"
+	"github.com/MYOB-Technology/dataform/pkg/password"
+)
+
+const masterPasswordLength = 30
+
+// readPassword reads a password from stdin or a file, returning an empty string when neither is requested
+func readPassword(fromStdin bool, file string) (string, error) {
+	if fromStdin && file != "" {
+		return "", fmt.Errorf("only one of stdin or a password file can be used")
+	}
+	if fromStdin {
+		line, err := stdin.ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("read password from stdin: %v", err)
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("read password file: %v", err)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	return "", nil
+}
+
+// masterPassword returns the supplied master password, or a generated one when none was supplied.
+// Supplied passwords are checked against the password policy of the engine.
+func masterPassword(manager *db.Manager, engine, supplied string, fromStdin bool, file string) (string, bool, error) {
+	if supplied != "" && (fromStdin || file != "") {
+		return "", false, fmt.Errorf("only one of --password, --password-stdin or --password-file can be used")
+	}
+	if supplied == "" {
+		var err error
+		supplied, err = readPassword(fromStdin, file)
+		if err != nil {
+			return "", false, err
+		}
+	}
+	if supplied != "" {
+		if err := password.ForEngine(engine).Validate(supplied); err != nil {
+			return "", false, err
+		}
+		return supplied, false, nil
+	}
+
+	generated, err := manager.GenerateRandomPassword(engine, masterPasswordLength)
+	if err != nil {
+		return "", false, err
+	}
+	return generated, true, nil
+}
+
+// openSecret opens path for a secret before the secret is set, so that a secret that
+// cannot be written is never set, and returns the func writing it, to stdout when path
+// is "-". The file is only truncated once the secret is written.
+func openSecret(path string) (func(secret string) error, error) {
+	if path == "-" {
+		return func(secret string) error {
+			fmt.Println(secret)
+			return nil
+		}, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return func(secret string) error {
+		if err := f.Truncate(0); err != nil {
+			f.Close()
+			return err
+		}
+		if _, err := f.WriteString(secret + "\n"); err != nil {
+			f.Close()
+			return err
+		}
+		return f.Close()
+	}, nil
+}
@@ -1,6 +1,11 @@
 package cmd
 
 import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -23,6 +28,9 @@ var RootCmd = &cobra.Command{
 
 var (
 	awsRegion string
+
+	// stdin is shared so that prompts and piped secrets read from the same buffer
+	stdin = bufio.NewReader(os.Stdin)
 )
 
 func init() {
@@ -47,6 +55,17 @@ func getAwsError(err error) string {
 	return err.Error()
 }
 
+// confirm asks the user a yes/no question on stdin and reports whether they answered yes
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N]: ", question)
+	answer, err := stdin.ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
 // Execute ...
 func Execute() {
 	RootCmd.Execute()
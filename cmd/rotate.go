@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/MYOB-Technology/dataform/pkg/db"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/spf13/cobra"
+)
+
+var (
+	rotatePasswordStdin bool
+	rotatePasswordFile  string
+	rotatePasswordOut   string
+)
+
+// rotateMasterCmd represents the rotate-master command
+var rotateMasterCmd = &cobra.Command{
+	Use:   "rotate-master [rds name]",
+	Short: "Set a new master password on an RDS instance",
+	Args:  cobra.ExactArgs(1),
+	Run:   rotateMasterFunc,
+}
+
+func init() {
+	rotateMasterCmd.Flags().BoolVarP(&rotatePasswordStdin, "password-stdin", "", false, "read the new master password from stdin")
+	rotateMasterCmd.Flags().StringVarP(&rotatePasswordFile, "password-file", "", "", "read the new master password from a file")
+	rotateMasterCmd.Flags().StringVarP(&rotatePasswordOut, "password-out", "", "", "write the new master password to a file, - for stdout")
+	RootCmd.AddCommand(rotateMasterCmd)
+}
+
+func rotateMasterFunc(cmd *cobra.Command, args []string) {
+	session := getAwsSession()
+	manager := db.NewManager(rds.New(session))
+	name := args[0]
+
+	instance, err := manager.Stat(name)
+	if err != nil {
+		fmt.Printf("%s: %s\n", name, getAwsError(err))
+		return
+	}
+	if instance == nil {
+		fmt.Printf("%s: instance not found\n", name)
+		return
+	}
+
+	password, generated, err := masterPassword(manager, *instance.Engine, "", rotatePasswordStdin, rotatePasswordFile)
+	if err != nil {
+		fmt.Printf("failed to rotate master password: %v\n", err)
+		return
+	}
+	if generated && rotatePasswordOut == "" {
+		fmt.Println("refusing to set a generated master password without --password-out")
+		return
+	}
+	var writePassword func(string) error
+	if rotatePasswordOut != "" {
+		if writePassword, err = openSecret(rotatePasswordOut); err != nil {
+			fmt.Printf("failed to open password output: %v\n", err)
+			return
+		}
+	}
+
+	fmt.Printf("rotating master password of instance %s\n", name)
+	instance, err = manager.RotateMasterPassword(name, password)
+	if err != nil {
+		fmt.Printf("failed to rotate master password: %v\n", getAwsError(err))
+		return
+	}
+
+	if writePassword != nil {
+		if err := writePassword(password); err != nil {
+			fmt.Printf("failed to write master password: %v\n", err)
+			return
+		}
+	}
+
+	go manager.SigHandler()
+	if waitForAvailable(manager, *instance.Name) {
+		fmt.Printf("rotated master password of %s\n", *instance.Name)
+	}
+}
@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/MYOB-Technology/dataform/pkg/secrets"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+)
+
+const secretsSinkUsage = "store generated credentials in file:PATH, pgpass[:PATH], dotenv[:PATH], kubernetes[:NAMESPACE] or secretsmanager[:PREFIX]"
+
+// getSecretSink returns the SecretSink described by spec, and a func to close any file it opened.
+// A nil sink is returned for an empty spec.
+func getSecretSink(spec string) (secrets.SecretSink, func() error, error) {
+	noop := func() error { return nil }
+	if spec == "" {
+		return nil, noop, nil
+	}
+
+	kind, arg := spec, ""
+	if i := strings.Index(spec, ":"); i >= 0 {
+		kind, arg = spec[:i], spec[i+1:]
+	}
+
+	switch kind {
+	case "file":
+		passphrase := os.Getenv("DFM_SECRETS_PASSPHRASE")
+		if arg == "" || passphrase == "" {
+			return nil, noop, fmt.Errorf("secrets sink file needs a path and DFM_SECRETS_PASSPHRASE")
+		}
+		return &secrets.EncryptedFile{Path: arg, Passphrase: []byte(passphrase)}, noop, nil
+	case "pgpass":
+		if arg == "" {
+			arg = os.Getenv("PGPASSFILE")
+		}
+		if arg == "" {
+			arg = filepath.Join(os.Getenv("HOME"), ".pgpass")
+		}
+		return &secrets.PgPass{Path: arg}, noop, nil
+	case "dotenv":
+		w, closer, err := secretWriter(arg)
+		if err != nil {
+			return nil, noop, err
+		}
+		return &secrets.Dotenv{W: w}, closer, nil
+	case "kubernetes", "k8s":
+		return &secrets.Kubernetes{W: os.Stdout, Namespace: arg}, noop, nil
+	case "secretsmanager":
+		if arg == "" {
+			arg = "dfm/"
+		}
+		client := secretsmanager.New(getAwsSession())
+		return &secrets.SecretsManager{Client: client, Prefix: arg}, noop, nil
+	}
+	return nil, noop, fmt.Errorf("unknown secrets sink %v", kind)
+}
+
+// secretWriter opens path for secrets readable only by the user, or returns stdout for an empty path
+func secretWriter(path string) (io.Writer, func() error, error) {
+	if path == "" || path == "-" {
+		return os.Stdout, func() error { return nil }, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/MYOB-Technology/dataform/pkg/db"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/spf13/cobra"
+)
+
+var (
+	pruneKeepLast   int
+	pruneMaxAgeDays int
+	pruneKeepTag    string
+	pruneYes        bool
+)
+
+// snapshotCmd represents the snapshot command
+var snapshotCmd = &cobra.Command{
+	Use:   "snapshot",
+	Short: "Manage RDS snapshots",
+}
+
+// snapshotPruneCmd represents the snapshot prune command
+var snapshotPruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Delete final snapshots left behind by delete",
+	Args:  cobra.NoArgs,
+	Run:   snapshotPruneFunc,
+}
+
+func init() {
+	snapshotPruneCmd.Flags().IntVarP(&pruneKeepLast, "keep-last", "k", 1, "number of final snapshots to always keep per instance")
+	snapshotPruneCmd.Flags().IntVarP(&pruneMaxAgeDays, "max-age", "a", 0, "delete final snapshots older than this many days, 0 deletes all beyond keep-last")
+	snapshotPruneCmd.Flags().StringVarP(&pruneKeepTag, "keep-tag", "t", "dfm:keep", "tag key marking final snapshots that are never deleted")
+	snapshotPruneCmd.Flags().BoolVarP(&pruneYes, "yes", "y", false, "delete without asking for confirmation")
+	snapshotCmd.AddCommand(snapshotPruneCmd)
+	RootCmd.AddCommand(snapshotCmd)
+}
+
+func snapshotPruneFunc(cmd *cobra.Command, args []string) {
+	session := getAwsSession()
+	manager := db.NewManager(rds.New(session))
+
+	policy := db.PrunePolicy{
+		KeepLast: pruneKeepLast,
+		MaxAge:   time.Duration(pruneMaxAgeDays) * 24 * time.Hour,
+		KeepTag:  pruneKeepTag,
+	}
+
+	plan, err := manager.PrunePlan(policy)
+	if err != nil {
+		fmt.Printf("failed to plan snapshot prune: %v\n", getAwsError(err))
+		return
+	}
+
+	deletes := 0
+	for _, action := range plan {
+		fmt.Println(action)
+		if action.Delete {
+			deletes++
+		}
+	}
+	if deletes == 0 {
+		fmt.Println("nothing to prune")
+		return
+	}
+
+	if !pruneYes && !confirm(fmt.Sprintf("delete %d snapshots?", deletes)) {
+		fmt.Println("aborted")
+		return
+	}
+
+	failed := false
+	for _, action := range plan {
+		if !action.Delete {
+			continue
+		}
+		if _, err := manager.DeleteSnapshot(*action.Snapshot.Name); err != nil {
+			fmt.Printf("failed to delete snapshot %s: %v\n", *action.Snapshot.Name, getAwsError(err))
+			failed = true
+			continue
+		}
+		fmt.Printf("deleted snapshot %s\n", *action.Snapshot.Name)
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,45 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/MYOB-Technology/dataform/pkg/db"
+	"github.com/aws/aws-sdk-go/service/rds"
+	"github.com/spf13/cobra"
+)
+
+// undeleteCmd represents the undelete command
+var undeleteCmd = &cobra.Command{
+	Use:   "undelete [rds name]",
+	Short: "Restore a deleted RDS instance from its most recent final snapshot",
+	Args:  cobra.ExactArgs(1),
+	Run:   undeleteFunc,
+}
+
+func init() {
+	RootCmd.AddCommand(undeleteCmd)
+}
+
+func undeleteFunc(cmd *cobra.Command, args []string) {
+	session := getAwsSession()
+	manager := db.NewManager(rds.New(session))
+	name := args[0]
+
+	instance, snapshot, err := manager.Undelete(name)
+	if err != nil {
+		fmt.Printf("failed to undelete instance %s: %v\n", name, getAwsError(err))
+		return
+	}
+	fmt.Printf("restoring instance %s from snapshot %s\n", name, *snapshot.Name)
+
+	go manager.SigHandler()
+	status := manager.WaitForFinalState(*instance.Name, 20, 3600)
+	for poll := range status {
+		if poll.Err != nil {
+			fmt.Printf("instance transitioned to error condition: %v\n", poll.Err)
+			return
+		}
+		fmt.Printf("%s instance %s\n", poll.Status, *instance.Name)
+	}
+	fmt.Printf("restored %s %s\n", *instance.Name, *instance.ARN)
+}
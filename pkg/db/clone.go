@@ -0,0 +1,173 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+const (
+	// TagCloneOf records the source instance of a clone
+	TagCloneOf = "dfm:clone-of"
+	// TagExpires records the RFC3339 time after which a clone may be deleted
+	TagExpires = "dfm:expires"
+)
+
+// CloneOptions configures the instance created by Clone
+type CloneOptions struct {
+	// Snapshot to restore from, the latest restorable time of the source is used when empty
+	Snapshot        string
+	DBInstanceClass *string
+	TTL             time.Duration
+}
+
+// CreateCloneSnapshot takes a manual snapshot of source to clone target from
+func (r *Manager) CreateCloneSnapshot(source, target string) (*Snapshot, error) {
+	name := fmt.Sprintf("%s-clone-%s-%s", source, target, time.Now().Format(finalSnapshotTimeFormat))
+	result, err := r.Client.CreateDBSnapshot(&rds.CreateDBSnapshotInput{
+		DBInstanceIdentifier: aws.String(source),
+		DBSnapshotIdentifier: aws.String(name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return FromDBSnapshot(result.DBSnapshot), nil
+}
+
+// StatSnapshot returns the status of a snapshot
+func (r *Manager) StatSnapshot(name string) (*Snapshot, error) {
+	result, err := r.Client.DescribeDBSnapshots(&rds.DescribeDBSnapshotsInput{
+		DBSnapshotIdentifier: aws.String(name),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(result.DBSnapshots) == 0 {
+		return nil, nil
+	}
+
+	return FromDBSnapshot(result.DBSnapshots[0]), nil
+}
+
+// WaitForSnapshot will block until the requested snapshot is available
+func (r *Manager) WaitForSnapshot(name string, pollInterval time.Duration, pollTimeout time.Duration) <-chan State {
+	return r.poll(name, pollInterval, pollTimeout, func() State {
+		snapshot, err := r.StatSnapshot(name)
+		if err != nil {
+			return State{Final: true, Err: err}
+		}
+		if snapshot == nil {
+			return State{Final: true, Status: StatusDeleted, Err: errNoFinalSnapshot}
+		}
+		switch status := aws.StringValue(snapshot.Status); status {
+		case StatusAvailable:
+			return State{Final: true, Status: status}
+		case StatusCreating:
+			return State{Final: false, Status: status}
+		default:
+			return State{Final: true, Status: status, Err: errStateTransitionedToErrorCondition}
+		}
+	})
+}
+
+// Clone restores a copy of the source instance as target with Development profile
+// defaults, in the source's subnet and security groups, tagged to expire after the TTL.
+func (r *Manager) Clone(source, target string, opts CloneOptions) (*DB, error) {
+	src, err := r.Stat(source)
+	if err != nil {
+		return nil, err
+	}
+	if src == nil {
+		return nil, fmt.Errorf("error: source instance %s not found", source)
+	}
+
+	class := src.DBInstanceClass
+	if opts.DBInstanceClass != nil {
+		class = opts.DBInstanceClass
+	}
+	tags := cloneTags(source, opts.TTL, actualClock{})
+
+	if opts.Snapshot == "" {
+		result, err := r.Client.RestoreDBInstanceToPointInTime(&rds.RestoreDBInstanceToPointInTimeInput{
+			SourceDBInstanceIdentifier: aws.String(source),
+			TargetDBInstanceIdentifier: aws.String(target),
+			UseLatestRestorableTime:    aws.Bool(true),
+			DBInstanceClass:            class,
+			DBSubnetGroupName:          src.SubnetGroupName,
+			VpcSecurityGroupIds:        src.SecurityGroups,
+			MultiAZ:                    DevelopmentDefaults.MultiAZ,
+			CopyTagsToSnapshot:         aws.Bool(true),
+			Tags:                       tags,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return FromDBInstance(result.DBInstance), nil
+	}
+
+	result, err := r.Client.RestoreDBInstanceFromDBSnapshot(&rds.RestoreDBInstanceFromDBSnapshotInput{
+		DBSnapshotIdentifier: aws.String(opts.Snapshot),
+		DBInstanceIdentifier: aws.String(target),
+		DBInstanceClass:      class,
+		DBSubnetGroupName:    src.SubnetGroupName,
+		VpcSecurityGroupIds:  src.SecurityGroups,
+		MultiAZ:              DevelopmentDefaults.MultiAZ,
+		CopyTagsToSnapshot:   aws.Bool(true),
+		Tags:                 tags,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return FromDBInstance(result.DBInstance), nil
+}
+
+// WaitForModifying will block until the requested instance is no longer available, as
+// it is once a modification applied immediately has started. It times out when the
+// modification does not change the instance.
+func (r *Manager) WaitForModifying(name string, pollInterval time.Duration, pollTimeout time.Duration) <-chan State {
+	return r.poll(name, pollInterval, pollTimeout, func() State {
+		db, err := r.Stat(name)
+		if err != nil {
+			return State{Final: true, Err: err}
+		}
+		if db == nil {
+			return State{Final: true, Status: StatusDeleted, Err: errStateTransitionedToErrorCondition}
+		}
+		status := aws.StringValue(db.Status)
+		return State{Final: status != StatusAvailable, Status: status}
+	})
+}
+
+// ApplyProfile modifies an existing instance to match the defaults of a profile
+func (r *Manager) ApplyProfile(name string, profile int) (*DB, error) {
+	defaults := SetDevelopmentDefaults()
+	if profile == Production {
+		defaults = SetProductionDefaults()
+	}
+
+	result, err := r.Client.ModifyDBInstance(&rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier:  aws.String(name),
+		MultiAZ:               defaults.MultiAZ,
+		BackupRetentionPeriod: defaults.BackupRetentionPeriod,
+		ApplyImmediately:      aws.Bool(true),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return FromDBInstance(result.DBInstance), nil
+}
+
+// cloneTags returns the tags marking an instance as a clone of source that expires after ttl
+func cloneTags(source string, ttl time.Duration, t clock) []*rds.Tag {
+	tags := []*rds.Tag{
+		{Key: aws.String(TagCloneOf), Value: aws.String(source)},
+	}
+	if ttl > 0 {
+		expires := t.Now().Add(ttl).UTC().Format(time.RFC3339)
+		tags = append(tags, &rds.Tag{Key: aws.String(TagExpires), Value: aws.String(expires)})
+	}
+	return tags
+}
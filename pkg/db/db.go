@@ -2,18 +2,22 @@ package db
 
 import (
 	"fmt"
-	"math/rand"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	time "time"
 
+	"github.com/MYOB-Technology/dataform/pkg/password"
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/rds"
 	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
 )
 
+// TagEnvironment records the environment of an instance, see IsProduction
+const TagEnvironment = "environment"
+
 var (
 	// Defaults are rds instance defaults for non production
 	CommonDefaults = InstanceParams{
@@ -70,6 +74,8 @@ type Manager struct {
 	wait    sync.WaitGroup
 	signals chan os.Signal
 	stop    chan struct{}
+	// pollUnit is the unit of poll intervals and timeouts, a second when zero
+	pollUnit time.Duration
 }
 
 // NewManager returns a pointer to a Manager struct.
@@ -229,6 +235,7 @@ func mapDBInstanceParamaters(database *DB) (*rds.CreateDBInstanceInput, error) {
 		StorageType:          database.StorageType,
 		Iops:                 database.StorageIops,
 		BackupRetentionPeriod: database.BackupRetentionPeriod,
+		CopyTagsToSnapshot:    database.CopyTagsToSnapshot,
 	}
 
 	if database.KMSKeyArn != nil {
@@ -254,10 +261,42 @@ func mapDBInstanceParamaters(database *DB) (*rds.CreateDBInstanceInput, error) {
 	return dbInput, nil
 }
 
-// Delete an RDS Instance with the given name
+// Delete an RDS Instance with the given name. The instance class, subnet group and
+// security groups are tagged on the instance first, and copying tags to snapshots
+// is enabled on instances created without it, so that they are copied to the
+// final snapshot and Undelete can recreate it. The instance is deleted once it
+// is available again after that change.
 func (r *Manager) Delete(name string) (*DB, error) {
-	now := time.Now()
-	snapshotID := fmt.Sprintf("%s-%s", name, now.Format("20060102150405"))
+	db, err := r.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	if db != nil {
+		if !aws.BoolValue(db.CopyTagsToSnapshot) {
+			_, err = r.Client.ModifyDBInstance(&rds.ModifyDBInstanceInput{
+				DBInstanceIdentifier: aws.String(name),
+				CopyTagsToSnapshot:   aws.Bool(true),
+				ApplyImmediately:     aws.Bool(true),
+			})
+			if err != nil {
+				return nil, err
+			}
+			if err := r.waitForModification(name); err != nil {
+				return nil, err
+			}
+		}
+		if tags := restoreTags(db); len(tags) > 0 {
+			_, err = r.Client.AddTagsToResource(&rds.AddTagsToResourceInput{
+				ResourceName: db.ARN,
+				Tags:         tags,
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	snapshotID := finalSnapshotName(name, time.Now())
 	dbInstanceInput := &rds.DeleteDBInstanceInput{
 		DBInstanceIdentifier:      aws.String(name),
 		FinalDBSnapshotIdentifier: aws.String(snapshotID),
@@ -272,6 +311,28 @@ func (r *Manager) Delete(name string) (*DB, error) {
 	return FromDBInstance(result.DBInstance), nil
 }
 
+// waitForModification waits for an instance to be available again after a
+// modification applied immediately
+func (r *Manager) waitForModification(name string) error {
+	// the instance stays available until the modification starts, and may stay so throughout
+	for poll := range r.WaitForModifying(name, 5, 30) {
+		if poll.Err != nil && poll.Status != "timeout" {
+			return poll.Err
+		}
+	}
+	status := ""
+	for poll := range r.WaitForFinalState(name, 10, 1800) {
+		if poll.Err != nil {
+			return poll.Err
+		}
+		status = poll.Status
+	}
+	if status != StatusAvailable {
+		return fmt.Errorf("error: instance %s is %s after modifying it", name, status)
+	}
+	return nil
+}
+
 // Stat returns the status of an RDS Instance
 func (r *Manager) Stat(name string) (*DB, error) {
 	dbInstanceInput := &rds.DescribeDBInstancesInput{
@@ -290,6 +351,30 @@ func (r *Manager) Stat(name string) (*DB, error) {
 	return FromDBInstance(result.DBInstances[0]), nil
 }
 
+// ListInstanceTags returns the tags of an RDS Instance
+func (r *Manager) ListInstanceTags(db *DB) ([]*Tag, error) {
+	result, err := r.Client.ListTagsForResource(&rds.ListTagsForResourceInput{
+		ResourceName: db.ARN,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromRDSTags(result.TagList), nil
+}
+
+// IsProduction reports whether tags mark an instance as production, with an
+// environment or env tag of production or prod in any case
+func IsProduction(tags []*Tag) bool {
+	for _, t := range tags {
+		key := strings.ToLower(aws.StringValue(t.Key))
+		value := strings.ToLower(aws.StringValue(t.Value))
+		if (key == TagEnvironment || key == "env") && (value == "production" || value == "prod") {
+			return true
+		}
+	}
+	return false
+}
+
 // List returns the status of all RDS Instances
 func (r *Manager) List() ([]*DB, error) {
 	dbInstanceInput := &rds.DescribeDBInstancesInput{}
@@ -302,6 +387,26 @@ func (r *Manager) List() ([]*DB, error) {
 	return FromDBInstances(result.DBInstances), nil
 }
 
+// RotateMasterPassword sets a new master password on an RDS Instance
+func (r *Manager) RotateMasterPassword(name, password string) (*DB, error) {
+	if len(password) == 0 {
+		return nil, errDbMasterUserPasswordMissing
+	}
+
+	dbInstanceInput := &rds.ModifyDBInstanceInput{
+		DBInstanceIdentifier: aws.String(name),
+		MasterUserPassword:   aws.String(password),
+		ApplyImmediately:     aws.Bool(true),
+	}
+
+	result, err := r.Client.ModifyDBInstance(dbInstanceInput)
+	if err != nil {
+		return nil, err
+	}
+
+	return FromDBInstance(result.DBInstance), nil
+}
+
 // State is used to return whether DB state is finalised or not
 type State struct {
 	Final  bool
@@ -311,10 +416,29 @@ type State struct {
 
 // WaitForFinalState will block until the requested instance is in a known final state
 func (r *Manager) WaitForFinalState(dbname string, pollInterval time.Duration, pollTimeout time.Duration) <-chan State {
+	return r.poll(dbname, pollInterval, pollTimeout, func() State {
+		db, err := r.Stat(dbname)
+		if err != nil {
+			return State{
+				Final:  true,
+				Status: StatusDeleted,
+				Err:    err,
+			}
+		}
+		return r.IsFinalState(db)
+	})
+}
+
+// poll sends the result of check every pollInterval seconds until it is final, pollTimeout seconds pass or the Manager is stopped
+func (r *Manager) poll(name string, pollInterval time.Duration, pollTimeout time.Duration, check func() State) <-chan State {
+	unit := r.pollUnit
+	if unit == 0 {
+		unit = time.Second
+	}
 	result := make(chan State)
 	go func() {
-		timeout := time.After(pollTimeout * time.Second)
-		tick := time.Tick(pollInterval * time.Second)
+		timeout := time.After(pollTimeout * unit)
+		tick := time.Tick(pollInterval * unit)
 		r.wait.Add(1)
 		defer close(result)
 		defer r.wait.Done()
@@ -331,20 +455,11 @@ func (r *Manager) WaitForFinalState(dbname string, pollInterval time.Duration, p
 				result <- State{
 					Final:  false,
 					Status: "timeout",
-					Err:    fmt.Errorf("error timed out polling for db final state: %s", dbname),
+					Err:    fmt.Errorf("error timed out polling for db final state: %s", name),
 				}
 				return
 			case <-tick:
-				db, err := r.Stat(dbname)
-				if err != nil {
-					result <- State{
-						Final:  true,
-						Status: StatusDeleted,
-						Err:    err,
-					}
-					return
-				}
-				status := r.IsFinalState(db)
+				status := check()
 				result <- status
 				if status.Final {
 					return
@@ -385,26 +500,14 @@ func (r *Manager) IsFinalState(db *DB) State {
 	}
 }
 
-// generateRandomString receives a size and a string of allowed characters and generates a random string of the given size
-func generateRandomString(strlen int, allowedChars string, t clock) string {
-	rsource := rand.New(rand.NewSource(t.Now().UnixNano()))
-	result := make([]byte, strlen)
-	for i := range result {
-		result[i] = allowedChars[rsource.Intn(len(allowedChars))]
-	}
-	return string(result)
-}
-
-// GenerateRandomPassword receives a size and generates a random password of that size
-func (r *Manager) GenerateRandomPassword(strlen int) string {
-	const allowedChars = "abcdefghijklmnopqrstuvwxyzABCDEFHIJKLMNOPQRSTUVWXYZ0123456789!#$%^&*()-+="
-	return generateRandomString(strlen, allowedChars, actualClock{})
+// GenerateRandomPassword receives an engine and a size and generates a random master password of that size
+func (r *Manager) GenerateRandomPassword(engine string, strlen int) (string, error) {
+	return password.ForEngine(engine).WithLength(strlen).Generate()
 }
 
 // GenerateRandomUsername receives a size and generates a random username of that size
-func (r *Manager) GenerateRandomUsername(strlen int) string {
-	const allowedChars = "abcdefghijklmnopqrstuvwxyz"
-	return generateRandomString(strlen, allowedChars, actualClock{})
+func (r *Manager) GenerateRandomUsername(strlen int) (string, error) {
+	return password.Random(strlen, password.Lower)
 }
 
 // clock allows us to mock out time.Now in our tests
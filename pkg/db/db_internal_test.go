@@ -2,9 +2,11 @@ package db
 
 import (
 	"fmt"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/MYOB-Technology/dataform/pkg/password"
 	"github.com/aws/aws-sdk-go/service/rds/rdsiface"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -107,21 +109,33 @@ func TestDelete(t *testing.T) {
 				MultiAZ:              &tC.multiaz,
 				DBInstanceIdentifier: &tC.name,
 				DBInstanceArn:        &tC.arn,
+				DBInstanceStatus:     aws.String(StatusAvailable),
 			}
 			expectedDB := FromDBInstance(&DBInstance)
 
+			modify := &rds.ModifyDBInstanceInput{}
 			svc := mockRdsSvc{
-				err: tC.err,
+				err:                   tC.err,
+				ModifyDBInstanceInput: modify,
 				DeleteDBInstanceOutput: &rds.DeleteDBInstanceOutput{
 					DBInstance: &DBInstance,
 				},
+				DescribeDBInstancesOutput: &rds.DescribeDBInstancesOutput{
+					DBInstances: []*rds.DBInstance{
+						&DBInstance,
+					},
+				},
 			}
 			rds := NewManager(svc)
+			rds.pollUnit = time.Millisecond
 
 			db, err := rds.Delete(tC.name)
 			if err != tC.err {
 				t.Errorf("Expected error to be %v, got %v", tC.err, err)
 			}
+			if tC.err == nil && !aws.BoolValue(modify.CopyTagsToSnapshot) {
+				t.Errorf("Expected copying tags to snapshots to be enabled before deleting")
+			}
 
 			if db != nil {
 				if db.ARN != expectedDB.ARN {
@@ -138,6 +152,42 @@ func TestDelete(t *testing.T) {
 	}
 }
 
+func TestDeleteWaitsForModification(t *testing.T) {
+	name := "db-modifying"
+	instance := func(status string) *rds.DescribeDBInstancesOutput {
+		return &rds.DescribeDBInstancesOutput{DBInstances: []*rds.DBInstance{{
+			DBInstanceIdentifier: aws.String(name),
+			DBInstanceArn:        aws.String("arn:123:123:rds:db-modifying"),
+			DBInstanceStatus:     aws.String(status),
+		}}}
+	}
+	var calls []string
+	svc := mockRdsSvc{
+		ModifyDBInstanceInput: &rds.ModifyDBInstanceInput{},
+		DeleteDBInstanceOutput: &rds.DeleteDBInstanceOutput{
+			DBInstance: &rds.DBInstance{DBInstanceIdentifier: aws.String(name)},
+		},
+		DescribeDBInstancesSequence: []*rds.DescribeDBInstancesOutput{
+			instance(StatusAvailable),
+			instance(StatusAvailable),
+			instance(StatusModifying),
+			instance(StatusModifying),
+			instance(StatusAvailable),
+		},
+		calls: &calls,
+	}
+	rds := NewManager(svc)
+	rds.pollUnit = time.Millisecond
+
+	if _, err := rds.Delete(name); err != nil {
+		t.Fatal(err)
+	}
+	x := []string{"describe", "describe", "describe", "describe", "describe", "delete"}
+	if !reflect.DeepEqual(calls, x) {
+		t.Errorf("Expected the instance to be deleted once available again, got calls %v", calls)
+	}
+}
+
 func TestStatus(t *testing.T) {
 	name := "db-stating"
 	arn := "arn:123:123:rds:db-stating"
@@ -246,29 +296,362 @@ func TestIsFinalState(t *testing.T) {
 
 }
 
-func TestGenerateRandomString(t *testing.T) {
+func TestGenerateRandomPassword(t *testing.T) {
+	testCases := []struct {
+		desc, engine string
+		size         int
+		err          bool
+	}{
+		{desc: "Postgres", engine: "postgres", size: 30},
+		{desc: "MySQL Too Long", engine: "mysql", size: 50, err: true},
+		{desc: "Too Short", engine: "postgres", size: 4, err: true},
+	}
+
+	rds := NewManager(mockRdsSvc{})
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got, err := rds.GenerateRandomPassword(tC.engine, tC.size)
+			if (err != nil) != tC.err {
+				t.Fatalf("Expected error %v, got %v", tC.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if len(got) != tC.size {
+				t.Errorf("Expected password of length %d, got %d", tC.size, len(got))
+			}
+			if err := password.ForEngine(tC.engine).Validate(got); err != nil {
+				t.Errorf("Expected generated password to be valid, got %v", err)
+			}
+		})
+	}
+}
+
+func TestIsFinalSnapshot(t *testing.T) {
+	testCases := []struct {
+		desc, name, snapshot string
+		expected             bool
+	}{
+		{desc: "Final Snapshot", name: "vegeta", snapshot: "vegeta-20171201093000", expected: true},
+		{desc: "Other Instance", name: "vegeta", snapshot: "vegeta-prod-20171201093000", expected: false},
+		{desc: "Manual Snapshot", name: "vegeta", snapshot: "vegeta-before-upgrade", expected: false},
+		{desc: "Short Timestamp", name: "vegeta", snapshot: "vegeta-201712010930", expected: false},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			got := IsFinalSnapshot(tC.name, tC.snapshot)
+			if got != tC.expected {
+				t.Errorf("Expected IsFinalSnapshot(%s, %s) to be %v, got %v", tC.name, tC.snapshot, tC.expected, got)
+			}
+		})
+	}
+}
+
+func TestUndelete(t *testing.T) {
+	name := "vegeta"
+	var cases = []struct {
+		desc      string
+		snapshots []string
+		status    string
+		restored  string
+		untagged  bool
+		err       error
+	}{
+		{desc: "Latest Snapshot", snapshots: []string{"vegeta-20171201093000", "vegeta-20180101093000", "vegeta-manual"}, status: StatusAvailable, restored: "vegeta-20180101093000"},
+		{desc: "No Final Snapshot", snapshots: []string{"vegeta-manual"}, status: StatusAvailable, err: errNoFinalSnapshot},
+		{desc: "Untagged Snapshot", snapshots: []string{"vegeta-20180101093000"}, status: StatusAvailable, untagged: true},
+	}
+
+	for _, tC := range cases {
+		t.Run(tC.desc, func(t *testing.T) {
+			DBSnapshots := []*rds.DBSnapshot{}
+			for i := range tC.snapshots {
+				DBSnapshots = append(DBSnapshots, &rds.DBSnapshot{
+					DBInstanceIdentifier: &name,
+					DBSnapshotIdentifier: &tC.snapshots[i],
+					DBSnapshotArn:        aws.String("arn:" + tC.snapshots[i]),
+					Status:               &tC.status,
+				})
+			}
+
+			tags := []*rds.Tag{{Key: aws.String("team"), Value: aws.String("saiyan")}}
+			if !tC.untagged {
+				tags = append(tags,
+					&rds.Tag{Key: aws.String(TagInstanceClass), Value: aws.String("db.t2.large")},
+					&rds.Tag{Key: aws.String(TagSubnetGroup), Value: aws.String("capsule-corp")},
+					&rds.Tag{Key: aws.String(TagSecurityGroups), Value: aws.String("sg-1 sg-2")},
+				)
+			}
+			input := &rds.RestoreDBInstanceFromDBSnapshotInput{}
+			svc := mockRdsSvc{
+				DescribeDBSnapshotsOutput: &rds.DescribeDBSnapshotsOutput{
+					DBSnapshots: DBSnapshots,
+				},
+				ListTagsForResourceOutput: &rds.ListTagsForResourceOutput{
+					TagList: tags,
+				},
+				RestoreDBInstanceFromDBSnapshotOutput: &rds.RestoreDBInstanceFromDBSnapshotOutput{
+					DBInstance: &rds.DBInstance{
+						DBInstanceIdentifier: &name,
+					},
+				},
+				RestoreDBInstanceFromDBSnapshotInput: input,
+			}
+			rds := NewManager(svc)
+
+			db, snapshot, err := rds.Undelete(name)
+			if tC.untagged {
+				if err == nil {
+					t.Fatalf("Expected restore of an untagged snapshot to fail")
+				}
+				if input.DBSnapshotIdentifier != nil {
+					t.Errorf("Expected no restore, got one from %v", aws.StringValue(input.DBSnapshotIdentifier))
+				}
+				return
+			}
+			if err != tC.err {
+				t.Fatalf("Expected error to be %v, got %v", tC.err, err)
+			}
+			if err != nil {
+				return
+			}
+
+			if *snapshot.Name != tC.restored {
+				t.Errorf("Expected snapshot to be %v, got %v", tC.restored, *snapshot.Name)
+			}
+			if *db.Name != name {
+				t.Errorf("Expected db name to be %v, got %v", name, *db.Name)
+			}
+			if aws.StringValue(input.DBSnapshotIdentifier) != tC.restored {
+				t.Errorf("Expected restore from %v, got %v", tC.restored, aws.StringValue(input.DBSnapshotIdentifier))
+			}
+			if aws.StringValue(input.DBInstanceClass) != "db.t2.large" {
+				t.Errorf("Expected instance class db.t2.large, got %v", aws.StringValue(input.DBInstanceClass))
+			}
+			if aws.StringValue(input.DBSubnetGroupName) != "capsule-corp" {
+				t.Errorf("Expected subnet group capsule-corp, got %v", aws.StringValue(input.DBSubnetGroupName))
+			}
+			if len(input.VpcSecurityGroupIds) != 2 {
+				t.Errorf("Expected 2 security groups, got %v", aws.StringValueSlice(input.VpcSecurityGroupIds))
+			}
+			if len(input.Tags) != 1 || aws.StringValue(input.Tags[0].Key) != "team" {
+				t.Errorf("Expected only the team tag to be restored, got %v", input.Tags)
+			}
+		})
+	}
+}
+
+func TestPlanPrune(t *testing.T) {
+	available := StatusAvailable
+	creating := StatusCreating
+	now := mockClock{}.Now()
+	snapshot := func(instance, name string, age time.Duration, status *string) *Snapshot {
+		created := now.Add(-age)
+		return &Snapshot{
+			Name:         aws.String(name),
+			InstanceName: aws.String(instance),
+			Status:       status,
+			CreateTime:   &created,
+		}
+	}
+	// sorted newest first as ListAllFinalSnapshots returns them
+	snapshots := []*Snapshot{
+		snapshot("goku", "goku-20180301000000", 0, &creating),
+		snapshot("goku", "goku-20180201000000", 24*time.Hour, &available),
+		snapshot("gohan", "gohan-20180115000000", 20*24*time.Hour, &available),
+		snapshot("goku", "goku-20180101000000", 40*24*time.Hour, &available),
+		snapshot("goku", "goku-20171201000000", 70*24*time.Hour, &available),
+	}
+
 	testCases := []struct {
 		desc     string
-		size     int
-		allowed  string
-		expected string
+		policy   PrunePolicy
+		expected []bool
 	}{
-		{
-			desc: "0 size", size: 0, allowed: "abc", expected: "",
-		},
-		{
-			desc: "Valid Size and Some Chars", size: 10, allowed: "abc", expected: "accbacccac",
+		{desc: "Keep Last", policy: PrunePolicy{KeepLast: 2}, expected: []bool{false, false, false, true, true}},
+		{desc: "Keep Last And Max Age", policy: PrunePolicy{KeepLast: 1, MaxAge: 60 * 24 * time.Hour}, expected: []bool{false, false, false, false, true}},
+		{desc: "Max Age Only", policy: PrunePolicy{MaxAge: 10 * 24 * time.Hour}, expected: []bool{false, false, true, true, true}},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			plan := planPrune(snapshots, tC.policy, mockClock{})
+			if len(plan) != len(tC.expected) {
+				t.Fatalf("Expected %d actions, got %d", len(tC.expected), len(plan))
+			}
+			for i, action := range plan {
+				if action.Delete != tC.expected[i] {
+					t.Errorf("Expected delete of %s to be %v, got %v (%s)", *action.Snapshot.Name, tC.expected[i], action.Delete, action.Reason)
+				}
+			}
+		})
+	}
+}
+
+func TestPrunePlanKeepTag(t *testing.T) {
+	name := "goku"
+	status := StatusAvailable
+	snapshots := []string{"goku-20180201000000", "goku-20180101000000"}
+	DBSnapshots := []*rds.DBSnapshot{}
+	for i := range snapshots {
+		DBSnapshots = append(DBSnapshots, &rds.DBSnapshot{
+			DBInstanceIdentifier: &name,
+			DBSnapshotIdentifier: &snapshots[i],
+			Status:               &status,
+		})
+	}
+
+	svc := mockRdsSvc{
+		DescribeDBSnapshotsOutput: &rds.DescribeDBSnapshotsOutput{
+			DBSnapshots: DBSnapshots,
 		},
-		{
-			desc: "Valid size with symbols", size: 8, allowed: "!@#$%", expected: "@@@%@#@@",
+		ListTagsForResourceOutput: &rds.ListTagsForResourceOutput{
+			TagList: []*rds.Tag{
+				{Key: aws.String("dfm:keep"), Value: aws.String("")},
+			},
 		},
 	}
+	rds := NewManager(svc)
 
-	for _, tC := range testCases {
+	plan, err := rds.PrunePlan(PrunePolicy{KeepLast: 1, KeepTag: "dfm:keep"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	for _, action := range plan {
+		if action.Delete {
+			t.Errorf("Expected tagged snapshot %s to be kept", *action.Snapshot.Name)
+		}
+	}
+
+	if _, err := rds.PrunePlan(PrunePolicy{}); err != errPrunePolicyEmpty {
+		t.Errorf("Expected error to be %v, got %v", errPrunePolicyEmpty, err)
+	}
+}
+
+func TestClone(t *testing.T) {
+	source := "goku"
+	class := "db.m4.large"
+	subnet := "capsule-corp"
+	sg := "sg-1"
+	var cases = []struct {
+		desc, snapshot string
+	}{
+		{desc: "Point In Time"},
+		{desc: "Snapshot", snapshot: "goku-clone-goten-20180101000000"},
+	}
+
+	for _, tC := range cases {
 		t.Run(tC.desc, func(t *testing.T) {
-			got := generateRandomString(tC.size, tC.allowed, mockClock{})
-			if got != tC.expected {
-				t.Errorf("expected string to be %v, got %v", tC.expected, got)
+			pitr := &rds.RestoreDBInstanceToPointInTimeInput{}
+			restore := &rds.RestoreDBInstanceFromDBSnapshotInput{}
+			svc := mockRdsSvc{
+				DescribeDBInstancesOutput: &rds.DescribeDBInstancesOutput{
+					DBInstances: []*rds.DBInstance{
+						{
+							DBInstanceIdentifier: &source,
+							DBInstanceClass:      &class,
+							DBSubnetGroup:        &rds.DBSubnetGroup{DBSubnetGroupName: &subnet},
+							VpcSecurityGroups:    []*rds.VpcSecurityGroupMembership{{VpcSecurityGroupId: &sg}},
+						},
+					},
+				},
+				RestoreDBInstanceFromDBSnapshotOutput: &rds.RestoreDBInstanceFromDBSnapshotOutput{
+					DBInstance: &rds.DBInstance{DBInstanceIdentifier: aws.String("goten")},
+				},
+				RestoreDBInstanceFromDBSnapshotInput: restore,
+				RestoreDBInstanceToPointInTimeInput:  pitr,
+			}
+			rds := NewManager(svc)
+
+			db, err := rds.Clone(source, "goten", CloneOptions{Snapshot: tC.snapshot, TTL: time.Hour})
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if *db.Name != "goten" {
+				t.Errorf("Expected db name to be goten, got %v", *db.Name)
+			}
+
+			var gotClass, gotSubnet *string
+			var gotGroups []*string
+			var gotMultiAZ *bool
+			if tC.snapshot == "" {
+				gotClass, gotSubnet, gotGroups, gotMultiAZ = pitr.DBInstanceClass, pitr.DBSubnetGroupName, pitr.VpcSecurityGroupIds, pitr.MultiAZ
+				if !aws.BoolValue(pitr.UseLatestRestorableTime) {
+					t.Errorf("Expected restore to latest restorable time")
+				}
+			} else {
+				gotClass, gotSubnet, gotGroups, gotMultiAZ = restore.DBInstanceClass, restore.DBSubnetGroupName, restore.VpcSecurityGroupIds, restore.MultiAZ
+				if aws.StringValue(restore.DBSnapshotIdentifier) != tC.snapshot {
+					t.Errorf("Expected restore from %v, got %v", tC.snapshot, aws.StringValue(restore.DBSnapshotIdentifier))
+				}
+			}
+			if aws.StringValue(gotClass) != class {
+				t.Errorf("Expected instance class %v, got %v", class, aws.StringValue(gotClass))
+			}
+			if aws.StringValue(gotSubnet) != subnet {
+				t.Errorf("Expected subnet group %v, got %v", subnet, aws.StringValue(gotSubnet))
+			}
+			if len(gotGroups) != 1 || *gotGroups[0] != sg {
+				t.Errorf("Expected security groups [%v], got %v", sg, aws.StringValueSlice(gotGroups))
+			}
+			if aws.BoolValue(gotMultiAZ) {
+				t.Errorf("Expected development clone not to be MultiAZ")
+			}
+		})
+	}
+}
+
+func TestCloneTags(t *testing.T) {
+	tags := cloneTags("goku", 48*time.Hour, mockClock{})
+	expected := map[string]string{
+		TagCloneOf: "goku",
+		TagExpires: "1970-01-04T10:17:36Z",
+	}
+	if len(tags) != len(expected) {
+		t.Fatalf("Expected %d tags, got %d", len(expected), len(tags))
+	}
+	for _, tag := range tags {
+		if expected[*tag.Key] != *tag.Value {
+			t.Errorf("Expected tag %s to be %v, got %v", *tag.Key, expected[*tag.Key], *tag.Value)
+		}
+	}
+}
+
+func TestRotateMasterPassword(t *testing.T) {
+	var cases = []struct {
+		desc, password string
+		err            error
+	}{
+		{desc: "Happy Path", password: "kamehameha"},
+		{desc: "Empty Password", password: "", err: errDbMasterUserPasswordMissing},
+		{desc: "Sad Path", password: "kamehameha", err: fmt.Errorf("Goku Error")},
+	}
+
+	for _, tC := range cases {
+		t.Run(tC.desc, func(t *testing.T) {
+			input := &rds.ModifyDBInstanceInput{}
+			svc := mockRdsSvc{
+				ModifyDBInstanceInput: input,
+				err:                   tC.err,
+			}
+			rds := NewManager(svc)
+
+			db, err := rds.RotateMasterPassword("krillin", tC.password)
+			if err != tC.err {
+				t.Fatalf("Expected error to be %v, got %v", tC.err, err)
+			}
+			if err != nil {
+				return
+			}
+			if *db.Name != "krillin" {
+				t.Errorf("Expected db name to be krillin, got %v", *db.Name)
+			}
+			if aws.StringValue(input.MasterUserPassword) != tC.password {
+				t.Errorf("Expected master password to be %v, got %v", tC.password, aws.StringValue(input.MasterUserPassword))
+			}
+			if !aws.BoolValue(input.ApplyImmediately) {
+				t.Errorf("Expected master password to be applied immediately")
 			}
 		})
 	}
@@ -276,12 +659,22 @@ func TestGenerateRandomString(t *testing.T) {
 
 type mockRdsSvc struct {
 	rdsiface.RDSAPI
-	CreateDBInstanceOutput    *rds.CreateDBInstanceOutput
-	CreateMasterUsername      *string
-	CreateMasterPassword      *string
-	DeleteDBInstanceOutput    *rds.DeleteDBInstanceOutput
-	DescribeDBInstancesOutput *rds.DescribeDBInstancesOutput
-	err                       error
+	CreateDBInstanceOutput                *rds.CreateDBInstanceOutput
+	CreateMasterUsername                  *string
+	CreateMasterPassword                  *string
+	DeleteDBInstanceOutput                *rds.DeleteDBInstanceOutput
+	DescribeDBInstancesOutput             *rds.DescribeDBInstancesOutput
+	DescribeDBSnapshotsOutput             *rds.DescribeDBSnapshotsOutput
+	ListTagsForResourceOutput             *rds.ListTagsForResourceOutput
+	RestoreDBInstanceFromDBSnapshotOutput *rds.RestoreDBInstanceFromDBSnapshotOutput
+	RestoreDBInstanceFromDBSnapshotInput  *rds.RestoreDBInstanceFromDBSnapshotInput
+	RestoreDBInstanceToPointInTimeInput   *rds.RestoreDBInstanceToPointInTimeInput
+	ModifyDBInstanceInput                 *rds.ModifyDBInstanceInput
+	// DescribeDBInstancesSequence is returned one output per call when set, repeating the last
+	DescribeDBInstancesSequence []*rds.DescribeDBInstancesOutput
+	// calls records the calls made, when set
+	calls *[]string
+	err   error
 }
 
 func (m mockRdsSvc) CreateDBInstance(input *rds.CreateDBInstanceInput) (*rds.CreateDBInstanceOutput, error) {
@@ -291,13 +684,82 @@ func (m mockRdsSvc) CreateDBInstance(input *rds.CreateDBInstanceInput) (*rds.Cre
 }
 
 func (m mockRdsSvc) DeleteDBInstance(input *rds.DeleteDBInstanceInput) (*rds.DeleteDBInstanceOutput, error) {
+	if m.calls != nil {
+		*m.calls = append(*m.calls, "delete")
+	}
 	return m.DeleteDBInstanceOutput, m.err
 }
 
 func (m mockRdsSvc) DescribeDBInstances(input *rds.DescribeDBInstancesInput) (*rds.DescribeDBInstancesOutput, error) {
+	if len(m.DescribeDBInstancesSequence) > 0 {
+		n := 0
+		for _, c := range *m.calls {
+			if c == "describe" {
+				n++
+			}
+		}
+		*m.calls = append(*m.calls, "describe")
+		if n >= len(m.DescribeDBInstancesSequence) {
+			n = len(m.DescribeDBInstancesSequence) - 1
+		}
+		return m.DescribeDBInstancesSequence[n], m.err
+	}
 	return m.DescribeDBInstancesOutput, m.err
 }
 
+func (m mockRdsSvc) AddTagsToResource(input *rds.AddTagsToResourceInput) (*rds.AddTagsToResourceOutput, error) {
+	return &rds.AddTagsToResourceOutput{}, m.err
+}
+
+func (m mockRdsSvc) DescribeDBSnapshotsPages(input *rds.DescribeDBSnapshotsInput, fn func(*rds.DescribeDBSnapshotsOutput, bool) bool) error {
+	if m.err != nil {
+		return m.err
+	}
+	fn(m.DescribeDBSnapshotsOutput, true)
+	return nil
+}
+
+func (m mockRdsSvc) RestoreDBInstanceToPointInTime(input *rds.RestoreDBInstanceToPointInTimeInput) (*rds.RestoreDBInstanceToPointInTimeOutput, error) {
+	if m.RestoreDBInstanceToPointInTimeInput != nil {
+		*m.RestoreDBInstanceToPointInTimeInput = *input
+	}
+	return &rds.RestoreDBInstanceToPointInTimeOutput{
+		DBInstance: &rds.DBInstance{
+			DBInstanceIdentifier: input.TargetDBInstanceIdentifier,
+		},
+	}, m.err
+}
+
+func (m mockRdsSvc) ModifyDBInstance(input *rds.ModifyDBInstanceInput) (*rds.ModifyDBInstanceOutput, error) {
+	if m.ModifyDBInstanceInput != nil {
+		*m.ModifyDBInstanceInput = *input
+	}
+	return &rds.ModifyDBInstanceOutput{
+		DBInstance: &rds.DBInstance{
+			DBInstanceIdentifier: input.DBInstanceIdentifier,
+		},
+	}, m.err
+}
+
+func (m mockRdsSvc) DeleteDBSnapshot(input *rds.DeleteDBSnapshotInput) (*rds.DeleteDBSnapshotOutput, error) {
+	return &rds.DeleteDBSnapshotOutput{
+		DBSnapshot: &rds.DBSnapshot{
+			DBSnapshotIdentifier: input.DBSnapshotIdentifier,
+		},
+	}, m.err
+}
+
+func (m mockRdsSvc) ListTagsForResource(input *rds.ListTagsForResourceInput) (*rds.ListTagsForResourceOutput, error) {
+	return m.ListTagsForResourceOutput, m.err
+}
+
+func (m mockRdsSvc) RestoreDBInstanceFromDBSnapshot(input *rds.RestoreDBInstanceFromDBSnapshotInput) (*rds.RestoreDBInstanceFromDBSnapshotOutput, error) {
+	if m.RestoreDBInstanceFromDBSnapshotInput != nil {
+		*m.RestoreDBInstanceFromDBSnapshotInput = *input
+	}
+	return m.RestoreDBInstanceFromDBSnapshotOutput, m.err
+}
+
 // mocked clock
 type mockClock struct{}
 
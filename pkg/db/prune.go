@@ -0,0 +1,102 @@
+package db
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+var (
+	errPrunePolicyEmpty = fmt.Errorf("error: prune policy needs a keep last count or a max age")
+)
+
+// PrunePolicy describes which final snapshots are retained.
+// The newest KeepLast snapshots of every instance are always kept, older ones
+// are deleted once they exceed MaxAge, or straight away when MaxAge is zero.
+// Snapshots carrying the KeepTag tag key are never deleted.
+type PrunePolicy struct {
+	KeepLast int
+	MaxAge   time.Duration
+	KeepTag  string
+}
+
+// PruneAction is the planned outcome for a single snapshot
+type PruneAction struct {
+	Snapshot *Snapshot
+	Delete   bool
+	Reason   string
+}
+
+// String representation of PruneAction
+func (a *PruneAction) String() string {
+	action := "keep"
+	if a.Delete {
+		action = "delete"
+	}
+	return fmt.Sprintf("%s\t%s\t%s\t%s", action, *a.Snapshot.InstanceName, *a.Snapshot.Name, a.Reason)
+}
+
+// PrunePlan lists every final snapshot taken by Delete and decides whether the policy keeps it
+func (r *Manager) PrunePlan(policy PrunePolicy) ([]*PruneAction, error) {
+	if policy.KeepLast <= 0 && policy.MaxAge <= 0 {
+		return nil, errPrunePolicyEmpty
+	}
+
+	snapshots, err := r.ListAllFinalSnapshots()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := planPrune(snapshots, policy, actualClock{})
+	if policy.KeepTag == "" {
+		return plan, nil
+	}
+
+	for _, action := range plan {
+		if !action.Delete {
+			continue
+		}
+		action.Snapshot.Tags, err = r.ListSnapshotTags(action.Snapshot)
+		if err != nil {
+			return nil, err
+		}
+		for _, t := range action.Snapshot.Tags {
+			if aws.StringValue(t.Key) == policy.KeepTag {
+				action.Delete = false
+				action.Reason = fmt.Sprintf("tagged %s", policy.KeepTag)
+			}
+		}
+	}
+	return plan, nil
+}
+
+// planPrune applies the count and age rules of policy to snapshots, which must be sorted newest first
+func planPrune(snapshots []*Snapshot, policy PrunePolicy, t clock) []*PruneAction {
+	now := t.Now()
+	seen := map[string]int{}
+	plan := make([]*PruneAction, 0, len(snapshots))
+	for _, s := range snapshots {
+		action := &PruneAction{Snapshot: s}
+		plan = append(plan, action)
+
+		instance := aws.StringValue(s.InstanceName)
+		seen[instance]++
+
+		switch {
+		case aws.StringValue(s.Status) != StatusAvailable:
+			action.Reason = fmt.Sprintf("snapshot is %s", aws.StringValue(s.Status))
+		case seen[instance] <= policy.KeepLast:
+			action.Reason = fmt.Sprintf("within last %d", policy.KeepLast)
+		case policy.MaxAge <= 0:
+			action.Delete = true
+			action.Reason = fmt.Sprintf("beyond last %d", policy.KeepLast)
+		case s.CreateTime != nil && now.Sub(*s.CreateTime) > policy.MaxAge:
+			action.Delete = true
+			action.Reason = fmt.Sprintf("older than %v", policy.MaxAge)
+		default:
+			action.Reason = fmt.Sprintf("younger than %v", policy.MaxAge)
+		}
+	}
+	return plan
+}
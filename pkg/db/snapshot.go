@@ -0,0 +1,226 @@
+package db
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/rds"
+)
+
+const (
+	// finalSnapshotTimeFormat is the timestamp suffix Delete appends to final snapshot names
+	finalSnapshotTimeFormat = "20060102150405"
+
+	// TagInstanceClass records the instance class of a deleted instance on its final snapshot
+	TagInstanceClass = "dfm:instance-class"
+	// TagSubnetGroup records the subnet group of a deleted instance on its final snapshot
+	TagSubnetGroup = "dfm:subnet-group"
+	// TagSecurityGroups records the space separated vpc security group ids of a deleted instance on its final snapshot
+	TagSecurityGroups = "dfm:security-groups"
+)
+
+var (
+	finalSnapshotSuffix = regexp.MustCompile(`^-[0-9]{14}$`)
+
+	errNoFinalSnapshot = fmt.Errorf("error: no final snapshot found")
+)
+
+// Snapshot DB Snapshot Type
+type Snapshot struct {
+	Name         *string
+	ARN          *string
+	InstanceName *string
+	Status       *string
+	Type         *string
+	CreateTime   *time.Time
+	Tags         []*Tag
+}
+
+// FromDBSnapshot converts an *rds.DBSnapshot type to *Snapshot type
+func FromDBSnapshot(s *rds.DBSnapshot) *Snapshot {
+	return &Snapshot{
+		Name:         s.DBSnapshotIdentifier,
+		ARN:          s.DBSnapshotArn,
+		InstanceName: s.DBInstanceIdentifier,
+		Status:       s.Status,
+		Type:         s.SnapshotType,
+		CreateTime:   s.SnapshotCreateTime,
+	}
+}
+
+// FromDBSnapshots converts a slice of *rds.DBSnapshot to a slice of *Snapshot
+func FromDBSnapshots(s []*rds.DBSnapshot) []*Snapshot {
+	var snapshots []*Snapshot
+	for _, snapshot := range s {
+		snapshots = append(snapshots, FromDBSnapshot(snapshot))
+	}
+	return snapshots
+}
+
+// String representation of Snapshot
+func (s *Snapshot) String() string {
+	return fmt.Sprintf("name: %s, arn: %s", *s.Name, *s.ARN)
+}
+
+// TagValue returns the value of the tag with the given key, or an empty string
+func (s *Snapshot) TagValue(key string) string {
+	for _, t := range s.Tags {
+		if aws.StringValue(t.Key) == key {
+			return aws.StringValue(t.Value)
+		}
+	}
+	return ""
+}
+
+// finalSnapshotName returns the name Delete gives the final snapshot of an instance
+func finalSnapshotName(name string, t time.Time) string {
+	return fmt.Sprintf("%s-%s", name, t.Format(finalSnapshotTimeFormat))
+}
+
+// IsFinalSnapshot reports whether snapshot follows the final snapshot naming convention for instance name
+func IsFinalSnapshot(name, snapshot string) bool {
+	if !strings.HasPrefix(snapshot, name) {
+		return false
+	}
+	return finalSnapshotSuffix.MatchString(strings.TrimPrefix(snapshot, name))
+}
+
+// restoreTags returns the tags recording how to recreate db once it is deleted
+func restoreTags(db *DB) []*rds.Tag {
+	tags := make([]*rds.Tag, 0, 3)
+	if db.DBInstanceClass != nil {
+		tags = append(tags, &rds.Tag{Key: aws.String(TagInstanceClass), Value: db.DBInstanceClass})
+	}
+	if db.SubnetGroupName != nil {
+		tags = append(tags, &rds.Tag{Key: aws.String(TagSubnetGroup), Value: db.SubnetGroupName})
+	}
+	if len(db.SecurityGroups) > 0 {
+		groups := strings.Join(aws.StringValueSlice(db.SecurityGroups), " ")
+		tags = append(tags, &rds.Tag{Key: aws.String(TagSecurityGroups), Value: aws.String(groups)})
+	}
+	return tags
+}
+
+// ListFinalSnapshots returns the final snapshots taken by Delete for the named instance, newest first
+func (r *Manager) ListFinalSnapshots(name string) ([]*Snapshot, error) {
+	return r.listFinalSnapshots(&rds.DescribeDBSnapshotsInput{
+		DBInstanceIdentifier: aws.String(name),
+		SnapshotType:         aws.String("manual"),
+	})
+}
+
+// ListAllFinalSnapshots returns the final snapshots taken by Delete for every instance, newest first
+func (r *Manager) ListAllFinalSnapshots() ([]*Snapshot, error) {
+	return r.listFinalSnapshots(&rds.DescribeDBSnapshotsInput{
+		SnapshotType: aws.String("manual"),
+	})
+}
+
+func (r *Manager) listFinalSnapshots(input *rds.DescribeDBSnapshotsInput) ([]*Snapshot, error) {
+	var snapshots []*Snapshot
+	err := r.Client.DescribeDBSnapshotsPages(input, func(page *rds.DescribeDBSnapshotsOutput, last bool) bool {
+		for _, s := range page.DBSnapshots {
+			if IsFinalSnapshot(aws.StringValue(s.DBInstanceIdentifier), aws.StringValue(s.DBSnapshotIdentifier)) {
+				snapshots = append(snapshots, FromDBSnapshot(s))
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the name suffix sorts in creation order and is set even while the snapshot is still being created
+	sort.Slice(snapshots, func(i, j int) bool {
+		return *snapshots[i].Name > *snapshots[j].Name
+	})
+	return snapshots, nil
+}
+
+// ListSnapshotTags returns the tags of a snapshot
+func (r *Manager) ListSnapshotTags(snapshot *Snapshot) ([]*Tag, error) {
+	result, err := r.Client.ListTagsForResource(&rds.ListTagsForResourceInput{
+		ResourceName: snapshot.ARN,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return fromRDSTags(result.TagList), nil
+}
+
+// DeleteSnapshot deletes the named manual snapshot
+func (r *Manager) DeleteSnapshot(name string) (*Snapshot, error) {
+	result, err := r.Client.DeleteDBSnapshot(&rds.DeleteDBSnapshotInput{
+		DBSnapshotIdentifier: aws.String(name),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return FromDBSnapshot(result.DBSnapshot), nil
+}
+
+// LatestFinalSnapshot returns the most recent final snapshot of the named instance along with its tags
+func (r *Manager) LatestFinalSnapshot(name string) (*Snapshot, error) {
+	snapshots, err := r.ListFinalSnapshots(name)
+	if err != nil {
+		return nil, err
+	}
+	if len(snapshots) == 0 {
+		return nil, errNoFinalSnapshot
+	}
+
+	snapshot := snapshots[0]
+	snapshot.Tags, err = r.ListSnapshotTags(snapshot)
+	if err != nil {
+		return nil, err
+	}
+	return snapshot, nil
+}
+
+// Undelete recreates a deleted RDS Instance from its most recent final snapshot
+func (r *Manager) Undelete(name string) (*DB, *Snapshot, error) {
+	snapshot, err := r.LatestFinalSnapshot(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if aws.StringValue(snapshot.Status) != StatusAvailable {
+		return nil, snapshot, fmt.Errorf("error: snapshot %s is %s", *snapshot.Name, aws.StringValue(snapshot.Status))
+	}
+	// without them the instance would be restored into the default subnet group and security groups
+	for _, key := range []string{TagInstanceClass, TagSubnetGroup, TagSecurityGroups} {
+		if snapshot.TagValue(key) == "" {
+			return nil, snapshot, fmt.Errorf("error: snapshot %s has no %s tag", *snapshot.Name, key)
+		}
+	}
+
+	input := &rds.RestoreDBInstanceFromDBSnapshotInput{
+		DBInstanceIdentifier: aws.String(name),
+		DBSnapshotIdentifier: snapshot.Name,
+		CopyTagsToSnapshot:   aws.Bool(true),
+	}
+	if class := snapshot.TagValue(TagInstanceClass); class != "" {
+		input.DBInstanceClass = aws.String(class)
+	}
+	if subnet := snapshot.TagValue(TagSubnetGroup); subnet != "" {
+		input.DBSubnetGroupName = aws.String(subnet)
+	}
+	if groups := snapshot.TagValue(TagSecurityGroups); groups != "" {
+		input.VpcSecurityGroupIds = aws.StringSlice(strings.Fields(groups))
+	}
+	for _, t := range snapshot.Tags {
+		if !strings.HasPrefix(aws.StringValue(t.Key), "dfm:") {
+			input.Tags = append(input.Tags, &rds.Tag{Key: t.Key, Value: t.Value})
+		}
+	}
+
+	result, err := r.Client.RestoreDBInstanceFromDBSnapshot(input)
+	if err != nil {
+		return nil, snapshot, err
+	}
+
+	return FromDBInstance(result.DBInstance), snapshot, nil
+}
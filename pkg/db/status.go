@@ -29,6 +29,8 @@ var (
 	StatusRenaming = "renaming"
 	// StatusMaintenance is an RDS maintenance status
 	StatusMaintenance = "maintenance"
+	// StatusResettingMasterCredentials is an RDS resetting-master-credentials status
+	StatusResettingMasterCredentials = "resetting-master-credentials"
 	// StatusConfiguringEnhancedMonitoring is an RDS configuring-enhanced-monitoring status
 	StatusConfiguringEnhancedMonitoring = "configuring-enhanced-monitoring"
 	// StatusStorageFull is an RDS storage full critical status
@@ -47,16 +49,17 @@ func init() {
 		StatusStopped:   true,
 	}
 	TransitioningStates = map[string]bool{
-		StatusCreating:    true,
-		StatusDeleting:    true,
-		StatusBackingUp:   true,
-		StatusModifying:   true,
-		StatusStarting:    true,
-		StatusStopping:    true,
-		StatusUpgrading:   true,
-		StatusRebooting:   true,
-		StatusRenaming:    true,
-		StatusMaintenance: true,
+		StatusCreating:                   true,
+		StatusDeleting:                   true,
+		StatusBackingUp:                  true,
+		StatusModifying:                  true,
+		StatusStarting:                   true,
+		StatusStopping:                   true,
+		StatusUpgrading:                  true,
+		StatusRebooting:                  true,
+		StatusRenaming:                   true,
+		StatusMaintenance:                true,
+		StatusResettingMasterCredentials: true,
 	}
 
 }
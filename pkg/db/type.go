@@ -94,6 +94,9 @@ func FromDBInstance(r *rds.DBInstance) *DB {
 	if r.Endpoint != nil && r.Endpoint.Port != nil {
 		db.Port = r.Endpoint.Port
 	}
+	for _, sg := range r.VpcSecurityGroups {
+		db.SecurityGroups = append(db.SecurityGroups, sg.VpcSecurityGroupId)
+	}
 	return db
 }
 
@@ -106,6 +109,18 @@ func FromDBInstances(r []*rds.DBInstance) []*DB {
 	return DBs
 }
 
+// fromRDSTags converts a slice of *rds.Tag to a slice of *Tag
+func fromRDSTags(r []*rds.Tag) []*Tag {
+	var tags []*Tag
+	for _, t := range r {
+		tags = append(tags, &Tag{
+			Key:   t.Key,
+			Value: t.Value,
+		})
+	}
+	return tags
+}
+
 // String representation of DB
 func (d *DB) String() string {
 	return fmt.Sprintf("name: %s, arn: %s", *d.Name, *d.ARN)
@@ -131,3 +131,24 @@ func TestString(t *testing.T) {
 		t.Errorf("Expected DB stringer to be '%v', got '%v'", expected, got)
 	}
 }
+
+func TestIsProduction(t *testing.T) {
+	testCases := []struct {
+		key, value string
+		production bool
+	}{
+		{"environment", "production", true},
+		{"Environment", "Prod", true},
+		{"env", "PRODUCTION", true},
+		{"environment", "staging", false},
+		{"team", "production", false},
+	}
+	for _, tC := range testCases {
+		t.Run(tC.key+"="+tC.value, func(t *testing.T) {
+			tags := []*db.Tag{{Key: &tC.key, Value: &tC.value}}
+			if got := db.IsProduction(tags); got != tC.production {
+				t.Errorf("Expected %v got %v", tC.production, got)
+			}
+		})
+	}
+}
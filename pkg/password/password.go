@@ -0,0 +1,217 @@
+// Package password generates and validates passwords for RDS master users and
+// PostgreSQL database users using crypto/rand.
+//
+// Example:
+// p, err := password.ForEngine("postgres").Generate()
+package password
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+	"unicode"
+)
+
+const (
+	// Lower are the lowercase letters
+	Lower = "abcdefghijklmnopqrstuvwxyz"
+	// Upper are the uppercase letters
+	Upper = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	// Digits are the decimal digits
+	Digits = "0123456789"
+
+	// rdsForbidden are rejected in master passwords by every RDS engine
+	rdsForbidden = "/@\" "
+)
+
+// Policy describes the length, alphabet and complexity of a password.
+type Policy struct {
+	// Length of generated passwords
+	Length int
+	// MinLength and MaxLength bound accepted passwords, 0 for no bound
+	MinLength int
+	MaxLength int
+	// Symbols are generated alongside letters and digits
+	Symbols string
+	// Forbidden characters are never generated nor accepted
+	Forbidden string
+	// Minimum number of each character class
+	MinLower   int
+	MinUpper   int
+	MinDigits  int
+	MinSymbols int
+}
+
+var (
+	// RDS is the master password policy accepted by every RDS engine.
+	RDS = Policy{
+		Length:     30,
+		MinLength:  8,
+		MaxLength:  41,
+		Symbols:    "!#$%^&*()-+=",
+		Forbidden:  rdsForbidden,
+		MinLower:   1,
+		MinUpper:   1,
+		MinDigits:  1,
+		MinSymbols: 1,
+	}
+
+	// Postgres is the policy for database users created in PostgreSQL. Symbols are
+	// limited to those that need no escaping in URLs.
+	Postgres = Policy{
+		Length:     30,
+		MinLength:  16,
+		Symbols:    "$.+!*(),_-",
+		Forbidden:  rdsForbidden,
+		MinLower:   1,
+		MinUpper:   1,
+		MinDigits:  1,
+		MinSymbols: 1,
+	}
+
+	// engineMaxLength is the longest master password accepted by each RDS engine
+	engineMaxLength = map[string]int{
+		"aurora":            41,
+		"aurora-mysql":      41,
+		"aurora-postgresql": 128,
+		"mariadb":           41,
+		"mysql":             41,
+		"oracle":            30,
+		"postgres":          128,
+		"sqlserver":         128,
+	}
+)
+
+// ForEngine returns the master password policy for an RDS engine such as
+// postgres, mysql or oracle-ee. Unknown engines get the RDS policy.
+func ForEngine(engine string) Policy {
+	p := RDS
+	family := engine
+	if i := strings.Index(engine, "-"); i > 0 && !strings.HasPrefix(engine, "aurora") {
+		family = engine[:i]
+	}
+	if max, ok := engineMaxLength[family]; ok {
+		p.MaxLength = max
+	}
+	if p.Length > p.MaxLength {
+		p.Length = p.MaxLength
+	}
+	return p
+}
+
+// WithLength returns a copy of the policy generating passwords of length n.
+func (p Policy) WithLength(n int) Policy {
+	p.Length = n
+	return p
+}
+
+// Generate returns a random password satisfying the policy.
+func (p Policy) Generate() (string, error) {
+	if err := p.check(); err != nil {
+		return "", err
+	}
+	alphabet := p.alphabet()
+	for {
+		s, err := Random(p.Length, alphabet)
+		if err != nil {
+			return "", err
+		}
+		if p.meetsComplexity(s) {
+			return s, nil
+		}
+	}
+}
+
+// Validate checks that a supplied password satisfies the policy.
+func (p Policy) Validate(s string) error {
+	if p.MinLength > 0 && len(s) < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters", p.MinLength)
+	}
+	if p.MaxLength > 0 && len(s) > p.MaxLength {
+		return fmt.Errorf("password must be at most %d characters", p.MaxLength)
+	}
+	for _, r := range s {
+		if r > unicode.MaxASCII || !unicode.IsPrint(r) {
+			return fmt.Errorf("password must only contain printable ASCII characters")
+		}
+		if strings.ContainsRune(p.Forbidden, r) {
+			return fmt.Errorf("password must not contain any of %q", p.Forbidden)
+		}
+	}
+	if !p.meetsComplexity(s) {
+		return fmt.Errorf("password needs at least %d lowercase, %d uppercase, %d digit and %d symbol characters",
+			p.MinLower, p.MinUpper, p.MinDigits, p.MinSymbols)
+	}
+	return nil
+}
+
+// Random returns a string of length n drawn uniformly from alphabet.
+func Random(n int, alphabet string) (string, error) {
+	if n > 0 && len(alphabet) == 0 {
+		return "", fmt.Errorf("generate password: empty alphabet")
+	}
+	max := big.NewInt(int64(len(alphabet)))
+	b := make([]byte, n)
+	for i := range b {
+		j, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", fmt.Errorf("generate password: %v", err)
+		}
+		b[i] = alphabet[j.Int64()]
+	}
+	return string(b), nil
+}
+
+// alphabet returns the characters generated passwords are drawn from
+func (p Policy) alphabet() string {
+	return p.allowed(Lower + Upper + Digits + p.Symbols)
+}
+
+// allowed strips the forbidden characters from chars
+func (p Policy) allowed(chars string) string {
+	return strings.Map(func(r rune) rune {
+		if strings.ContainsRune(p.Forbidden, r) {
+			return -1
+		}
+		return r
+	}, chars)
+}
+
+// check reports policies that no password can satisfy
+func (p Policy) check() error {
+	if p.Length <= 0 {
+		return fmt.Errorf("password length must be positive")
+	}
+	if p.MinLength > 0 && p.Length < p.MinLength {
+		return fmt.Errorf("password length %d is below the minimum of %d", p.Length, p.MinLength)
+	}
+	if p.MaxLength > 0 && p.Length > p.MaxLength {
+		return fmt.Errorf("password length %d is above the maximum of %d", p.Length, p.MaxLength)
+	}
+	if p.MinLower+p.MinUpper+p.MinDigits+p.MinSymbols > p.Length {
+		return fmt.Errorf("password length %d is too short for the complexity requirements", p.Length)
+	}
+	if p.MinSymbols > 0 && len(p.allowed(p.Symbols)) == 0 {
+		return fmt.Errorf("password policy requires symbols but allows none")
+	}
+	return nil
+}
+
+// meetsComplexity reports whether s has the minimum number of each character class
+func (p Policy) meetsComplexity(s string) bool {
+	var lower, upper, digits, symbols int
+	for _, r := range s {
+		switch {
+		case strings.ContainsRune(Lower, r):
+			lower++
+		case strings.ContainsRune(Upper, r):
+			upper++
+		case strings.ContainsRune(Digits, r):
+			digits++
+		default:
+			symbols++
+		}
+	}
+	return lower >= p.MinLower && upper >= p.MinUpper && digits >= p.MinDigits && symbols >= p.MinSymbols
+}
@@ -0,0 +1,134 @@
+package password
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		policy Policy
+		length int
+	}{
+		{desc: "RDS", policy: RDS, length: 30},
+		{desc: "Postgres", policy: Postgres, length: 30},
+		{desc: "Oracle", policy: ForEngine("oracle-ee"), length: 30},
+		{desc: "Postgres Short", policy: Postgres.WithLength(16), length: 16},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			seen := map[string]bool{}
+			for i := 0; i < 200; i++ {
+				p, err := tC.policy.Generate()
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+				if len(p) != tC.length {
+					t.Fatalf("Expected length %d, got %d: %q", tC.length, len(p), p)
+				}
+				if strings.ContainsAny(p, rdsForbidden) {
+					t.Fatalf("Expected no forbidden characters, got %q", p)
+				}
+				if err := tC.policy.Validate(p); err != nil {
+					t.Fatalf("Expected %q to be valid, got %v", p, err)
+				}
+				if seen[p] {
+					t.Fatalf("Expected unique passwords, got %q twice", p)
+				}
+				seen[p] = true
+			}
+		})
+	}
+}
+
+func TestGenerateInvalidPolicy(t *testing.T) {
+	testCases := []struct {
+		desc   string
+		policy Policy
+	}{
+		{desc: "Zero Length", policy: RDS.WithLength(0)},
+		{desc: "Below Minimum", policy: RDS.WithLength(6)},
+		{desc: "Above Maximum", policy: ForEngine("mysql").WithLength(42)},
+		{desc: "Too Complex", policy: Policy{Length: 3, MinLower: 1, MinUpper: 1, MinDigits: 1, MinSymbols: 1, Symbols: "!"}},
+		{desc: "Forbidden Symbols", policy: Policy{Length: 10, MinSymbols: 1, Symbols: "/@", Forbidden: rdsForbidden}},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if p, err := tC.policy.Generate(); err == nil {
+				t.Errorf("Expected an error, got password %q", p)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	testCases := []struct {
+		desc, password string
+		valid          bool
+	}{
+		{desc: "Valid", password: "Kamehameha-9000", valid: true},
+		{desc: "Too Short", password: "Ka-9", valid: false},
+		{desc: "Too Long", password: "Kamehameha-9000" + strings.Repeat("a", 40), valid: false},
+		{desc: "Slash", password: "Kameha/meha-9000", valid: false},
+		{desc: "At", password: "Kameha@meha-9000", valid: false},
+		{desc: "Double Quote", password: "Kameha\"meha-9000", valid: false},
+		{desc: "Space", password: "Kameha meha-9000", valid: false},
+		{desc: "Non ASCII", password: "Kamehaméha-9000", valid: false},
+		{desc: "No Digits", password: "Kamehameha-nine", valid: false},
+		{desc: "No Symbols", password: "Kamehameha9000", valid: false},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			err := RDS.Validate(tC.password)
+			if (err == nil) != tC.valid {
+				t.Errorf("Expected valid to be %v, got %v", tC.valid, err)
+			}
+		})
+	}
+}
+
+func TestForEngine(t *testing.T) {
+	testCases := []struct {
+		engine         string
+		length, maxLen int
+	}{
+		{engine: "postgres", length: 30, maxLen: 128},
+		{engine: "aurora-postgresql", length: 30, maxLen: 128},
+		{engine: "mysql", length: 30, maxLen: 41},
+		{engine: "oracle-se2", length: 30, maxLen: 30},
+		{engine: "sqlserver-ex", length: 30, maxLen: 128},
+		{engine: "unknown", length: 30, maxLen: 41},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.engine, func(t *testing.T) {
+			p := ForEngine(tC.engine)
+			if p.Length != tC.length {
+				t.Errorf("Expected length %d, got %d", tC.length, p.Length)
+			}
+			if p.MaxLength != tC.maxLen {
+				t.Errorf("Expected max length %d, got %d", tC.maxLen, p.MaxLength)
+			}
+			if p.Forbidden != rdsForbidden {
+				t.Errorf("Expected forbidden characters %q, got %q", rdsForbidden, p.Forbidden)
+			}
+		})
+	}
+}
+
+func TestRandom(t *testing.T) {
+	p, err := Random(64, Lower)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if strings.Trim(p, Lower) != "" {
+		t.Errorf("Expected only lowercase letters, got %q", p)
+	}
+	if _, err := Random(1, ""); err == nil {
+		t.Errorf("Expected an error for an empty alphabet")
+	}
+}
@@ -0,0 +1,848 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// CopyOptions are the options of CopyDatabase.
+type CopyOptions struct {
+	// Schemas to copy, defaults to all but the system schemas
+	Schemas []string
+	// Owner is the role owning the copied objects, such as the admin group of
+	// a database created by CreateDatabase, and defaults to the target user.
+	// The target user is made a member of it while the copy runs.
+	Owner string
+	// Parallel is the number of tables copied at once, defaults to 4
+	Parallel int
+	// Progress is called with the rows copied of a table as it is copied, and
+	// once it is done, by one table at a time
+	Progress func(p *TableCopy)
+	// Mask masks the target with the rules once the rows are copied
+	Mask *MaskRules
+	// MaskOptions are the options of the masking
+	MaskOptions MaskOptions
+}
+
+// TableCopy is the progress of the copy of a table.
+type TableCopy struct {
+	Table string `json:"table"`
+	Rows  int64  `json:"rows"`
+	Done  bool   `json:"done"`
+}
+
+// copyProgressRows is the number of rows between reports of progress.
+const copyProgressRows = 100000
+
+// copyMinVersion is the server_version_num of PostgreSQL 12, the first with
+// all the catalog columns the schema of the source is read from.
+const copyMinVersion = 120000
+
+// CopyDatabase copies a database to a target database, connecting to the
+// source as the Conn user and to the target as the user of to. The schema
+// objects are recreated in the target: schemas, extensions, enum types,
+// sequences, functions, tables with their constraints and indexes, views,
+// materialized views, and triggers. The rows of each table are then streamed
+// with COPY, several tables at a time, from a single snapshot of the source,
+// and the row counts of both sides are checked. Domains, composite types,
+// partitioned tables, comments, and privileges are not copied.
+//
+// The target should be empty: objects that exist in it fail the copy before
+// any rows are copied. It returns the tables copied with their row counts.
+// The source must run PostgreSQL 12 or later.
+//
+// With Mask, the target is masked as MaskDatabase does, acting as the owner.
+// When the copy or the masking fails once rows are copied, the tables copied
+// are truncated so the target holds no unmasked rows.
+func (c *Conn) CopyDatabase(database string, to *Conn, target string, o CopyOptions) ([]*TableCopy, error) {
+	src, err := c.connect(database, c.User)
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	dst, err := to.connect(target, to.User)
+	if err != nil {
+		return nil, err
+	}
+	defer dst.Close()
+
+	return src.copyTo(dst, o)
+}
+
+func (c *Conn) copyTo(dst *Conn, o CopyOptions) ([]*TableCopy, error) {
+	ctx := context.Background()
+	if o.Parallel < 1 {
+		o.Parallel = 4
+	}
+	if o.Mask != nil {
+		if err := o.Mask.Validate(); err != nil {
+			return nil, err
+		}
+		if o.Mask.Salt == "" {
+			return nil, fmt.Errorf("mask rules need a salt")
+		}
+	}
+
+	var version int
+	if err := c.DB.QueryRow("SELECT current_setting('server_version_num')::int").Scan(&version); err != nil {
+		return nil, fmt.Errorf("find server version: %v", err)
+	}
+	if version < copyMinVersion {
+		return nil, fmt.Errorf("copy needs PostgreSQL 12 or later on the source, found server version %d", version)
+	}
+
+	// the source holds the snapshot and a transaction per table copied at
+	// once, the target a transaction per table
+	if n := c.Options.MaxOpenConns; n > 0 && n <= o.Parallel {
+		c.DB.SetMaxOpenConns(o.Parallel + 1)
+	}
+	if n := dst.Options.MaxOpenConns; n > 0 && n < o.Parallel {
+		dst.DB.SetMaxOpenConns(o.Parallel)
+	}
+
+	// the source is read in one snapshot, exported to the transactions
+	// copying the tables, and kept until they are done
+	tx, err := c.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	var snapshot string
+	if err := tx.QueryRow("SELECT pg_export_snapshot()").Scan(&snapshot); err != nil {
+		return nil, fmt.Errorf("export snapshot: %v", err)
+	}
+
+	s, err := readCopySchema(tx, o.Schemas)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Owner != "" {
+		revoke, err := dst.borrowRole(o.Owner)
+		if err != nil {
+			return nil, err
+		}
+		defer revoke()
+	}
+
+	// extensions may need privileges the owner does not have
+	if err := dst.execCopyTx(o.Owner, s.schemas); err != nil {
+		return nil, err
+	}
+	if err := dst.execCopyTx("", s.extensions); err != nil {
+		return nil, err
+	}
+	if err := dst.execCopyTx(o.Owner, s.preData()); err != nil {
+		return nil, err
+	}
+	copied, err := c.copyTables(dst, snapshot, s.tables, o)
+	if err == nil {
+		err = dst.execCopyTx(o.Owner, s.postData())
+	}
+	if err == nil && o.Mask != nil {
+		_, err = dst.mask(o.Owner, o.Mask, o.MaskOptions)
+	}
+	if err != nil && o.Mask != nil && len(copied) > 0 {
+		if terr := dst.truncateCopied(o.Owner, s.tables, copied); terr != nil {
+			return copied, fmt.Errorf("%v, truncate: %v", err, terr)
+		}
+	}
+	return copied, err
+}
+
+// truncateCopied truncates the tables among tables that were copied, acting
+// as role.
+func (c *Conn) truncateCopied(role string, tables []*copyTable, copied []*TableCopy) error {
+	done := map[string]bool{}
+	for _, p := range copied {
+		done[p.Table] = true
+	}
+	var names []string
+	for _, t := range tables {
+		if done[t.Schema+"."+t.Name] {
+			names = append(names, t.qualified())
+		}
+	}
+	tx, err := c.beginAs(role)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(fmt.Sprintf("TRUNCATE %v", strings.Join(names, ", "))); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// borrowRole makes the Conn user a member of a role it is not a member of,
+// and returns the function revoking the membership again.
+func (c *Conn) borrowRole(role string) (func(), error) {
+	var member bool
+	if err := c.DB.QueryRow("SELECT pg_has_role($1, 'MEMBER')", role).Scan(&member); err != nil {
+		return nil, fmt.Errorf("find role %v: %v", role, err)
+	}
+	if member {
+		return func() {}, nil
+	}
+	if _, err := c.DB.Exec(fmt.Sprintf("GRANT %v TO CURRENT_USER", QuoteIdentifier(role))); err != nil {
+		return nil, fmt.Errorf("grant %v: %v", role, err)
+	}
+	return func() {
+		c.DB.Exec(fmt.Sprintf("REVOKE %v FROM CURRENT_USER", QuoteIdentifier(role)))
+	}, nil
+}
+
+// beginAs begins a transaction acting as role, or as the Conn user when role
+// is empty.
+func (c *Conn) beginAs(role string) (*sql.Tx, error) {
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	if role != "" {
+		if _, err := tx.Exec(fmt.Sprintf("SET LOCAL ROLE %v", QuoteIdentifier(role))); err != nil {
+			tx.Rollback()
+			return nil, fmt.Errorf("set role %v: %v", role, err)
+		}
+	}
+	return tx, nil
+}
+
+// execCopyTx execs the sequences of a copy in a transaction acting as role,
+// without checking function bodies that may refer to objects created later.
+func (c *Conn) execCopyTx(role string, xs []Sequence) error {
+	tx, err := c.beginAs(role)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("SET LOCAL check_function_bodies = off"); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := execSequences(tx, xs); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// copyTables copies the rows of tables, o.Parallel at a time, and returns the
+// tables copied. It stops taking tables after the first failure.
+func (c *Conn) copyTables(dst *Conn, snapshot string, tables []*copyTable, o CopyOptions) ([]*TableCopy, error) {
+	var mu sync.Mutex
+	var copied []*TableCopy
+	var failed error
+	progress := func(p *TableCopy) {
+		mu.Lock()
+		defer mu.Unlock()
+		if p.Done {
+			copied = append(copied, p)
+		}
+		if o.Progress != nil {
+			o.Progress(p)
+		}
+	}
+
+	queue := make(chan *copyTable)
+	var wg sync.WaitGroup
+	for i := 0; i < o.Parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range queue {
+				if err := c.copyTable(dst, snapshot, t, o.Owner, progress); err != nil {
+					mu.Lock()
+					if failed == nil {
+						failed = err
+					}
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	for _, t := range tables {
+		mu.Lock()
+		stop := failed != nil
+		mu.Unlock()
+		if stop {
+			break
+		}
+		queue <- t
+	}
+	close(queue)
+	wg.Wait()
+	return copied, failed
+}
+
+// copyTable streams the rows of a table in the source snapshot to the target
+// with COPY, and checks the target has as many rows as the source.
+func (c *Conn) copyTable(dst *Conn, snapshot string, t *copyTable, owner string, progress func(*TableCopy)) error {
+	ctx := context.Background()
+	name := t.Schema + "." + t.Name
+	src, err := c.DB.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer src.Rollback()
+	if _, err := src.Exec(fmt.Sprintf("SET TRANSACTION SNAPSHOT %v", QuoteLiteral(snapshot))); err != nil {
+		return fmt.Errorf("copy %v: %v", name, err)
+	}
+
+	var want int64
+	if err := src.QueryRow(fmt.Sprintf("SELECT count(*) FROM ONLY %v", t.qualified())).Scan(&want); err != nil {
+		return fmt.Errorf("count %v: %v", name, err)
+	}
+
+	tx, err := dst.beginAs(owner)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	cols := t.copiedColumns()
+	p := &TableCopy{Table: name}
+	if len(cols) > 0 {
+		if p.Rows, err = copyRows(src, tx, t, cols, func(rows int64) {
+			progress(&TableCopy{Table: name, Rows: rows})
+		}); err != nil {
+			return fmt.Errorf("copy %v: %v", name, err)
+		}
+	} else {
+		// tables without columns still have rows
+		if _, err := tx.Exec(fmt.Sprintf("INSERT INTO %v SELECT FROM generate_series(1, $1)", t.qualified()), want); err != nil {
+			return fmt.Errorf("copy %v: %v", name, err)
+		}
+		p.Rows = want
+	}
+	// counted before the commit so only complete tables have rows
+	var got int64
+	if err := tx.QueryRow(fmt.Sprintf("SELECT count(*) FROM ONLY %v", t.qualified())).Scan(&got); err != nil {
+		return fmt.Errorf("count %v: %v", name, err)
+	}
+	if p.Rows != want || got != want {
+		return fmt.Errorf("copy %v: the source has %d rows, %d were copied and the target has %d", name, want, p.Rows, got)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("copy %v: %v", name, err)
+	}
+	p.Done = true
+	progress(p)
+	return nil
+}
+
+// copyRows streams the rows of a table as text, so each value is parsed by
+// the target as it was printed by the source, and returns the rows copied.
+func copyRows(src, dst *sql.Tx, t *copyTable, cols []string, progress func(int64)) (int64, error) {
+	var selected []string
+	for _, c := range cols {
+		selected = append(selected, QuoteIdentifier(c)+"::text")
+	}
+	rows, err := src.Query(fmt.Sprintf("SELECT %v FROM ONLY %v", strings.Join(selected, ", "), t.qualified()))
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	stmt, err := dst.Prepare(pq.CopyInSchema(t.Schema, t.Name, cols...))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	values := make([]sql.NullString, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	args := make([]interface{}, len(cols))
+	var n int64
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		for i, v := range values {
+			args[i] = nil
+			if v.Valid {
+				args[i] = v.String
+			}
+		}
+		if _, err := stmt.Exec(args...); err != nil {
+			return n, err
+		}
+		n++
+		if n%copyProgressRows == 0 {
+			progress(n)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	if _, err := stmt.Exec(); err != nil {
+		return n, err
+	}
+	return n, nil
+}
+
+// queryer is satisfied by both *sql.DB and *sql.Tx.
+type queryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// notExtension is the condition excluding the objects of extensions, which
+// are created with their extensions.
+func notExtension(alias string) string {
+	return fmt.Sprintf("NOT EXISTS (SELECT 1 FROM pg_depend x WHERE x.objid = %v.oid AND x.deptype = 'e')", alias)
+}
+
+// copySchema is the schema of a database to copy, as the sequences creating
+// it before the rows of its tables are copied and after.
+type copySchema struct {
+	tables []*copyTable
+
+	schemas     []Sequence
+	extensions  []Sequence
+	pre         []Sequence
+	owned       []Sequence
+	indexes     []Sequence
+	foreignKeys []Sequence
+	triggers    []Sequence
+	setvals     []Sequence
+	refreshes   []Sequence
+}
+
+// preData returns the sequences creating the objects the rows are copied to,
+// after the schemas and extensions.
+func (s *copySchema) preData() []Sequence {
+	return append(append([]Sequence{}, s.pre...), s.owned...)
+}
+
+// postData returns the sequences creating the objects that would slow down or
+// fail the copy of the rows, and setting the sequences and materialized views.
+func (s *copySchema) postData() []Sequence {
+	var xs []Sequence
+	for _, l := range [][]Sequence{s.indexes, s.foreignKeys, s.triggers, s.setvals, s.refreshes} {
+		xs = append(xs, l...)
+	}
+	return xs
+}
+
+// readCopySchema reads the schema of the named schemas of a database, or of
+// all but the system schemas when there are none.
+func readCopySchema(q queryer, schemas []string) (*copySchema, error) {
+	all, err := queryStrings(q, `SELECT n.nspname FROM pg_namespace n
+WHERE n.nspname NOT LIKE 'pg\_%' AND n.nspname <> 'information_schema' AND `+notExtension("n")+`
+ORDER BY 1`)
+	if err != nil {
+		return nil, fmt.Errorf("list schemas: %v", err)
+	}
+	if len(schemas) == 0 {
+		schemas = all
+	}
+	found := map[string]bool{}
+	for _, n := range all {
+		found[n] = true
+	}
+	s := &copySchema{}
+	for _, n := range schemas {
+		if !found[n] {
+			return nil, fmt.Errorf("schema %v does not exist", n)
+		}
+		s.schemas = append(s.schemas, &Schema{n})
+	}
+
+	var partitioned string
+	err = q.QueryRow(`SELECT n.nspname || '.' || c.relname FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relkind = 'p' AND n.nspname = ANY($1) LIMIT 1`, pq.Array(schemas)).Scan(&partitioned)
+	if err == nil {
+		return nil, fmt.Errorf("partitioned table %v cannot be copied", partitioned)
+	} else if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("list tables: %v", err)
+	}
+
+	for _, read := range []func(queryer, []string) error{
+		s.readExtensions,
+		s.readEnums,
+		s.readFunctions(""),
+		s.readSequences,
+		s.readTables,
+		s.readFunctions("r"),
+		s.readConstraints,
+		s.readViews,
+		s.readFunctions("v"),
+		s.readIndexes,
+		s.readTriggers,
+	} {
+		if err := read(q, schemas); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// queryStrings returns the first column of the rows of a query.
+func queryStrings(q queryer, query string, args ...interface{}) ([]string, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ss []string
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		ss = append(ss, s)
+	}
+	return ss, rows.Err()
+}
+
+// readObjects adds a sequence to xs for each row of a query returning the
+// schema and name of an object and the SQL creating it.
+func readObjects(q queryer, xs *[]Sequence, kind, query string, args ...interface{}) error {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("list %vs: %v", kind, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schema, name, def string
+		if err := rows.Scan(&schema, &name, &def); err != nil {
+			return fmt.Errorf("list %vs: %v", kind, err)
+		}
+		*xs = append(*xs, &copyObject{fmt.Sprintf("create %v %v.%v", kind, schema, name), def})
+	}
+	return rows.Err()
+}
+
+func (s *copySchema) readExtensions(q queryer, schemas []string) error {
+	rows, err := q.Query(`SELECT e.extname, n.nspname FROM pg_extension e JOIN pg_namespace n ON n.oid = e.extnamespace
+WHERE e.extname <> 'plpgsql' ORDER BY 1`)
+	if err != nil {
+		return fmt.Errorf("list extensions: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e := &Extension{}
+		if err := rows.Scan(&e.Name, &e.Schema); err != nil {
+			return fmt.Errorf("list extensions: %v", err)
+		}
+		s.schemas = append(s.schemas, &Schema{e.Schema})
+		s.extensions = append(s.extensions, e)
+	}
+	return rows.Err()
+}
+
+func (s *copySchema) readEnums(q queryer, schemas []string) error {
+	rows, err := q.Query(`SELECT n.nspname, t.typname, array_agg(e.enumlabel ORDER BY e.enumsortorder)::text[]
+FROM pg_type t JOIN pg_namespace n ON n.oid = t.typnamespace JOIN pg_enum e ON e.enumtypid = t.oid
+WHERE n.nspname = ANY($1) AND `+notExtension("t")+`
+GROUP BY n.nspname, t.typname ORDER BY 1, 2`, pq.Array(schemas))
+	if err != nil {
+		return fmt.Errorf("list enums: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schema, name string
+		var labels []string
+		if err := rows.Scan(&schema, &name, pq.Array(&labels)); err != nil {
+			return fmt.Errorf("list enums: %v", err)
+		}
+		for i, l := range labels {
+			labels[i] = QuoteLiteral(l)
+		}
+		s.pre = append(s.pre, &copyObject{
+			fmt.Sprintf("create type %v.%v", schema, name),
+			fmt.Sprintf("CREATE TYPE %v.%v AS ENUM (%v)", QuoteIdentifier(schema), QuoteIdentifier(name), strings.Join(labels, ", ")),
+		})
+	}
+	return rows.Err()
+}
+
+// functionRowTypes is the kind of relations whose row types the signature of
+// a function p uses, v when one is a view, r when they are tables, or empty.
+const functionRowTypes = `(SELECT CASE WHEN bool_or(r.relkind IN ('v', 'm')) THEN 'v' WHEN count(*) > 0 THEN 'r' ELSE '' END
+	FROM pg_type t JOIN pg_class r ON r.oid = t.typrelid
+	WHERE r.relkind IN ('r', 'f', 'v', 'm') AND (p.prorettype IN (t.oid, t.typarray)
+		OR t.oid = ANY(COALESCE(p.proallargtypes, p.proargtypes::oid[])) OR t.typarray = ANY(COALESCE(p.proallargtypes, p.proargtypes::oid[]))))`
+
+// readFunctions returns a reader of the functions whose signatures use the
+// row types of the kind of relations functionRowTypes returns, so they are
+// created after the relations.
+func (s *copySchema) readFunctions(rowTypes string) func(queryer, []string) error {
+	return func(q queryer, schemas []string) error {
+		return readObjects(q, &s.pre, "function", `SELECT n.nspname, p.proname, pg_get_functiondef(p.oid)
+FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+WHERE p.prokind IN ('f', 'p') AND n.nspname = ANY($1) AND `+notExtension("p")+` AND `+functionRowTypes+` = $2
+ORDER BY p.oid`, pq.Array(schemas), rowTypes)
+	}
+}
+
+func (s *copySchema) readSequences(q queryer, schemas []string) error {
+	rows, err := q.Query(`SELECT n.nspname, c.relname, format_type(s.seqtypid, NULL), s.seqstart, s.seqincrement, s.seqmin, s.seqmax, s.seqcache, s.seqcycle,
+	EXISTS (SELECT 1 FROM pg_depend d WHERE d.objid = c.oid AND d.deptype = 'i'),
+	COALESCE((SELECT quote_ident(tn.nspname) || '.' || quote_ident(t.relname) || '.' || quote_ident(a.attname)
+		FROM pg_depend d JOIN pg_class t ON t.oid = d.refobjid JOIN pg_namespace tn ON tn.oid = t.relnamespace
+			JOIN pg_attribute a ON a.attrelid = t.oid AND a.attnum = d.refobjsubid
+		WHERE d.classid = 'pg_class'::regclass AND d.objid = c.oid AND d.deptype = 'a'), '')
+FROM pg_sequence s JOIN pg_class c ON c.oid = s.seqrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE n.nspname = ANY($1) AND `+notExtension("c")+`
+ORDER BY 1, 2`, pq.Array(schemas))
+	if err != nil {
+		return fmt.Errorf("list sequences: %v", err)
+	}
+	defer rows.Close()
+
+	var seqs []string
+	for rows.Next() {
+		var schema, name, typ string
+		var start, inc, min, max, cache int64
+		var cycle, identity bool
+		var owner string
+		if err := rows.Scan(&schema, &name, &typ, &start, &inc, &min, &max, &cache, &cycle, &identity, &owner); err != nil {
+			return fmt.Errorf("list sequences: %v", err)
+		}
+		qualified := QuoteIdentifier(schema) + "." + QuoteIdentifier(name)
+		seqs = append(seqs, qualified)
+
+		// identity sequences are created with their columns
+		if identity {
+			continue
+		}
+		c := "NO CYCLE"
+		if cycle {
+			c = "CYCLE"
+		}
+		s.pre = append(s.pre, &copyObject{
+			fmt.Sprintf("create sequence %v.%v", schema, name),
+			fmt.Sprintf("CREATE SEQUENCE %v AS %v INCREMENT BY %d MINVALUE %d MAXVALUE %d START WITH %d CACHE %d %v",
+				qualified, typ, inc, min, max, start, cache, c),
+		})
+		if owner != "" {
+			s.owned = append(s.owned, &copyObject{
+				fmt.Sprintf("set owner of sequence %v.%v", schema, name),
+				fmt.Sprintf("ALTER SEQUENCE %v OWNED BY %v", qualified, owner),
+			})
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("list sequences: %v", err)
+	}
+	rows.Close()
+
+	for _, qualified := range seqs {
+		var last int64
+		var called bool
+		if err := q.QueryRow(fmt.Sprintf("SELECT last_value, is_called FROM %v", qualified)).Scan(&last, &called); err != nil {
+			return fmt.Errorf("read sequence %v: %v", qualified, err)
+		}
+		s.setvals = append(s.setvals, &copyObject{
+			fmt.Sprintf("set sequence %v", qualified),
+			fmt.Sprintf("SELECT setval(%v, %d, %v)", QuoteLiteral(qualified), last, called),
+		})
+	}
+	return nil
+}
+
+func (s *copySchema) readTables(q queryer, schemas []string) error {
+	rows, err := q.Query(`SELECT n.nspname, c.relname, COALESCE(a.attname::text, ''), COALESCE(format_type(a.atttypid, a.atttypmod), ''),
+	COALESCE(a.attnotnull, false), COALESCE(pg_get_expr(d.adbin, d.adrelid), ''), COALESCE(a.attidentity::text, ''), COALESCE(a.attgenerated::text, '')
+FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+	LEFT JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+	LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid AND d.adnum = a.attnum
+WHERE c.relkind = 'r' AND n.nspname = ANY($1) AND `+notExtension("c")+`
+ORDER BY n.nspname, c.relname, a.attnum`, pq.Array(schemas))
+	if err != nil {
+		return fmt.Errorf("list tables: %v", err)
+	}
+	defer rows.Close()
+
+	var t *copyTable
+	for rows.Next() {
+		var schema, name string
+		col := &copyColumn{}
+		if err := rows.Scan(&schema, &name, &col.Name, &col.Type, &col.NotNull, &col.Default, &col.Identity, &col.Generated); err != nil {
+			return fmt.Errorf("list tables: %v", err)
+		}
+		if t == nil || t.Schema != schema || t.Name != name {
+			t = &copyTable{Schema: schema, Name: name}
+			s.tables = append(s.tables, t)
+			s.pre = append(s.pre, t)
+		}
+		if col.Name != "" {
+			t.Columns = append(t.Columns, col)
+		}
+	}
+	return rows.Err()
+}
+
+func (s *copySchema) readConstraints(q queryer, schemas []string) error {
+	rows, err := q.Query(`SELECT n.nspname, c.relname, con.conname, con.contype = 'f', pg_get_constraintdef(con.oid)
+FROM pg_constraint con JOIN pg_class c ON c.oid = con.conrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relkind = 'r' AND con.contype IN ('p', 'u', 'c', 'x', 'f') AND n.nspname = ANY($1) AND `+notExtension("c")+`
+ORDER BY 1, 2, con.contype DESC, 3`, pq.Array(schemas))
+	if err != nil {
+		return fmt.Errorf("list constraints: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schema, table, name, def string
+		var foreign bool
+		if err := rows.Scan(&schema, &table, &name, &foreign, &def); err != nil {
+			return fmt.Errorf("list constraints: %v", err)
+		}
+		x := &copyObject{
+			fmt.Sprintf("add constraint %v on %v.%v", name, schema, table),
+			fmt.Sprintf("ALTER TABLE %v.%v ADD CONSTRAINT %v %v", QuoteIdentifier(schema), QuoteIdentifier(table), QuoteIdentifier(name), def),
+		}
+		if foreign {
+			s.foreignKeys = append(s.foreignKeys, x)
+		} else {
+			s.pre = append(s.pre, x)
+		}
+	}
+	return rows.Err()
+}
+
+func (s *copySchema) readViews(q queryer, schemas []string) error {
+	rows, err := q.Query(`SELECT n.nspname, c.relname, c.relkind = 'm', pg_get_viewdef(c.oid)
+FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relkind IN ('v', 'm') AND n.nspname = ANY($1) AND `+notExtension("c")+`
+ORDER BY c.oid`, pq.Array(schemas))
+	if err != nil {
+		return fmt.Errorf("list views: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schema, name, def string
+		var materialized bool
+		if err := rows.Scan(&schema, &name, &materialized, &def); err != nil {
+			return fmt.Errorf("list views: %v", err)
+		}
+		qualified := QuoteIdentifier(schema) + "." + QuoteIdentifier(name)
+		def = strings.TrimRight(def, "; \n")
+		if !materialized {
+			s.pre = append(s.pre, &copyObject{fmt.Sprintf("create view %v.%v", schema, name), fmt.Sprintf("CREATE VIEW %v AS %v", qualified, def)})
+			continue
+		}
+		s.pre = append(s.pre, &copyObject{
+			fmt.Sprintf("create materialized view %v.%v", schema, name),
+			fmt.Sprintf("CREATE MATERIALIZED VIEW %v AS %v WITH NO DATA", qualified, def),
+		})
+		s.refreshes = append(s.refreshes, &copyObject{
+			fmt.Sprintf("refresh materialized view %v.%v", schema, name),
+			fmt.Sprintf("REFRESH MATERIALIZED VIEW %v", qualified),
+		})
+	}
+	return rows.Err()
+}
+
+func (s *copySchema) readIndexes(q queryer, schemas []string) error {
+	return readObjects(q, &s.indexes, "index", `SELECT n.nspname, ic.relname, pg_get_indexdef(i.indexrelid)
+FROM pg_index i JOIN pg_class ic ON ic.oid = i.indexrelid JOIN pg_class c ON c.oid = i.indrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE c.relkind IN ('r', 'm') AND n.nspname = ANY($1) AND `+notExtension("c")+`
+	AND NOT EXISTS (SELECT 1 FROM pg_constraint con WHERE con.conindid = i.indexrelid AND con.conrelid = i.indrelid)
+ORDER BY 1, 2`, pq.Array(schemas))
+}
+
+func (s *copySchema) readTriggers(q queryer, schemas []string) error {
+	return readObjects(q, &s.triggers, "trigger", `SELECT n.nspname, t.tgname, pg_get_triggerdef(t.oid)
+FROM pg_trigger t JOIN pg_class c ON c.oid = t.tgrelid JOIN pg_namespace n ON n.oid = c.relnamespace
+WHERE NOT t.tgisinternal AND n.nspname = ANY($1) AND `+notExtension("c")+`
+ORDER BY 1, c.relname, 2`, pq.Array(schemas))
+}
+
+// copyObject is a schema object recreated by a copy from its definition.
+type copyObject struct {
+	desc string
+	def  string
+}
+
+// SQL returns the command creating the object.
+func (o *copyObject) SQL() []string {
+	return []string{o.def}
+}
+
+// String returns a string suitable for error messages.
+func (o *copyObject) String() string {
+	return o.desc
+}
+
+// copyTable is a table recreated by a copy.
+type copyTable struct {
+	Schema  string
+	Name    string
+	Columns []*copyColumn
+}
+
+// copyColumn is a column of a copied table.
+type copyColumn struct {
+	Name    string
+	Type    string
+	NotNull bool
+	Default string
+	// Identity is a for GENERATED ALWAYS and d for BY DEFAULT identities
+	Identity string
+	// Generated is s for stored generated columns, whose Default is their
+	// expression
+	Generated string
+}
+
+// qualified returns the quoted schema qualified name of the table.
+func (t *copyTable) qualified() string {
+	return QuoteIdentifier(t.Schema) + "." + QuoteIdentifier(t.Name)
+}
+
+// copiedColumns returns the columns whose values are copied, all but the
+// generated columns.
+func (t *copyTable) copiedColumns() []string {
+	var cols []string
+	for _, c := range t.Columns {
+		if c.Generated == "" {
+			cols = append(cols, c.Name)
+		}
+	}
+	return cols
+}
+
+// SQL returns the command creating the table with its columns.
+func (t *copyTable) SQL() []string {
+	var cols []string
+	for _, c := range t.Columns {
+		col := QuoteIdentifier(c.Name) + " " + c.Type
+		switch {
+		case c.Generated == "s":
+			col += fmt.Sprintf(" GENERATED ALWAYS AS (%v) STORED", c.Default)
+		case c.Identity == "a":
+			col += " GENERATED ALWAYS AS IDENTITY"
+		case c.Identity == "d":
+			col += " GENERATED BY DEFAULT AS IDENTITY"
+		case c.Default != "":
+			col += " DEFAULT " + c.Default
+		}
+		if c.NotNull && c.Identity == "" {
+			col += " NOT NULL"
+		}
+		cols = append(cols, col)
+	}
+	return []string{
+		fmt.Sprintf("CREATE TABLE %v (%v)", t.qualified(), strings.Join(cols, ", ")),
+	}
+}
+
+// String returns a string suitable for error messages.
+func (t *copyTable) String() string {
+	return fmt.Sprintf("create table %v.%v", t.Schema, t.Name)
+}
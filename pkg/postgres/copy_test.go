@@ -0,0 +1,174 @@
+package postgres
+
+import (
+	"regexp"
+	"testing"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestCopyTableSQL(t *testing.T) {
+	tbl := &copyTable{"app", "users", []*copyColumn{
+		{Name: "id", Type: "bigint", NotNull: true, Identity: "d"},
+		{Name: "email", Type: "text", NotNull: true},
+		{Name: "created", Type: "timestamp with time zone", Default: "now()"},
+		{Name: "lower_email", Type: "text", Default: "lower(email)", Generated: "s"},
+	}}
+
+	x := `CREATE TABLE "app"."users" ("id" bigint GENERATED BY DEFAULT AS IDENTITY, "email" text NOT NULL, "created" timestamp with time zone DEFAULT now(), "lower_email" text GENERATED ALWAYS AS (lower(email)) STORED)`
+	if ss := tbl.SQL(); len(ss) != 1 || ss[0] != x {
+		t.Errorf("Expected %v got %v", x, ss)
+	}
+	if cols := tbl.copiedColumns(); len(cols) != 3 || cols[2] != "created" {
+		t.Errorf("Expected generated columns not to be copied, got %v", cols)
+	}
+}
+
+func TestCopyTable(t *testing.T) {
+	srcDB, src, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+	dstDB, dst, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	src.ExpectBegin()
+	src.ExpectExec(regexp.QuoteMeta("SET TRANSACTION SNAPSHOT '00000003-1'")).WillReturnResult(sqlmock.NewResult(0, 0))
+	src.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM ONLY "app"."users"`)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	src.ExpectQuery(regexp.QuoteMeta(`SELECT "id"::text, "email"::text FROM ONLY "app"."users"`)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email"}).AddRow("1", "a@example.com").AddRow("2", nil))
+	src.ExpectRollback()
+
+	dst.ExpectBegin()
+	dst.ExpectExec(regexp.QuoteMeta(`SET LOCAL ROLE "db_admin"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	copyIn := dst.ExpectPrepare(regexp.QuoteMeta(`COPY "app"."users" ("id", "email") FROM STDIN`))
+	copyIn.ExpectExec().WithArgs("1", "a@example.com").WillReturnResult(sqlmock.NewResult(0, 0))
+	copyIn.ExpectExec().WithArgs("2", nil).WillReturnResult(sqlmock.NewResult(0, 0))
+	copyIn.ExpectExec().WillReturnResult(sqlmock.NewResult(0, 2))
+	dst.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM ONLY "app"."users"`)).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(2))
+	dst.ExpectCommit()
+
+	c := &Conn{"source", 0, &User{"master", dc}, srcDB, Options{}}
+	to := &Conn{"target", 0, &User{"master", dc}, dstDB, Options{}}
+	tbl := &copyTable{"app", "users", []*copyColumn{{Name: "id", Type: "bigint"}, {Name: "email", Type: "text"}}}
+
+	var done *TableCopy
+	err = c.copyTable(to, "00000003-1", tbl, "db_admin", func(p *TableCopy) {
+		if p.Done {
+			done = p
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if done == nil || done.Table != "app.users" || done.Rows != 2 {
+		t.Errorf("Expected 2 rows of app.users to be copied, got %#v", done)
+	}
+
+	for _, mock := range []sqlmock.Sqlmock{src, dst} {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestReadCopySchema(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	none := func(cols ...string) *sqlmock.Rows { return sqlmock.NewRows(cols) }
+	object := []string{"nspname", "name", "def"}
+	functions := regexp.QuoteMeta("FROM pg_proc p")
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT n.nspname FROM pg_namespace n")).WillReturnRows(none("nspname").AddRow("public"))
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE c.relkind = 'p'")).WillReturnRows(none("name"))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM pg_extension e")).WillReturnRows(none("extname", "nspname"))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM pg_type t JOIN pg_namespace n")).WillReturnRows(none("nspname", "typname", "labels"))
+	mock.ExpectQuery(functions).WithArgs(sqlmock.AnyArg(), "").
+		WillReturnRows(none(object...).AddRow("public", "total", "CREATE FUNCTION public.total(integer) RETURNS integer"))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM pg_sequence s")).
+		WillReturnRows(none("nspname", "relname", "type", "start", "inc", "min", "max", "cache", "cycle", "identity", "owner"))
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE c.relkind = 'r' AND n.nspname")).
+		WillReturnRows(none("nspname", "relname", "attname", "type", "notnull", "default", "identity", "generated").
+			AddRow("public", "orders", "id", "integer", true, "", "", ""))
+	mock.ExpectQuery(functions).WithArgs(sqlmock.AnyArg(), "r").
+		WillReturnRows(none(object...).AddRow("public", "open_orders", "CREATE FUNCTION public.open_orders() RETURNS SETOF public.orders"))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM pg_constraint con")).WillReturnRows(none("nspname", "relname", "conname", "foreign", "def"))
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE c.relkind IN ('v', 'm')")).
+		WillReturnRows(none("nspname", "relname", "materialized", "def").AddRow("public", "recent", false, "SELECT * FROM public.orders"))
+	mock.ExpectQuery(functions).WithArgs(sqlmock.AnyArg(), "v").
+		WillReturnRows(none(object...).AddRow("public", "recent_first", "CREATE FUNCTION public.recent_first() RETURNS public.recent"))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM pg_index i")).WillReturnRows(none(object...))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM pg_trigger t")).WillReturnRows(none(object...))
+
+	s, err := readCopySchema(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	x := []string{
+		"create function public.total",
+		"create table public.orders",
+		"create function public.open_orders",
+		"create view public.recent",
+		"create function public.recent_first",
+	}
+	if len(s.pre) != len(x) {
+		t.Fatalf("Expected %v, got %v", x, s.pre)
+	}
+	for i, o := range s.pre {
+		if o.String() != x[i] {
+			t.Errorf("Expected %v at %d, got %v", x[i], i, o)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCopyOldServer(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT current_setting('server_version_num')::int")).
+		WillReturnRows(sqlmock.NewRows([]string{"current_setting"}).AddRow(110005))
+
+	c := &Conn{"source", 0, &User{"master", dc}, db, Options{MaxOpenConns: 2}}
+	if _, err := c.copyTo(c, CopyOptions{}); err == nil {
+		t.Errorf("Expected PostgreSQL 11 to fail the copy")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTruncateCopied(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`SET LOCAL ROLE "db_admin"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`TRUNCATE "a.b"."users", "app"."orders"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	c := &Conn{"target", 0, &User{"master", dc}, db, Options{}}
+	tables := []*copyTable{{"a.b", "users", nil}, {"app", "orders", nil}, {"app", "failed", nil}}
+	copied := []*TableCopy{{Table: "app.orders", Done: true}, {Table: "a.b.users", Done: true}}
+	if err := c.truncateCopied("db_admin", tables, copied); err != nil {
+		t.Error(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
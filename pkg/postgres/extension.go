@@ -0,0 +1,226 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ExtensionInfo describes an extension available on the server, and its
+// installed version and schema in a database when it is installed.
+type ExtensionInfo struct {
+	Name             string `json:"name"`
+	DefaultVersion   string `json:"default_version"`
+	InstalledVersion string `json:"installed_version,omitempty"`
+	Schema           string `json:"schema,omitempty"`
+	// RequiredSchema is the schema the default version must be installed in,
+	// set by extensions that cannot be relocated
+	RequiredSchema string `json:"required_schema,omitempty"`
+	Comment        string `json:"comment,omitempty"`
+}
+
+// ListExtensions returns the extensions available on the server, with the
+// versions installed in a database, connecting to it as the Conn user.
+func (c *Conn) ListExtensions(database string) ([]*ExtensionInfo, error) {
+	c2, err := c.connect(database, c.User)
+	if err != nil {
+		return nil, err
+	}
+	defer c2.Close()
+
+	return c2.extensions()
+}
+
+// EnsureExtensions creates the named extensions that are missing from a
+// database, connecting to it as the Conn user, and returns them with their
+// installed versions. Names may be qualified with the schema to create the
+// extension in, as in app.pg_trgm, and default to schema, or when it is empty
+// to the schema Postgres picks, the first of the search path. Extensions that
+// require a schema are created in it. Extensions that are already installed
+// are left in their schema.
+func (c *Conn) EnsureExtensions(database string, names []string, schema string) ([]*ExtensionInfo, error) {
+	c2, err := c.connect(database, c.User)
+	if err != nil {
+		return nil, err
+	}
+	defer c2.Close()
+
+	return c2.ensureExtensions(names, schema)
+}
+
+// UpdateExtensions updates the named extensions installed in a database to
+// their default versions, connecting to it as the Conn user, and returns them
+// with their installed versions.
+func (c *Conn) UpdateExtensions(database string, names []string) ([]*ExtensionInfo, error) {
+	c2, err := c.connect(database, c.User)
+	if err != nil {
+		return nil, err
+	}
+	defer c2.Close()
+
+	return c2.updateExtensions(names)
+}
+
+func (c *Conn) ensureExtensions(names []string, schema string) ([]*ExtensionInfo, error) {
+	available, err := c.extensionMap()
+	if err != nil {
+		return nil, err
+	}
+
+	var xs []Sequence
+	var plain []string
+	for _, name := range names {
+		e := &Extension{Name: name, Schema: schema}
+		if i := strings.Index(name, "."); i >= 0 {
+			e.Schema, e.Name = name[:i], name[i+1:]
+		}
+		plain = append(plain, e.Name)
+
+		info, ok := available[e.Name]
+		if !ok {
+			return nil, fmt.Errorf("extension %v is not available", e.Name)
+		}
+		if info.RequiredSchema != "" {
+			if e.Schema != "" && e.Schema != info.RequiredSchema {
+				return nil, fmt.Errorf("extension %v must be installed in schema %v", e.Name, info.RequiredSchema)
+			}
+			e.Schema = info.RequiredSchema
+		}
+		if info.InstalledVersion == "" {
+			xs = append(xs, e)
+		}
+	}
+	if len(xs) > 0 {
+		if err := c.ExecTx(xs...); err != nil {
+			return nil, err
+		}
+	}
+	return c.extensionsNamed(plain)
+}
+
+func (c *Conn) updateExtensions(names []string) ([]*ExtensionInfo, error) {
+	available, err := c.extensionMap()
+	if err != nil {
+		return nil, err
+	}
+
+	var xs []Sequence
+	for _, name := range names {
+		info, ok := available[name]
+		if !ok || info.InstalledVersion == "" {
+			return nil, fmt.Errorf("extension %v is not installed", name)
+		}
+		if info.InstalledVersion != info.DefaultVersion {
+			xs = append(xs, &UpdateExtension{name})
+		}
+	}
+	if len(xs) > 0 {
+		if err := c.ExecTx(xs...); err != nil {
+			return nil, err
+		}
+	}
+	return c.extensionsNamed(names)
+}
+
+// extensions returns the extensions available on the server, with the versions
+// installed in the connected database.
+func (c *Conn) extensions() ([]*ExtensionInfo, error) {
+	rows, err := c.DB.Query(`SELECT a.name, COALESCE(a.default_version, ''), COALESCE(e.extversion, ''), COALESCE(n.nspname, ''), COALESCE(v.schema::text, ''), COALESCE(a.comment, '')
+FROM pg_available_extensions a
+	LEFT JOIN pg_available_extension_versions v ON v.name = a.name AND v.version = a.default_version
+	LEFT JOIN pg_extension e ON e.extname = a.name
+	LEFT JOIN pg_namespace n ON n.oid = e.extnamespace
+ORDER BY a.name`)
+	if err != nil {
+		return nil, fmt.Errorf("list extensions: %v", err)
+	}
+	defer rows.Close()
+
+	var exts []*ExtensionInfo
+	for rows.Next() {
+		e := &ExtensionInfo{}
+		if err := rows.Scan(&e.Name, &e.DefaultVersion, &e.InstalledVersion, &e.Schema, &e.RequiredSchema, &e.Comment); err != nil {
+			return nil, fmt.Errorf("list extensions: %v", err)
+		}
+		exts = append(exts, e)
+	}
+	return exts, rows.Err()
+}
+
+// extensionMap returns the extensions of the connected database by name.
+func (c *Conn) extensionMap() (map[string]*ExtensionInfo, error) {
+	exts, err := c.extensions()
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]*ExtensionInfo{}
+	for _, e := range exts {
+		m[e.Name] = e
+	}
+	return m, nil
+}
+
+// extensionsNamed returns the named extensions of the connected database, in order.
+func (c *Conn) extensionsNamed(names []string) ([]*ExtensionInfo, error) {
+	m, err := c.extensionMap()
+	if err != nil {
+		return nil, err
+	}
+	var exts []*ExtensionInfo
+	for _, name := range names {
+		if e, ok := m[name]; ok {
+			exts = append(exts, e)
+		}
+	}
+	return exts, nil
+}
+
+// Extension is an extension installed in the connected database.
+type Extension struct {
+	Name string
+	// Schema defaults to the first schema of the search path
+	Schema string
+	// Version defaults to the default version of the extension
+	Version string
+}
+
+// SQL returns the command to create this extension.
+func (e *Extension) SQL() []string {
+	s := fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS %v", QuoteIdentifier(e.Name))
+	if e.Schema != "" {
+		s += " WITH SCHEMA " + QuoteIdentifier(e.Schema)
+	}
+	if e.Version != "" {
+		s += " VERSION " + QuoteLiteral(e.Version)
+	}
+	return []string{s}
+}
+
+// String returns a string suitable for error messages.
+func (e *Extension) String() string {
+	return fmt.Sprintf("create extension %v", e.Name)
+}
+
+// Revert returns the command to drop the extension, which fails while other
+// objects depend on it.
+func (e *Extension) Revert() []string {
+	return []string{
+		fmt.Sprintf("DROP EXTENSION IF EXISTS %v", QuoteIdentifier(e.Name)),
+	}
+}
+
+// UpdateExtension is an update of an installed extension to its default version.
+type UpdateExtension struct {
+	Name string
+}
+
+// SQL returns the command to update the extension.
+func (u *UpdateExtension) SQL() []string {
+	return []string{
+		fmt.Sprintf("ALTER EXTENSION %v UPDATE", QuoteIdentifier(u.Name)),
+	}
+}
+
+// String returns a string suitable for error messages.
+func (u *UpdateExtension) String() string {
+	return fmt.Sprintf("update extension %v", u.Name)
+}
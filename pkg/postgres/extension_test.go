@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"regexp"
+	"testing"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+var extensionColumns = []string{"name", "default_version", "installed_version", "schema", "required_schema", "comment"}
+
+func TestExtension(t *testing.T) {
+	x := `CREATE EXTENSION IF NOT EXISTS "uuid-ossp" WITH SCHEMA "app" VERSION '1.1'`
+	if ss := (&Extension{"uuid-ossp", "app", "1.1"}).SQL(); len(ss) != 1 || ss[0] != x {
+		t.Errorf("Expected %v, got %#v", x, ss)
+	}
+	x = `CREATE EXTENSION IF NOT EXISTS "pgcrypto"`
+	if ss := (&Extension{Name: "pgcrypto"}).SQL(); len(ss) != 1 || ss[0] != x {
+		t.Errorf("Expected %v, got %#v", x, ss)
+	}
+}
+
+func TestEnsureExtensions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	ex := regexp.QuoteMeta("SELECT a.name")
+	mock.ExpectQuery(ex).WillReturnRows(sqlmock.NewRows(extensionColumns).
+		AddRow("pg_trgm", "1.6", "", "", "", "text similarity").
+		AddRow("pgcrypto", "1.3", "1.3", "public", "", "cryptographic functions").
+		AddRow("uuid-ossp", "1.1", "", "", "", "uuids").
+		AddRow("plpgsql", "1.0", "", "", "pg_catalog", "procedural language"))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE EXTENSION IF NOT EXISTS "pg_trgm" WITH SCHEMA "app"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE EXTENSION IF NOT EXISTS "uuid-ossp"`) + "$").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE EXTENSION IF NOT EXISTS "plpgsql" WITH SCHEMA "pg_catalog"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	mock.ExpectQuery(ex).WillReturnRows(sqlmock.NewRows(extensionColumns).
+		AddRow("pg_trgm", "1.6", "1.6", "app", "", "text similarity").
+		AddRow("pgcrypto", "1.3", "1.3", "public", "", "cryptographic functions").
+		AddRow("uuid-ossp", "1.1", "1.1", "public", "", "uuids").
+		AddRow("plpgsql", "1.0", "1.0", "pg_catalog", "pg_catalog", "procedural language"))
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+	exts, err := c.ensureExtensions([]string{"app.pg_trgm", "pgcrypto", "uuid-ossp", "plpgsql"}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exts) != 4 || exts[0].InstalledVersion != "1.6" || exts[0].Schema != "app" || exts[1].Name != "pgcrypto" {
+		t.Errorf("Expected pg_trgm 1.6 in app and pgcrypto, got %#v", exts)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEnsureExtensionsUnavailable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT a.name")).WillReturnRows(sqlmock.NewRows(extensionColumns).
+		AddRow("pgcrypto", "1.3", "", "", "", "cryptographic functions"))
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+	if exts, err := c.ensureExtensions([]string{"pgcrypto", "postgis"}, ""); err == nil {
+		t.Errorf("Expected an error, got %#v", exts)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEnsureExtensionsRequiredSchema(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT a.name")).WillReturnRows(sqlmock.NewRows(extensionColumns).
+		AddRow("plpgsql", "1.0", "", "", "pg_catalog", "procedural language"))
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+	if exts, err := c.ensureExtensions([]string{"plpgsql"}, "app"); err == nil {
+		t.Errorf("Expected an error, got %#v", exts)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUpdateExtensions(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	ex := regexp.QuoteMeta("SELECT a.name")
+	mock.ExpectQuery(ex).WillReturnRows(sqlmock.NewRows(extensionColumns).
+		AddRow("postgis", "3.4.0", "3.1.4", "public", "", "geometry"))
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER EXTENSION "postgis" UPDATE`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	mock.ExpectQuery(ex).WillReturnRows(sqlmock.NewRows(extensionColumns).
+		AddRow("postgis", "3.4.0", "3.4.0", "public", "", "geometry"))
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+	exts, err := c.updateExtensions([]string{"postgis"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exts) != 1 || exts[0].InstalledVersion != "3.4.0" {
+		t.Errorf("Expected postgis 3.4.0, got %#v", exts)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
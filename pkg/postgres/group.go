@@ -0,0 +1,177 @@
+package postgres
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// groupName returns the name of the group role of a role on a database, as in
+// foobaz_write. The database name is truncated as in userName.
+func groupName(database, group string) string {
+	n := 56
+	if l := 62 - len(group); l < n {
+		n = l
+	}
+	return truncateBytes(database, n) + "_" + group
+}
+
+// addedNumber returns the number of a user named by AddUser for a database and
+// level, as the 2 in foobaz-write-2, or 0 for other names.
+func addedNumber(database, level, name string) int {
+	i := strings.LastIndex(name, "-")
+	if i < 0 {
+		return 0
+	}
+	n, err := strconv.Atoi(name[i+1:])
+	if err != nil || n < 2 || name != userName(database, fmt.Sprintf("%v-%d", level, n)) {
+		return 0
+	}
+	return n
+}
+
+// AddUser creates another login user in a group role of a database created
+// from a template, such as a second writer for a new service, and returns it
+// with its generated password. The level is the group suffix, admin, write, or
+// read for DefaultTemplate. Users are named after the database and level with a
+// number one above those of the group members, as in foobaz-write-2, and get
+// the connection limit and settings of the template role.
+func (c *Conn) AddUser(database string, t *Template, level string) (*User, error) {
+	p, u, err := c.PlanAddUser(database, t, level)
+	if err != nil {
+		return nil, err
+	}
+
+	method, err := c.PasswordEncryption()
+	if err != nil {
+		return nil, err
+	}
+	pw, err := genPasswords(1, 30)
+	if err != nil {
+		return nil, err
+	}
+	u.Password = pw[0]
+	v, err := encrypted(method, u)
+	if err != nil {
+		return nil, err
+	}
+	p.Steps[0].Sequences[0] = v
+
+	if err := c.Run(p); err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
+// PlanAddUser returns the plan AddUser runs for a database and level, without
+// running it, and the user it creates, with its password shown as ********.
+func (c *Conn) PlanAddUser(database string, t *Template, level string) (*Plan, *User, error) {
+	var role *RoleTemplate
+	for _, r := range t.Roles {
+		if r.group() == level {
+			role = r
+		}
+	}
+	if role == nil {
+		return nil, nil, fmt.Errorf("template has no %v group", level)
+	}
+
+	database = truncateBytes(database, 63)
+	group := &User{Name: groupName(database, level)}
+
+	groups, err := c.existingUsers(group.Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(groups) == 0 {
+		return nil, nil, fmt.Errorf("database %v has no %v group", database, level)
+	}
+
+	members, err := c.groupMembers(group)
+	if err != nil {
+		return nil, nil, err
+	}
+	next := 2
+	for _, m := range members {
+		if i := addedNumber(database, level, m.Name); i >= next {
+			next = i + 1
+		}
+	}
+	name := userName(database, fmt.Sprintf("%v-%d", level, next))
+	existing, err := c.existingUsers(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(existing) > 0 {
+		return nil, nil, fmt.Errorf("user %v already exists", name)
+	}
+
+	// the owner group holds all privileges on the database with grant option,
+	// and its members act as it so the objects they create belong to the group
+	var owner bool
+	err = c.DB.QueryRow("SELECT has_database_privilege($1, $2, 'CREATE WITH GRANT OPTION')",
+		group.Name, database).Scan(&owner)
+	if err != nil {
+		return nil, nil, fmt.Errorf("find privileges of %v: %v", group.Name, err)
+	}
+
+	u := &User{name, "********"}
+	xs := []Sequence{u, &GrantRoles{[]*User{group}, u}}
+	if owner {
+		xs = append(xs, &SetRole{u, group})
+	}
+	settings, err := userSettings(u, role)
+	if err != nil {
+		return nil, nil, err
+	}
+	xs = append(xs, settings...)
+	return &Plan{[]*Step{{c.database(), c.User, nil, false, xs}}}, u, nil
+}
+
+// GroupRole is a NOLOGIN role holding privileges for its members.
+type GroupRole struct {
+	Role *User
+}
+
+// SQL returns the command to create the group role.
+func (g *GroupRole) SQL() []string {
+	return []string{
+		fmt.Sprintf("CREATE ROLE %v NOLOGIN", QuoteIdentifier(g.Role.Name)),
+	}
+}
+
+// String returns a string suitable for error messages.
+func (g *GroupRole) String() string {
+	return fmt.Sprintf("create group role %v", g.Role.Name)
+}
+
+// Revert returns the commands to drop the group role.
+func (g *GroupRole) Revert() []string {
+	return dropRole(g.Role, "ROLE")
+}
+
+// SetRole is a setting making a user act as a role it is a member of when it
+// connects, so the objects it creates are owned by the role.
+type SetRole struct {
+	User *User
+	Role *User
+}
+
+// SQL returns the command to set the role.
+func (s *SetRole) SQL() []string {
+	return []string{
+		fmt.Sprintf("ALTER ROLE %v SET ROLE %v", QuoteIdentifier(s.User.Name), QuoteIdentifier(s.Role.Name)),
+	}
+}
+
+// String returns a string suitable for error messages.
+func (s *SetRole) String() string {
+	return fmt.Sprintf("set role of %v to %v", s.User.Name, s.Role.Name)
+}
+
+// Revert returns the command to stop the user acting as the role.
+func (s *SetRole) Revert() []string {
+	return []string{
+		fmt.Sprintf("ALTER ROLE %v RESET ROLE", QuoteIdentifier(s.User.Name)),
+	}
+}
@@ -0,0 +1,147 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// DatabaseInfo describes a database on the server.
+type DatabaseInfo struct {
+	Name     string `json:"name"`
+	Owner    string `json:"owner"`
+	Encoding string `json:"encoding"`
+	// Size in bytes, zero when the Conn user may not connect to the database
+	Size int64 `json:"size"`
+}
+
+// Role describes a role on the server.
+type Role struct {
+	Name       string   `json:"name"`
+	Login      bool     `json:"login"`
+	Superuser  bool     `json:"superuser"`
+	CreateDB   bool     `json:"createdb"`
+	CreateRole bool     `json:"createrole"`
+	ConnLimit  int      `json:"connlimit"`
+	MemberOf   []string `json:"member_of"`
+}
+
+// Grant is a privilege held by a role on a schema, or on a table when Table is set.
+type Grant struct {
+	Schema    string `json:"schema"`
+	Table     string `json:"table,omitempty"`
+	Role      string `json:"role"`
+	Privilege string `json:"privilege"`
+	Grantable bool   `json:"grantable"`
+}
+
+// ListDatabases returns the databases on the server, excluding templates.
+func (c *Conn) ListDatabases() ([]*DatabaseInfo, error) {
+	rows, err := c.DB.Query(`SELECT d.datname, pg_get_userbyid(d.datdba), pg_encoding_to_char(d.encoding),
+	CASE WHEN has_database_privilege(d.datname, 'CONNECT') THEN pg_database_size(d.datname) END
+FROM pg_database d
+WHERE NOT d.datistemplate
+ORDER BY d.datname`)
+	if err != nil {
+		return nil, fmt.Errorf("list databases: %v", err)
+	}
+	defer rows.Close()
+
+	var dbs []*DatabaseInfo
+	for rows.Next() {
+		d := &DatabaseInfo{}
+		var size sql.NullInt64
+		if err := rows.Scan(&d.Name, &d.Owner, &d.Encoding, &size); err != nil {
+			return nil, fmt.Errorf("list databases: %v", err)
+		}
+		d.Size = size.Int64
+		dbs = append(dbs, d)
+	}
+	return dbs, rows.Err()
+}
+
+// ListRoles returns the roles on the server, excluding the predefined pg_ roles.
+func (c *Conn) ListRoles() ([]*Role, error) {
+	rows, err := c.DB.Query(`SELECT r.rolname, r.rolcanlogin, r.rolsuper, r.rolcreatedb, r.rolcreaterole, r.rolconnlimit,
+	ARRAY(SELECT b.rolname FROM pg_auth_members m JOIN pg_roles b ON b.oid = m.roleid WHERE m.member = r.oid ORDER BY 1)
+FROM pg_roles r
+WHERE r.rolname !~ '^pg_'
+ORDER BY r.rolname`)
+	if err != nil {
+		return nil, fmt.Errorf("list roles: %v", err)
+	}
+	defer rows.Close()
+
+	var roles []*Role
+	for rows.Next() {
+		r := &Role{}
+		if err := rows.Scan(&r.Name, &r.Login, &r.Superuser, &r.CreateDB, &r.CreateRole, &r.ConnLimit, pq.Array(&r.MemberOf)); err != nil {
+			return nil, fmt.Errorf("list roles: %v", err)
+		}
+		roles = append(roles, r)
+	}
+	return roles, rows.Err()
+}
+
+// ShowGrants returns the privileges held on the schemas and tables of a
+// database, connecting to it as the Conn user.
+func (c *Conn) ShowGrants(database string) ([]*Grant, error) {
+	c2, err := c.connect(database, c.User)
+	if err != nil {
+		return nil, err
+	}
+	defer c2.Close()
+
+	return c2.grants()
+}
+
+// grants returns the privileges held on the schemas and tables of the
+// connected database, read from the ACLs so grants between other roles are
+// listed too. Objects without explicit privileges report the defaults.
+func (c *Conn) grants() ([]*Grant, error) {
+	var grants []*Grant
+
+	rows, err := c.DB.Query(`SELECT n.nspname, COALESCE(r.rolname, 'PUBLIC'), a.privilege_type, a.is_grantable
+FROM pg_namespace n
+	CROSS JOIN LATERAL aclexplode(COALESCE(n.nspacl, acldefault('n', n.nspowner))) a
+	LEFT JOIN pg_roles r ON r.oid = a.grantee
+WHERE n.nspname !~ '^pg_' AND n.nspname <> 'information_schema'
+ORDER BY 1, 2, 3`)
+	if err != nil {
+		return nil, fmt.Errorf("show schema grants: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		g := &Grant{}
+		if err := rows.Scan(&g.Schema, &g.Role, &g.Privilege, &g.Grantable); err != nil {
+			return nil, fmt.Errorf("show schema grants: %v", err)
+		}
+		grants = append(grants, g)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("show schema grants: %v", err)
+	}
+
+	rows, err = c.DB.Query(`SELECT n.nspname, c.relname, COALESCE(r.rolname, 'PUBLIC'), a.privilege_type, a.is_grantable
+FROM pg_class c
+	JOIN pg_namespace n ON n.oid = c.relnamespace
+	CROSS JOIN LATERAL aclexplode(COALESCE(c.relacl, acldefault('r', c.relowner))) a
+	LEFT JOIN pg_roles r ON r.oid = a.grantee
+WHERE c.relkind IN ('r', 'p', 'v', 'm', 'f') AND n.nspname !~ '^pg_' AND n.nspname <> 'information_schema'
+ORDER BY 1, 2, 3, 4`)
+	if err != nil {
+		return nil, fmt.Errorf("show table grants: %v", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		g := &Grant{}
+		if err := rows.Scan(&g.Schema, &g.Table, &g.Role, &g.Privilege, &g.Grantable); err != nil {
+			return nil, fmt.Errorf("show table grants: %v", err)
+		}
+		grants = append(grants, g)
+	}
+	return grants, rows.Err()
+}
@@ -0,0 +1,440 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// Masking strategies.
+const (
+	// MaskHash replaces a text or integer value with a salted SHA-256 hash of
+	// it, so equal values stay equal and still join
+	MaskHash = "hash"
+	// MaskNull replaces a value with NULL
+	MaskNull = "null"
+	// MaskFakeEmail replaces a text value with an example.com address made
+	// from its hash, so equal addresses stay equal
+	MaskFakeEmail = "fake_email"
+	// MaskTruncate keeps the first Length characters of a text value
+	MaskTruncate = "truncate"
+	// MaskConstant replaces a value with Value
+	MaskConstant = "constant"
+)
+
+// MaskRule masks a column with a strategy.
+type MaskRule struct {
+	// Column is table.column or schema.table.column, in public by default
+	Column   string `yaml:"column"`
+	Strategy string `yaml:"strategy"`
+	// Value replacing the column with the constant strategy
+	Value string `yaml:"value,omitempty"`
+	// Length kept by the truncate strategy
+	Length int `yaml:"length,omitempty"`
+}
+
+// MaskRules is a ruleset masking personal data in a database.
+type MaskRules struct {
+	// Salt of the hashes of the hash and fake_email strategies. Values masked
+	// with the same salt are equal, and cannot be found by hashing guesses
+	// without it.
+	Salt  string      `yaml:"salt,omitempty"`
+	Rules []*MaskRule `yaml:"rules"`
+}
+
+// LoadMaskRules reads YAML masking rules and validates them.
+func LoadMaskRules(r io.Reader) (*MaskRules, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	m := &MaskRules{}
+	if err := yaml.UnmarshalStrict(b, m); err != nil {
+		return nil, fmt.Errorf("mask rules: %v", err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// LoadMaskRulesFile reads YAML masking rules from a file and validates them.
+func LoadMaskRulesFile(path string) (*MaskRules, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadMaskRules(f)
+}
+
+// Validate checks that each rule names a column once, with a known strategy
+// and only the options of its strategy.
+func (m *MaskRules) Validate() error {
+	if len(m.Rules) == 0 {
+		return fmt.Errorf("mask rules have no rules")
+	}
+	seen := map[string]bool{}
+	for _, r := range m.Rules {
+		schema, table, column, err := r.column()
+		if err != nil {
+			return err
+		}
+		key := schema + "." + table + "." + column
+		if seen[key] {
+			return fmt.Errorf("column %v is masked more than once", r.Column)
+		}
+		seen[key] = true
+
+		switch r.Strategy {
+		case MaskHash, MaskNull, MaskFakeEmail, MaskTruncate, MaskConstant:
+		default:
+			return fmt.Errorf("column %v: unknown strategy %q", r.Column, r.Strategy)
+		}
+		if r.Value != "" && r.Strategy != MaskConstant {
+			return fmt.Errorf("column %v: value is only used by the constant strategy", r.Column)
+		}
+		if r.Length != 0 && r.Strategy != MaskTruncate {
+			return fmt.Errorf("column %v: length is only used by the truncate strategy", r.Column)
+		}
+		if r.Length < 0 {
+			return fmt.Errorf("column %v: length %d must be 0 or more", r.Column, r.Length)
+		}
+	}
+	return nil
+}
+
+// column returns the schema, table and column of a rule.
+func (r *MaskRule) column() (string, string, string, error) {
+	parts := strings.Split(r.Column, ".")
+	for _, p := range parts {
+		if p == "" {
+			parts = nil
+		}
+	}
+	switch len(parts) {
+	case 2:
+		return "public", parts[0], parts[1], nil
+	case 3:
+		return parts[0], parts[1], parts[2], nil
+	}
+	return "", "", "", fmt.Errorf("column %q must be table.column or schema.table.column", r.Column)
+}
+
+// MaskOptions are the options of MaskDatabase.
+type MaskOptions struct {
+	// BatchSize is the number of rows each UPDATE masks, defaults to 10000.
+	// The UPDATEs run in the transaction of the whole database.
+	BatchSize int
+	// Progress is called with the rows masked of a table after each UPDATE
+	Progress func(t *MaskedTable)
+}
+
+// MaskedTable is the progress of the masking of a table.
+type MaskedTable struct {
+	Table string `json:"table"`
+	Rows  int64  `json:"rows"`
+	Done  bool   `json:"done"`
+}
+
+// MaskDatabase masks the columns of a database in place, connecting to it as
+// the Conn user, in one transaction: masking a column twice hashes the hashes,
+// so a failure masks nothing and the rules can run again. The columns of each
+// table are masked together by UPDATEs of BatchSize rows in primary key order,
+// to report progress, or by a single UPDATE without a primary key. Nothing is
+// committed until every table is masked. It returns the tables masked.
+func (c *Conn) MaskDatabase(database string, rules *MaskRules, o MaskOptions) ([]*MaskedTable, error) {
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	if rules.Salt == "" {
+		return nil, fmt.Errorf("mask rules need a salt")
+	}
+	c2, err := c.connect(database, c.User)
+	if err != nil {
+		return nil, err
+	}
+	defer c2.Close()
+
+	return c2.mask("", rules, o)
+}
+
+// mask masks the columns of the rules in a transaction acting as role, or as
+// the Conn user when role is empty.
+func (c *Conn) mask(role string, rules *MaskRules, o MaskOptions) ([]*MaskedTable, error) {
+	if o.BatchSize < 1 {
+		o.BatchSize = 10000
+	}
+
+	// the rules of each table, in the order of the ruleset
+	var tables []*maskTable
+	byName := map[string]*maskTable{}
+	for _, r := range rules.Rules {
+		schema, table, column, _ := r.column()
+		t, ok := byName[schema+"."+table]
+		if !ok {
+			t = &maskTable{Schema: schema, Name: table}
+			byName[schema+"."+table] = t
+			tables = append(tables, t)
+		}
+		t.rules = append(t.rules, maskColumn{column, r})
+	}
+
+	tx, err := c.beginAs(role)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var masked []*MaskedTable
+	for _, t := range tables {
+		m, err := t.mask(tx, rules.Salt, o)
+		if err != nil {
+			return nil, err
+		}
+		masked = append(masked, m)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return masked, nil
+}
+
+// maskTable is a table with the rules masking its columns.
+type maskTable struct {
+	Schema string
+	Name   string
+	rules  []maskColumn
+}
+
+// maskColumn is a column of a table with its rule.
+type maskColumn struct {
+	name string
+	rule *MaskRule
+}
+
+// qualified returns the quoted schema qualified name of the table.
+func (t *maskTable) qualified() string {
+	return QuoteIdentifier(t.Schema) + "." + QuoteIdentifier(t.Name)
+}
+
+// columnType is the type of a column.
+type columnType struct {
+	name string
+	// category is the pg_type category, S for strings and N for numbers
+	category string
+	// length is the maximum length of a varchar or char, or 0
+	length int
+}
+
+// columnTypes returns the types of the columns of a table by name.
+func columnTypes(q queryer, t *maskTable) (map[string]*columnType, error) {
+	rows, err := q.Query(`SELECT a.attname, format_type(a.atttypid, NULL), ty.typcategory::text,
+	CASE WHEN a.atttypid IN ('varchar'::regtype, 'bpchar'::regtype) AND a.atttypmod > 4 THEN a.atttypmod - 4 ELSE 0 END
+FROM pg_attribute a JOIN pg_type ty ON ty.oid = a.atttypid
+WHERE a.attrelid = to_regclass($1) AND a.attnum > 0 AND NOT a.attisdropped`, t.qualified())
+	if err != nil {
+		return nil, fmt.Errorf("find columns of %v.%v: %v", t.Schema, t.Name, err)
+	}
+	defer rows.Close()
+
+	types := map[string]*columnType{}
+	for rows.Next() {
+		var col string
+		ct := &columnType{}
+		if err := rows.Scan(&col, &ct.name, &ct.category, &ct.length); err != nil {
+			return nil, fmt.Errorf("find columns of %v.%v: %v", t.Schema, t.Name, err)
+		}
+		types[col] = ct
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(types) == 0 {
+		return nil, fmt.Errorf("table %v.%v does not exist", t.Schema, t.Name)
+	}
+	return types, nil
+}
+
+// primaryKey returns the columns of the primary key of a table and their
+// types, in key order, or none when it has no primary key.
+func primaryKey(q queryer, t *maskTable) ([]string, []string, error) {
+	rows, err := q.Query(`SELECT a.attname, format_type(a.atttypid, a.atttypmod)
+FROM pg_index i JOIN pg_attribute a ON a.attrelid = i.indrelid AND a.attnum = ANY(i.indkey)
+WHERE i.indrelid = to_regclass($1) AND i.indisprimary
+ORDER BY array_position(i.indkey::int2[], a.attnum)`, t.qualified())
+	if err != nil {
+		return nil, nil, fmt.Errorf("find primary key of %v.%v: %v", t.Schema, t.Name, err)
+	}
+	defer rows.Close()
+
+	var cols, types []string
+	for rows.Next() {
+		var col, typ string
+		if err := rows.Scan(&col, &typ); err != nil {
+			return nil, nil, fmt.Errorf("find primary key of %v.%v: %v", t.Schema, t.Name, err)
+		}
+		cols = append(cols, col)
+		types = append(types, typ)
+	}
+	return cols, types, rows.Err()
+}
+
+// maskExpression returns the expression masking a column of a type, with the
+// column referred to as ref.
+func maskExpression(ref string, r *MaskRule, ct *columnType, salt string) (string, error) {
+	hash := fmt.Sprintf("encode(sha256(convert_to(%v || %v::text, 'UTF8')), 'hex')", QuoteLiteral(salt), ref)
+	text := ct.category == "S"
+
+	switch r.Strategy {
+	case MaskNull:
+		return "NULL", nil
+	case MaskConstant:
+		return QuoteLiteral(r.Value), nil
+	case MaskTruncate:
+		if !text {
+			return "", fmt.Errorf("truncate needs a text column, not %v", ct.name)
+		}
+		return fmt.Sprintf("left(%v, %d)", ref, r.Length), nil
+	case MaskFakeEmail:
+		if !text {
+			return "", fmt.Errorf("fake_email needs a text column, not %v", ct.name)
+		}
+		return fmt.Sprintf("'user_' || left(%v, 16) || '@example.com'", hash), nil
+	case MaskHash:
+		if text {
+			n := 64
+			if ct.length > 0 && ct.length < n {
+				n = ct.length
+			}
+			return fmt.Sprintf("left(%v, %d)", hash, n), nil
+		}
+		// 60 bits of the hash, within the range of the integer type
+		bits := fmt.Sprintf("('x' || left(%v, 15))::bit(60)::bigint", hash)
+		switch ct.name {
+		case "bigint":
+			return bits, nil
+		case "integer":
+			return fmt.Sprintf("(%v %% 2147483647)::integer", bits), nil
+		case "smallint":
+			return fmt.Sprintf("(%v %% 32767)::smallint", bits), nil
+		}
+		return "", fmt.Errorf("hash needs a text or integer column, not %v", ct.name)
+	}
+	return "", fmt.Errorf("unknown strategy %q", r.Strategy)
+}
+
+// mask masks the columns of the table in tx, BatchSize rows per UPDATE.
+func (t *maskTable) mask(tx *sql.Tx, salt string, o MaskOptions) (*MaskedTable, error) {
+	name := t.Schema + "." + t.Name
+	types, err := columnTypes(tx, t)
+	if err != nil {
+		return nil, err
+	}
+	keys, keyTypes, err := primaryKey(tx, t)
+	if err != nil {
+		return nil, err
+	}
+	isKey := map[string]bool{}
+	for _, k := range keys {
+		isKey[k] = true
+	}
+
+	var sets []string
+	for _, m := range t.rules {
+		ct, ok := types[m.name]
+		if !ok {
+			return nil, fmt.Errorf("column %v does not exist", m.rule.Column)
+		}
+		if isKey[m.name] {
+			return nil, fmt.Errorf("column %v is in the primary key of %v and cannot be masked", m.rule.Column, name)
+		}
+		expr, err := maskExpression("t."+QuoteIdentifier(m.name), m.rule, ct, salt)
+		if err != nil {
+			return nil, fmt.Errorf("column %v: %v", m.rule.Column, err)
+		}
+		sets = append(sets, fmt.Sprintf("%v = %v", QuoteIdentifier(m.name), expr))
+	}
+	set := strings.Join(sets, ", ")
+
+	p := &MaskedTable{Table: name}
+	progress := func() {
+		if o.Progress != nil {
+			o.Progress(&MaskedTable{p.Table, p.Rows, p.Done})
+		}
+	}
+
+	if len(keys) == 0 {
+		res, err := tx.Exec(fmt.Sprintf("UPDATE %v AS t SET %v", t.qualified(), set))
+		if err != nil {
+			return nil, fmt.Errorf("mask %v: %v", name, err)
+		}
+		p.Rows, _ = res.RowsAffected()
+		p.Done = true
+		progress()
+		return p, nil
+	}
+
+	var cols, batchCols, lastCols, descCols, params []string
+	for i, k := range keys {
+		q := QuoteIdentifier(k)
+		cols = append(cols, q)
+		batchCols = append(batchCols, "b."+q)
+		lastCols = append(lastCols, q+"::text")
+		descCols = append(descCols, q+" DESC")
+		params = append(params, fmt.Sprintf("$%d::%v", i+1, keyTypes[i]))
+	}
+	var tCols []string
+	for _, col := range cols {
+		tCols = append(tCols, "t."+col)
+	}
+	batch := func(where string) string {
+		return fmt.Sprintf(`WITH b AS (
+	SELECT %v FROM %v%v ORDER BY %v LIMIT %d
+), updated AS (
+	UPDATE %v AS t SET %v FROM b WHERE (%v) = (%v) RETURNING 1
+)
+SELECT (SELECT count(*) FROM updated), %v FROM b ORDER BY %v LIMIT 1`,
+			strings.Join(cols, ", "), t.qualified(), where, strings.Join(cols, ", "), o.BatchSize,
+			t.qualified(), set, strings.Join(tCols, ", "), strings.Join(batchCols, ", "),
+			strings.Join(lastCols, ", "), strings.Join(descCols, ", "))
+	}
+	first := batch("")
+	next := batch(fmt.Sprintf(" WHERE (%v) > (%v)", strings.Join(cols, ", "), strings.Join(params, ", ")))
+
+	var last []interface{}
+	for {
+		query := first
+		if last != nil {
+			query = next
+		}
+		var n int64
+		key := make([]string, len(keys))
+		dest := []interface{}{&n}
+		for i := range key {
+			dest = append(dest, &key[i])
+		}
+		err := tx.QueryRow(query, last...).Scan(dest...)
+		if err == sql.ErrNoRows {
+			break
+		}
+		if err != nil {
+			return p, fmt.Errorf("mask %v: %v", name, err)
+		}
+		p.Rows += n
+		progress()
+
+		last = nil
+		for _, k := range key {
+			last = append(last, k)
+		}
+	}
+	p.Done = true
+	progress()
+	return p, nil
+}
@@ -0,0 +1,138 @@
+package postgres
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestLoadMaskRules(t *testing.T) {
+	rules, err := LoadMaskRules(strings.NewReader(`salt: pepper
+rules:
+  - column: users.email
+    strategy: fake_email
+  - column: app.users.notes
+    strategy: truncate
+    length: 10
+  - column: users.phone
+    strategy: constant
+    value: "000"
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rules.Salt != "pepper" || len(rules.Rules) != 3 || rules.Rules[1].Length != 10 {
+		t.Errorf("Unexpected rules %#v", rules)
+	}
+
+	for _, invalid := range []string{
+		"rules: []",
+		"rules:\n  - column: email\n    strategy: hash",
+		"rules:\n  - column: users.email\n    strategy: scramble",
+		"rules:\n  - column: users.email\n    strategy: hash\n    value: x",
+		"rules:\n  - column: users.email\n    strategy: hash\n  - column: public.users.email\n    strategy: null",
+		"rules:\n  - column: users.email\n    strategy: hash\n    colour: red",
+	} {
+		if _, err := LoadMaskRules(strings.NewReader(invalid)); err == nil {
+			t.Errorf("Expected an error for %v", invalid)
+		}
+	}
+}
+
+func TestMaskExpression(t *testing.T) {
+	hash := `encode(sha256(convert_to('salt' || t."c"::text, 'UTF8')), 'hex')`
+	for _, tc := range []struct {
+		rule *MaskRule
+		typ  *columnType
+		x    string
+	}{
+		{&MaskRule{Strategy: MaskHash}, &columnType{"text", "S", 0}, "left(" + hash + ", 64)"},
+		{&MaskRule{Strategy: MaskHash}, &columnType{"character varying", "S", 20}, "left(" + hash + ", 20)"},
+		{&MaskRule{Strategy: MaskHash}, &columnType{"integer", "N", 0}, "(('x' || left(" + hash + ", 15))::bit(60)::bigint % 2147483647)::integer"},
+		{&MaskRule{Strategy: MaskFakeEmail}, &columnType{"text", "S", 0}, "'user_' || left(" + hash + ", 16) || '@example.com'"},
+		{&MaskRule{Strategy: MaskTruncate, Length: 3}, &columnType{"text", "S", 0}, `left(t."c", 3)`},
+		{&MaskRule{Strategy: MaskConstant, Value: "it's"}, &columnType{"text", "S", 0}, `'it''s'`},
+		{&MaskRule{Strategy: MaskNull}, &columnType{"date", "D", 0}, "NULL"},
+	} {
+		x, err := maskExpression(`t."c"`, tc.rule, tc.typ, "salt")
+		if err != nil {
+			t.Error(err)
+		} else if x != tc.x {
+			t.Errorf("Expected %v got %v", tc.x, x)
+		}
+	}
+
+	if _, err := maskExpression(`t."c"`, &MaskRule{Strategy: MaskHash}, &columnType{"date", "D", 0}, "salt"); err == nil {
+		t.Errorf("Expected an error hashing a date")
+	}
+}
+
+func TestMaskTable(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT a.attname, format_type(a.atttypid, NULL)")).WithArgs(`"public"."users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"attname", "type", "category", "length"}).
+			AddRow("id", "bigint", "N", 0).
+			AddRow("email", "text", "S", 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT a.attname, format_type(a.atttypid, a.atttypmod)")).WithArgs(`"public"."users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"attname", "type"}).AddRow("id", "bigint"))
+
+	update := `UPDATE "public"."users" AS t SET "email" = NULL FROM b WHERE (t."id") = (b."id") RETURNING 1`
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "public"."users" ORDER BY "id" LIMIT 2`) + ".*" + regexp.QuoteMeta(update)).
+		WillReturnRows(sqlmock.NewRows([]string{"count", "id"}).AddRow(2, "7"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "public"."users" WHERE ("id") > ($1::bigint) ORDER BY "id" LIMIT 2`)).WithArgs("7").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "id"}).AddRow(1, "9"))
+	mock.ExpectQuery(regexp.QuoteMeta(`WHERE ("id") > ($1::bigint)`)).WithArgs("9").
+		WillReturnRows(sqlmock.NewRows([]string{"count", "id"}))
+	mock.ExpectCommit()
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+	rules := &MaskRules{Salt: "salt", Rules: []*MaskRule{{Column: "users.email", Strategy: MaskNull}}}
+	masked, err := c.mask("", rules, MaskOptions{BatchSize: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(masked) != 1 || masked[0].Table != "public.users" || masked[0].Rows != 3 || !masked[0].Done {
+		t.Errorf("Expected 3 rows of public.users to be masked, got %#v", masked)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMaskRollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT a.attname, format_type(a.atttypid, NULL)")).WithArgs(`"public"."users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"attname", "type", "category", "length"}).AddRow("email", "text", "S", 0))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT a.attname, format_type(a.atttypid, a.atttypmod)")).WithArgs(`"public"."users"`).
+		WillReturnRows(sqlmock.NewRows([]string{"attname", "type"}))
+	mock.ExpectExec(regexp.QuoteMeta(`UPDATE "public"."users" AS t SET "email" = NULL`)).WillReturnResult(sqlmock.NewResult(0, 5))
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT a.attname, format_type(a.atttypid, NULL)")).WithArgs(`"public"."orders"`).
+		WillReturnRows(sqlmock.NewRows([]string{"attname", "type", "category", "length"}))
+	mock.ExpectRollback()
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+	rules := &MaskRules{Salt: "salt", Rules: []*MaskRule{
+		{Column: "users.email", Strategy: MaskNull},
+		{Column: "orders.note", Strategy: MaskNull},
+	}}
+	if masked, err := c.mask("", rules, MaskOptions{}); err == nil {
+		t.Errorf("Expected a missing table to fail, got %#v", masked)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
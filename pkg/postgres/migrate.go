@@ -0,0 +1,329 @@
+package postgres
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// migrationsTable is the table recording the applied migrations of a database.
+const migrationsTable = "dfm_schema_migrations"
+
+// migrationLock is the advisory lock held while migrations run, so only one
+// run applies migrations to a database at a time.
+const migrationLock int64 = 0x64666d6d696772
+
+// migrationFile matches migration file names, as in 0001_create_users.up.sql.
+var migrationFile = regexp.MustCompile(`^(\d+)_([A-Za-z0-9_-]+)\.(up|down)\.sql$`)
+
+// Migration is a versioned change to a database schema, with the SQL applying
+// it and the SQL undoing it.
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string
+	// Down is empty when the migration cannot be undone
+	Down string
+}
+
+// Checksum returns the SHA-256 of the up SQL, recorded when the migration is
+// applied so later changes to it are detected.
+func (m *Migration) Checksum() string {
+	sum := sha256.Sum256([]byte(m.Up))
+	return hex.EncodeToString(sum[:])
+}
+
+// String returns a string suitable for error messages.
+func (m *Migration) String() string {
+	return fmt.Sprintf("migration %d_%v", m.Version, m.Name)
+}
+
+// LoadMigrations loads the migrations in a directory, in version order. Each
+// migration is a VERSION_NAME.up.sql file and an optional VERSION_NAME.down.sql
+// file, as in 0001_create_users.up.sql. Other files are ignored.
+func LoadMigrations(dir string) ([]*Migration, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %v", err)
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, f := range files {
+		match := migrationFile.FindStringSubmatch(f.Name())
+		if f.IsDir() || match == nil {
+			continue
+		}
+		v, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migration %v: %v", f.Name(), err)
+		}
+		m, ok := byVersion[v]
+		if !ok {
+			m = &Migration{Version: v, Name: match[2]}
+			byVersion[v] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migrations %d_%v and %d_%v have the same version", v, m.Name, v, match[2])
+		}
+
+		b, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("read migrations: %v", err)
+		}
+		if match[3] == "up" {
+			m.Up = string(b)
+		} else {
+			m.Down = string(b)
+		}
+	}
+
+	var ms []*Migration
+	for _, m := range byVersion {
+		if m.Up == "" {
+			return nil, fmt.Errorf("%v has no up file", m)
+		}
+		ms = append(ms, m)
+	}
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Version < ms[j].Version })
+	return ms, nil
+}
+
+// AppliedMigration is a migration recorded as applied to a database.
+type AppliedMigration struct {
+	Version   int64     `json:"version"`
+	Name      string    `json:"name"`
+	Checksum  string    `json:"checksum"`
+	AppliedAt time.Time `json:"applied_at"`
+}
+
+// MigrationSet is a series of migrations for a database, applied as a user
+// such as the owner user of a database created by CreateDatabase, which acts
+// as the owner group so the objects the migrations create belong to it.
+type MigrationSet struct {
+	Database   string
+	As         *User
+	Migrations []*Migration
+	// Schema of the tracking table, defaults to public
+	Schema string
+}
+
+// MigrateUp applies the migrations of a set that have not been applied, in
+// version order, each in a transaction recording it in the tracking table, and
+// returns them. It fails before applying any when an applied migration is
+// missing from the set or has changed, or when a new migration is older than
+// the latest applied one.
+func (c *Conn) MigrateUp(s *MigrationSet) ([]*AppliedMigration, error) {
+	var applied []*AppliedMigration
+	err := c.withMigrations(s, func(m *migrator) (err error) {
+		applied, err = m.up()
+		return
+	})
+	return applied, err
+}
+
+// MigrateDown undoes the latest applied migrations of a set, up to steps of
+// them, in reverse version order, each in a transaction removing it from the
+// tracking table, and returns them.
+func (c *Conn) MigrateDown(s *MigrationSet, steps int) ([]*AppliedMigration, error) {
+	var reverted []*AppliedMigration
+	err := c.withMigrations(s, func(m *migrator) (err error) {
+		reverted, err = m.down(steps)
+		return
+	})
+	return reverted, err
+}
+
+// AppliedMigrations returns the migrations recorded as applied to the database
+// of a set, in version order.
+func (c *Conn) AppliedMigrations(s *MigrationSet) ([]*AppliedMigration, error) {
+	var applied []*AppliedMigration
+	err := c.withMigrations(s, func(m *migrator) (err error) {
+		applied, err = m.applied()
+		return
+	})
+	return applied, err
+}
+
+// withMigrations connects to the database of a set as its user and runs f
+// holding the migration lock, once the tracking table exists.
+func (c *Conn) withMigrations(s *MigrationSet, f func(*migrator) error) error {
+	c2, err := c.connect(s.Database, s.As)
+	if err != nil {
+		return err
+	}
+	defer c2.Close()
+
+	return c2.migrations(s, f)
+}
+
+// migrations runs f holding the migration lock on the connected database. The
+// lock is held by a session, so the migrator runs on a single connection.
+func (c *Conn) migrations(s *MigrationSet, f func(*migrator) error) error {
+	ctx := context.Background()
+	conn, err := c.DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", migrationLock).Scan(&locked); err != nil {
+		return fmt.Errorf("lock migrations: %v", err)
+	}
+	if !locked {
+		return fmt.Errorf("migrations of %v are running elsewhere", s.Database)
+	}
+	defer conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", migrationLock)
+
+	schema := s.Schema
+	if schema == "" {
+		schema = "public"
+	}
+	m := &migrator{ctx, conn, s, QuoteIdentifier(schema) + "." + QuoteIdentifier(migrationsTable)}
+	if _, err := conn.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %v (
+	version bigint PRIMARY KEY,
+	name text NOT NULL,
+	checksum text NOT NULL,
+	applied_at timestamptz NOT NULL DEFAULT now()
+)`, m.table)); err != nil {
+		return fmt.Errorf("create %v: %v", migrationsTable, err)
+	}
+	return f(m)
+}
+
+// migrator applies the migrations of a set on a connection holding the lock.
+type migrator struct {
+	ctx   context.Context
+	conn  *sql.Conn
+	set   *MigrationSet
+	table string
+}
+
+func (m *migrator) applied() ([]*AppliedMigration, error) {
+	rows, err := m.conn.QueryContext(m.ctx, fmt.Sprintf("SELECT version, name, checksum, applied_at FROM %v ORDER BY version", m.table))
+	if err != nil {
+		return nil, fmt.Errorf("list applied migrations: %v", err)
+	}
+	defer rows.Close()
+
+	var applied []*AppliedMigration
+	for rows.Next() {
+		a := &AppliedMigration{}
+		if err := rows.Scan(&a.Version, &a.Name, &a.Checksum, &a.AppliedAt); err != nil {
+			return nil, fmt.Errorf("list applied migrations: %v", err)
+		}
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
+
+// verified returns the applied migrations after checking each is in the set
+// unchanged.
+func (m *migrator) verified() ([]*AppliedMigration, map[int64]*Migration, error) {
+	applied, err := m.applied()
+	if err != nil {
+		return nil, nil, err
+	}
+	byVersion := map[int64]*Migration{}
+	for _, x := range m.set.Migrations {
+		byVersion[x.Version] = x
+	}
+	for _, a := range applied {
+		x, ok := byVersion[a.Version]
+		if !ok {
+			return nil, nil, fmt.Errorf("applied migration %d_%v is missing", a.Version, a.Name)
+		}
+		if x.Checksum() != a.Checksum {
+			return nil, nil, fmt.Errorf("%v has changed since it was applied", x)
+		}
+	}
+	return applied, byVersion, nil
+}
+
+func (m *migrator) up() ([]*AppliedMigration, error) {
+	applied, _, err := m.verified()
+	if err != nil {
+		return nil, err
+	}
+	done := map[int64]bool{}
+	var latest int64 = -1
+	for _, a := range applied {
+		done[a.Version] = true
+		latest = a.Version
+	}
+
+	var pending []*Migration
+	for _, x := range m.set.Migrations {
+		if done[x.Version] {
+			continue
+		}
+		if x.Version < latest {
+			return nil, fmt.Errorf("%v is older than applied migration %d", x, latest)
+		}
+		pending = append(pending, x)
+	}
+
+	var result []*AppliedMigration
+	for _, x := range pending {
+		a := &AppliedMigration{Version: x.Version, Name: x.Name, Checksum: x.Checksum()}
+		err := m.tx(x, x.Up, func(tx *sql.Tx) error {
+			return tx.QueryRowContext(m.ctx, fmt.Sprintf("INSERT INTO %v (version, name, checksum) VALUES ($1, $2, $3) RETURNING applied_at", m.table),
+				a.Version, a.Name, a.Checksum).Scan(&a.AppliedAt)
+		})
+		if err != nil {
+			return result, err
+		}
+		result = append(result, a)
+	}
+	return result, nil
+}
+
+func (m *migrator) down(steps int) ([]*AppliedMigration, error) {
+	applied, byVersion, err := m.verified()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*AppliedMigration
+	for i := len(applied) - 1; i >= 0 && len(result) < steps; i-- {
+		a := applied[i]
+		x := byVersion[a.Version]
+		if x.Down == "" {
+			return result, fmt.Errorf("%v has no down file", x)
+		}
+		err := m.tx(x, x.Down, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(m.ctx, fmt.Sprintf("DELETE FROM %v WHERE version = $1", m.table), a.Version)
+			return err
+		})
+		if err != nil {
+			return result, err
+		}
+		result = append(result, a)
+	}
+	return result, nil
+}
+
+// tx runs the SQL of a migration and records it in a transaction.
+func (m *migrator) tx(x *Migration, query string, record func(*sql.Tx) error) error {
+	tx, err := m.conn.BeginTx(m.ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(m.ctx, query); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("%v: %v", x, err)
+	}
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("record %v: %v", x, err)
+	}
+	return tx.Commit()
+}
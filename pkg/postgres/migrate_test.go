@@ -0,0 +1,160 @@
+package postgres
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+	"time"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "migrations")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v\n", err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, sql := range map[string]string{
+		"0002_add_email.up.sql":      "ALTER TABLE users ADD email text",
+		"0002_add_email.down.sql":    "ALTER TABLE users DROP email",
+		"0001_create_users.up.sql":   "CREATE TABLE users (id bigint)",
+		"0001_create_users.down.sql": "DROP TABLE users",
+		"README.md":                  "not a migration",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(sql), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ms, err := LoadMigrations(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 2 || ms[0].Version != 1 || ms[0].Name != "create_users" || ms[1].Down != "ALTER TABLE users DROP email" {
+		t.Errorf("Unexpected migrations %#v %#v", ms[0], ms[1])
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "0003_orphan.down.sql"), []byte("SELECT 1"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadMigrations(dir); err == nil {
+		t.Errorf("Expected an error for a migration without an up file")
+	}
+}
+
+func mockMigrations(t *testing.T, applied ...*Migration) (*Conn, sqlmock.Sqlmock) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_try_advisory_lock($1)")).WithArgs(migrationLock).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(true))
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE TABLE IF NOT EXISTS "public"."dfm_schema_migrations"`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	rows := sqlmock.NewRows([]string{"version", "name", "checksum", "applied_at"})
+	for _, m := range applied {
+		rows.AddRow(m.Version, m.Name, m.Checksum(), time.Now())
+	}
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT version, name, checksum, applied_at FROM "public"."dfm_schema_migrations" ORDER BY version`)).WillReturnRows(rows)
+
+	return &Conn{"dummy", 0, &User{"db-admin", dc}, db, Options{}}, mock
+}
+
+func TestMigrateUp(t *testing.T) {
+	m1 := &Migration{1, "create_users", "CREATE TABLE users (id bigint)", "DROP TABLE users"}
+	m2 := &Migration{2, "add_email", "ALTER TABLE users ADD email text", ""}
+	c, mock := mockMigrations(t, m1)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(m2.Up)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(regexp.QuoteMeta(`INSERT INTO "public"."dfm_schema_migrations" (version, name, checksum) VALUES ($1, $2, $3) RETURNING applied_at`)).
+		WithArgs(int64(2), "add_email", m2.Checksum()).
+		WillReturnRows(sqlmock.NewRows([]string{"applied_at"}).AddRow(time.Now()))
+	mock.ExpectCommit()
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_unlock($1)")).WithArgs(migrationLock).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var applied []*AppliedMigration
+	err := c.migrations(&MigrationSet{Database: "db", Migrations: []*Migration{m1, m2}}, func(m *migrator) (err error) {
+		applied, err = m.up()
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(applied) != 1 || applied[0].Version != 2 {
+		t.Errorf("Expected migration 2 to be applied, got %#v", applied)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMigrateUpChanged(t *testing.T) {
+	m1 := &Migration{1, "create_users", "CREATE TABLE users (id bigint)", ""}
+	c, mock := mockMigrations(t, m1)
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_unlock($1)")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	changed := &Migration{1, "create_users", "CREATE TABLE users (id bigint, name text)", ""}
+	err := c.migrations(&MigrationSet{Database: "db", Migrations: []*Migration{changed}}, func(m *migrator) error {
+		_, err := m.up()
+		return err
+	})
+	if err == nil || err.Error() != "migration 1_create_users has changed since it was applied" {
+		t.Errorf("Expected a changed migration error, got %v", err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMigrateDown(t *testing.T) {
+	m1 := &Migration{1, "create_users", "CREATE TABLE users (id bigint)", "DROP TABLE users"}
+	m2 := &Migration{2, "add_email", "ALTER TABLE users ADD email text", "ALTER TABLE users DROP email"}
+	c, mock := mockMigrations(t, m1, m2)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(m2.Down)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`DELETE FROM "public"."dfm_schema_migrations" WHERE version = $1`)).WithArgs(int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec(regexp.QuoteMeta("SELECT pg_advisory_unlock($1)")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	var reverted []*AppliedMigration
+	err := c.migrations(&MigrationSet{Database: "db", Migrations: []*Migration{m1, m2}}, func(m *migrator) (err error) {
+		reverted, err = m.down(1)
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != 2 {
+		t.Errorf("Expected migration 2 to be reverted, got %#v", reverted)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMigrationsLocked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT pg_try_advisory_lock($1)")).
+		WillReturnRows(sqlmock.NewRows([]string{"locked"}).AddRow(false))
+	c := &Conn{"dummy", 0, &User{"db-admin", dc}, db, Options{}}
+
+	err = c.migrations(&MigrationSet{Database: "db"}, func(m *migrator) error {
+		return fmt.Errorf("Expected no migrations to run")
+	})
+	if err == nil || err.Error() != "migrations of db are running elsewhere" {
+		t.Errorf("Expected a lock error, got %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// SSL modes supported by Options.
+const (
+	SSLDisable    = "disable"
+	SSLRequire    = "require"
+	SSLVerifyCA   = "verify-ca"
+	SSLVerifyFull = "verify-full"
+)
+
+// Options configures a connection to a Postgres server.
+type Options struct {
+	Host     string
+	Port     int
+	User     string
+	Password string
+	// Database to connect to, defaults to postgres
+	Database string
+	// SSLMode defaults to require. verify-ca and verify-full check the server
+	// certificate against SSLRootCert, or the RDS CA bundle when it is empty.
+	SSLMode     string
+	SSLRootCert string
+	// SSLCert and SSLKey are the files of a client certificate and its key
+	SSLCert         string
+	SSLKey          string
+	ConnectTimeout  time.Duration
+	ApplicationName string
+	// MaxOpenConns, MaxIdleConns and ConnMaxLifetime limit the connection
+	// pool, zero leaves the database/sql defaults
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+}
+
+// Open creates a new Conn with the supplied options.
+func Open(o Options) (*Conn, error) {
+	dsn, err := o.dsn()
+	if err != nil {
+		return nil, err
+	}
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	if o.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(o.MaxOpenConns)
+	}
+	if o.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(o.MaxIdleConns)
+	}
+	if o.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(o.ConnMaxLifetime)
+	}
+
+	return &Conn{o.Host, o.Port, &User{o.User, o.Password}, db, o}, nil
+}
+
+// connect opens a new Conn with the options of c as user u to a database,
+// or to the same database as c when database is empty.
+func (c *Conn) connect(database string, u *User) (*Conn, error) {
+	o := c.Options
+	o.Host, o.Port = c.Host, c.Port
+	o.User, o.Password = u.Name, u.Password
+	if database != "" {
+		o.Database = database
+	}
+	return Open(o)
+}
+
+// dsn returns the connection string for the options, with every value quoted.
+func (o Options) dsn() (string, error) {
+	params := map[string]string{
+		"host":    o.Host,
+		"port":    fmt.Sprint(o.Port),
+		"user":    o.User,
+		"dbname":  o.Database,
+		"sslmode": o.SSLMode,
+	}
+	if o.Password != "" {
+		params["password"] = o.Password
+	}
+	if params["dbname"] == "" {
+		params["dbname"] = "postgres"
+	}
+
+	switch o.SSLMode {
+	case "":
+		params["sslmode"] = SSLRequire
+	case SSLDisable, SSLRequire:
+	case SSLVerifyCA, SSLVerifyFull:
+		params["sslrootcert"] = o.SSLRootCert
+		if o.SSLRootCert == "" {
+			path, err := RDSRootCert()
+			if err != nil {
+				return "", err
+			}
+			params["sslrootcert"] = path
+		}
+	default:
+		return "", fmt.Errorf("unknown sslmode %v", o.SSLMode)
+	}
+
+	if (o.SSLCert == "") != (o.SSLKey == "") {
+		return "", fmt.Errorf("sslcert and sslkey must be set together")
+	}
+	if o.SSLCert != "" {
+		params["sslcert"] = o.SSLCert
+		params["sslkey"] = o.SSLKey
+	}
+	if o.ConnectTimeout > 0 {
+		// whole seconds, rounded up so a short timeout does not become none
+		params["connect_timeout"] = fmt.Sprint(int((o.ConnectTimeout + time.Second - 1) / time.Second))
+	}
+	if o.ApplicationName != "" {
+		params["application_name"] = o.ApplicationName
+	}
+
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = k + "=" + dsnValue(params[k])
+	}
+	return strings.Join(pairs, " "), nil
+}
+
+// dsnValue quotes a connection string value, escaping backslashes and single quotes.
+func dsnValue(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, `'`, `\'`, -1)
+	return `'` + s + `'`
+}
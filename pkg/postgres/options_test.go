@@ -0,0 +1,114 @@
+package postgres
+
+import (
+	"crypto/x509"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOptionsDSN(t *testing.T) {
+	testCases := []struct {
+		desc string
+		opts Options
+		dsn  string
+	}{
+		{
+			desc: "Defaults",
+			opts: Options{Host: "db.example.com", Port: 5432, User: "master", Password: "pw"},
+			dsn:  `dbname='postgres' host='db.example.com' password='pw' port='5432' sslmode='require' user='master'`,
+		},
+		{
+			desc: "Quotes",
+			opts: Options{Host: "h", Port: 5432, User: "master", Password: `it's a \ test`, Database: "db name"},
+			dsn:  `dbname='db name' host='h' password='it\'s a \\ test' port='5432' sslmode='require' user='master'`,
+		},
+		{
+			desc: "All",
+			opts: Options{
+				Host:            "h",
+				Port:            5432,
+				User:            "master",
+				Database:        "db",
+				SSLMode:         SSLVerifyFull,
+				SSLRootCert:     "/ca.pem",
+				SSLCert:         "/client.crt",
+				SSLKey:          "/client.key",
+				ConnectTimeout:  1500 * time.Millisecond,
+				ApplicationName: "dfm",
+			},
+			dsn: `application_name='dfm' connect_timeout='2' dbname='db' host='h' port='5432' sslcert='/client.crt' sslkey='/client.key' sslmode='verify-full' sslrootcert='/ca.pem' user='master'`,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			dsn, err := tC.opts.dsn()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dsn != tC.dsn {
+				t.Errorf("Expected %#v got %#v\n", tC.dsn, dsn)
+			}
+		})
+	}
+}
+
+func TestOptionsDSNInvalid(t *testing.T) {
+	testCases := []struct {
+		desc string
+		opts Options
+	}{
+		{desc: "SSL Mode", opts: Options{SSLMode: "sometimes"}},
+		{desc: "Cert Without Key", opts: Options{SSLCert: "/client.crt"}},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if dsn, err := tC.opts.dsn(); err == nil {
+				t.Errorf("Expected an error, got %#v", dsn)
+			}
+		})
+	}
+}
+
+func TestOptionsRDSRootCert(t *testing.T) {
+	defer func(v string) { os.Setenv(RDSCABundleEnv, v) }(os.Getenv(RDSCABundleEnv))
+	os.Setenv(RDSCABundleEnv, "/rds-ca.pem")
+
+	dsn, err := Options{Host: "h", Port: 5432, User: "u", SSLMode: SSLVerifyCA}.dsn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(dsn, "sslrootcert='/rds-ca.pem'") {
+		t.Errorf("Expected the RDS CA bundle as sslrootcert, got %v", dsn)
+	}
+}
+
+func TestRDSRootCertBuiltIn(t *testing.T) {
+	defer func(v string) { os.Setenv(RDSCABundleEnv, v) }(os.Getenv(RDSCABundleEnv))
+	defer func(v string) { os.Setenv("HOME", v) }(os.Getenv("HOME"))
+	os.Setenv(RDSCABundleEnv, "")
+	home, err := ioutil.TempDir("", "dfm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(home)
+	os.Setenv("HOME", home)
+
+	if rdsCABundle == "" {
+		t.Fatal("Expected a built in RDS CA bundle, run go generate ./pkg/postgres")
+	}
+	if !x509.NewCertPool().AppendCertsFromPEM([]byte(rdsCABundle)) {
+		t.Fatal("Expected the built in RDS CA bundle to parse into a cert pool")
+	}
+	path, err := RDSRootCert()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, err := ioutil.ReadFile(path); err != nil || string(b) != rdsCABundle {
+		t.Errorf("Expected the built in bundle at %v, got %v", path, err)
+	}
+}
@@ -0,0 +1,207 @@
+package postgres
+
+import (
+	"fmt"
+	"io"
+)
+
+// Reversible is a Sequence that can be undone. Revert returns the commands
+// undoing those of SQL, run in the same database, or none when there is
+// nothing to undo.
+type Reversible interface {
+	Sequence
+	Revert() []string
+}
+
+// Step is a series of Sequences run together in a database as a user.
+type Step struct {
+	Database string
+	As       *User
+	// Role is a role of which As is a member to act as, with SET LOCAL ROLE in
+	// the transaction of the step
+	Role *User
+	// NoTx runs the sequences outside a transaction, for commands such as
+	// CREATE DATABASE that cannot run in one
+	NoTx      bool
+	Sequences []Sequence
+}
+
+// Plan is a series of Steps, run in order by Conn.Run.
+type Plan struct {
+	Steps []*Step
+}
+
+// Reverse returns the plan undoing p: its steps in reverse order, each with
+// the reverts of its Reversible sequences in reverse order. Sequences that are
+// not Reversible, such as password changes and revocations from PUBLIC, are
+// left out, as are steps left without sequences.
+func (p *Plan) Reverse() *Plan {
+	r := &Plan{}
+	for i := len(p.Steps) - 1; i >= 0; i-- {
+		s := p.Steps[i]
+		var xs []Sequence
+		for j := len(s.Sequences) - 1; j >= 0; j-- {
+			if x, ok := s.Sequences[j].(Reversible); ok {
+				xs = append(xs, &reverted{x})
+			}
+		}
+		if len(xs) > 0 {
+			r.Steps = append(r.Steps, &Step{s.Database, s.As, s.Role, s.NoTx, xs})
+		}
+	}
+	return r
+}
+
+// Write writes the SQL of the plan, with a comment for each step and sequence.
+func (p *Plan) Write(w io.Writer) error {
+	return p.write(w, false)
+}
+
+// WriteScript writes the plan as a psql script, connecting to the database of
+// each step as its user and wrapping the steps run in a transaction in BEGIN
+// and COMMIT. The script stops at the first error, and psql asks for the
+// password of each user it connects as that is not in a password file.
+func (p *Plan) WriteScript(w io.Writer) error {
+	if _, err := fmt.Fprintf(w, "\\set ON_ERROR_STOP on\n"); err != nil {
+		return err
+	}
+	return p.write(w, true)
+}
+
+func (p *Plan) write(w io.Writer, script bool) error {
+	for _, s := range p.Steps {
+		tx := ", in a transaction"
+		if s.NoTx {
+			tx = ""
+		}
+		as := s.As.Name
+		if s.Role != nil {
+			as += " acting as " + s.Role.Name
+		}
+		if _, err := fmt.Fprintf(w, "-- on %v as %v%v\n", s.Database, as, tx); err != nil {
+			return err
+		}
+		if script {
+			if _, err := fmt.Fprintf(w, "\\connect %v %v\n", QuoteIdentifier(s.Database), QuoteIdentifier(s.As.Name)); err != nil {
+				return err
+			}
+			if !s.NoTx {
+				if _, err := fmt.Fprintf(w, "BEGIN;\n"); err != nil {
+					return err
+				}
+			}
+			if s.Role != nil {
+				if _, err := fmt.Fprintf(w, "%v;\n", (&localRole{s.Role}).SQL()[0]); err != nil {
+					return err
+				}
+			}
+		}
+		for _, x := range s.Sequences {
+			if _, err := fmt.Fprintf(w, "-- %v\n", x); err != nil {
+				return err
+			}
+			for _, sql := range x.SQL() {
+				if err := checkNUL(x, sql); err != nil {
+					return err
+				}
+				if _, err := fmt.Fprintf(w, "%v;\n", sql); err != nil {
+					return err
+				}
+			}
+		}
+		if script && !s.NoTx {
+			if _, err := fmt.Fprintf(w, "COMMIT;\n"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Run runs the steps of a plan in order. When a step fails, the steps already
+// run are undone with the reverse plan.
+func (c *Conn) Run(p *Plan) error {
+	for i, s := range p.Steps {
+		if err := c.runStep(s); err != nil {
+			done := &Plan{p.Steps[:i]}
+			for _, r := range done.Reverse().Steps {
+				if rerr := c.runStep(r); rerr != nil {
+					return fmt.Errorf("%v, rollback: %v", err, rerr)
+				}
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// runStep runs a step, on c when it is connected to the step database as the
+// step user and on a new connection otherwise.
+func (c *Conn) runStep(s *Step) error {
+	conn := c
+	if s.Database != c.database() || s.As.Name != c.User.Name {
+		var err error
+		conn, err = c.connect(s.Database, s.As)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+	}
+
+	if s.Role != nil {
+		if s.NoTx {
+			return fmt.Errorf("acting as %v needs a transaction", s.Role.Name)
+		}
+		return conn.ExecTx(append([]Sequence{&localRole{s.Role}}, s.Sequences...)...)
+	}
+	if s.NoTx {
+		return conn.Exec(s.Sequences...)
+	}
+	return conn.ExecTx(s.Sequences...)
+}
+
+// database returns the name of the database c is connected to.
+func (c *Conn) database() string {
+	if c.Options.Database == "" {
+		return "postgres"
+	}
+	return c.Options.Database
+}
+
+// reverted is the revert of a Reversible as a Sequence.
+type reverted struct {
+	x Reversible
+}
+
+// SQL returns the commands undoing the reverted sequence.
+func (r *reverted) SQL() []string {
+	return r.x.Revert()
+}
+
+// String returns a string suitable for error messages.
+func (r *reverted) String() string {
+	return fmt.Sprintf("revert %v", r.x)
+}
+
+// localRole is a change of the current role for the rest of a transaction.
+type localRole struct {
+	Role *User
+}
+
+// SQL returns the command to change the role.
+func (l *localRole) SQL() []string {
+	return []string{
+		fmt.Sprintf("SET LOCAL ROLE %v", QuoteIdentifier(l.Role.Name)),
+	}
+}
+
+// String returns a string suitable for error messages.
+func (l *localRole) String() string {
+	return fmt.Sprintf("act as %v", l.Role.Name)
+}
+
+// kept is a Sequence applied to objects that existed before, which is not
+// undone with them.
+type kept struct {
+	Sequence
+}
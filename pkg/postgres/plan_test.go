@@ -0,0 +1,139 @@
+package postgres
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// provisioning sequences are all undone by their plans
+var (
+	_ Reversible = &Database{}
+	_ Reversible = &User{}
+	_ Reversible = &GroupRole{}
+	_ Reversible = &GrantRoles{}
+	_ Reversible = &SetRole{}
+	_ Reversible = &GrantAdmin{}
+	_ Reversible = &GrantOwner{}
+	_ Reversible = &GrantRole{}
+	_ Reversible = &Schema{}
+	_ Reversible = &ConnectionLimit{}
+	_ Reversible = &DatabaseConnectionLimit{}
+	_ Reversible = &RoleSetting{}
+	_ Reversible = &Extension{}
+	_ Reversible = &ActiveUser{}
+)
+
+func TestPlanReverse(t *testing.T) {
+	master := &User{"master", dc}
+	u := &User{"db-writer", dc}
+	g := &User{Name: "db_write"}
+	p := &Plan{[]*Step{
+		{"postgres", master, nil, true, []Sequence{&Database{"db"}}},
+		{"postgres", master, nil, false, []Sequence{
+			&RevokeAllPublic{&Database{"db"}, nil},
+			&GroupRole{g},
+			u,
+			&kept{&GrantRoles{[]*User{g}, u}},
+			&ConnectionLimit{u, 5},
+		}},
+		{"db", master, nil, false, []Sequence{&RevokeAllPublic{&Database{"db"}, nil}}},
+	}}
+
+	r := p.Reverse()
+	if len(r.Steps) != 2 {
+		t.Fatalf("Expected 2 steps, got %d", len(r.Steps))
+	}
+	if r.Steps[0].NoTx || !r.Steps[1].NoTx {
+		t.Errorf("Expected the reverted steps to keep their transactions")
+	}
+
+	var ss []string
+	for _, x := range r.Steps[0].Sequences {
+		ss = append(ss, x.SQL()...)
+	}
+	x := []string{
+		`ALTER ROLE "db-writer" CONNECTION LIMIT -1`,
+		`GRANT "db-writer" TO CURRENT_USER`,
+		`REASSIGN OWNED BY "db-writer" TO CURRENT_USER`,
+		`DROP OWNED BY "db-writer"`,
+		`DROP USER IF EXISTS "db-writer"`,
+		`GRANT "db_write" TO CURRENT_USER`,
+		`REASSIGN OWNED BY "db_write" TO CURRENT_USER`,
+		`DROP OWNED BY "db_write"`,
+		`DROP ROLE IF EXISTS "db_write"`,
+	}
+	if strings.Join(ss, "\n") != strings.Join(x, "\n") {
+		t.Errorf("Expected %#v got %#v\n", x, ss)
+	}
+
+	if ss := r.Steps[1].Sequences[0].SQL(); len(ss) != 2 || ss[1] != `DROP DATABASE IF EXISTS "db"` {
+		t.Errorf("Expected the database to be dropped, got %#v", ss)
+	}
+}
+
+func TestPlanWrite(t *testing.T) {
+	p := &Plan{[]*Step{
+		{"postgres", &User{"master", dc}, nil, true, []Sequence{&Database{"db"}}},
+		{"db", &User{"db-admin", dc}, nil, false, []Sequence{&Schema{"app"}}},
+	}}
+
+	var b bytes.Buffer
+	if err := p.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	x := `-- on postgres as master
+-- create database db
+CREATE DATABASE "db";
+-- on db as db-admin, in a transaction
+-- create schema app
+CREATE SCHEMA IF NOT EXISTS "app";
+`
+	if b.String() != x {
+		t.Errorf("Expected %v got %v", x, b.String())
+	}
+}
+
+func TestRunRollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`CREATE ROLE "db_write" NOLOGIN`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER ROLE "db-writer" SET ROLE "db_write"`)).WillReturnError(fmt.Errorf("permission denied"))
+	mock.ExpectRollback()
+
+	mock.ExpectBegin()
+	for _, ex := range []string{
+		`GRANT "db_write" TO CURRENT_USER`,
+		`REASSIGN OWNED BY "db_write" TO CURRENT_USER`,
+		`DROP OWNED BY "db_write"`,
+		`DROP ROLE IF EXISTS "db_write"`,
+	} {
+		mock.ExpectExec(regexp.QuoteMeta(ex)).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectCommit()
+
+	master := &User{"master", dc}
+	c := &Conn{"dummy", 0, master, db, Options{}}
+
+	p := &Plan{[]*Step{
+		{"postgres", master, nil, false, []Sequence{&GroupRole{&User{Name: "db_write"}}}},
+		{"postgres", master, nil, false, []Sequence{&SetRole{&User{Name: "db-writer"}, &User{Name: "db_write"}}}},
+	}}
+	if err := c.Run(p); err == nil {
+		t.Errorf("Expected an error")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
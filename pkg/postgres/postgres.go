@@ -2,51 +2,96 @@
 //
 // Example:
 // conn, err := NewConn(5432, "host", "user", "password")
+// conn, err := Open(Options{Host: "host", Port: 5432, User: "user", Password: "password", SSLMode: SSLVerifyFull})
 // err := conn.CreateDatabase("foobaz")
 //
 package postgres
 
 import (
-	"crypto/rand"
 	"database/sql"
 	"fmt"
 	"strings"
-	"unicode"
 	"unicode/utf8"
 
+	"github.com/MYOB-Technology/dataform/pkg/password"
 	_ "github.com/lib/pq"
 )
 
 // DatabaseDescriptor describes a created database.
 type DatabaseDescriptor struct {
-	Host     string
-	Port     int
-	Database *Database
-	Admin    *User
-	Writer   *User
-	Reader   *User
+	Host     string    `json:"host"`
+	Port     int       `json:"port"`
+	Database *Database `json:"database"`
+	Admin    *User     `json:"admin,omitempty"`
+	Writer   *User     `json:"writer,omitempty"`
+	Reader   *User     `json:"reader,omitempty"`
+	// Users of template roles other than admin, writer, and reader
+	Users []*User `json:"users,omitempty"`
+}
+
+// AllUsers returns the users of a database.
+func (dd *DatabaseDescriptor) AllUsers() []*User {
+	var users []*User
+	for _, u := range []*User{dd.Admin, dd.Writer, dd.Reader} {
+		if u != nil {
+			users = append(users, u)
+		}
+	}
+	return append(users, dd.Users...)
+}
+
+// setUser sets the user of a template role.
+func (dd *DatabaseDescriptor) setUser(suffix string, u *User) {
+	switch suffix {
+	case "admin":
+		dd.Admin = u
+	case "writer":
+		dd.Writer = u
+	case "reader":
+		dd.Reader = u
+	default:
+		dd.Users = append(dd.Users, u)
+	}
+}
+
+// templateUsers returns the users of a database in the order of the roles of
+// the template it was created from, nil for users it does not have.
+func (dd *DatabaseDescriptor) templateUsers(t *Template) []*User {
+	var users []*User
+	other := 0
+	for _, r := range t.Roles {
+		var u *User
+		switch r.Suffix {
+		case "admin":
+			u = dd.Admin
+		case "writer":
+			u = dd.Writer
+		case "reader":
+			u = dd.Reader
+		default:
+			if other < len(dd.Users) {
+				u = dd.Users[other]
+			}
+			other++
+		}
+		users = append(users, u)
+	}
+	return users
 }
 
 // Conn is a connection to a Postgres server.
 type Conn struct {
-	Host string
-	Port int
-	User *User
-	DB   *sql.DB
+	Host    string
+	Port    int
+	User    *User
+	DB      *sql.DB
+	Options Options
 }
 
-// NewConn creates a new Conn with the supplied host and user details.
+// NewConn creates a new Conn with the supplied host and user details, to the
+// postgres database with sslmode require. Use Open for other options.
 func NewConn(port int, host, user, password string) (*Conn, error) {
-	dsn := fmt.Sprintf(
-		"user=%v password='%v' host=%v port=%v database=postgres sslmode=require",
-		user, password, host, port)
-
-	db, err := sql.Open("postgres", dsn)
-	if err != nil {
-		return nil, err
-	}
-
-	return &Conn{host, port, &User{user, password}, db}, nil
+	return Open(Options{Host: host, Port: port, User: user, Password: password})
 }
 
 // Close closes the Conn.
@@ -55,10 +100,37 @@ func (c *Conn) Close() error {
 }
 
 // Exec execs a a series of Sequence objects against the connection.
-func (c *Conn) Exec(xs ...Sequence) (err error) {
+func (c *Conn) Exec(xs ...Sequence) error {
+	return execSequences(c.DB, xs)
+}
+
+// ExecTx execs a series of Sequence objects in a transaction, so either all of
+// them take effect or none do. Some commands, such as CREATE DATABASE, cannot
+// run in a transaction and must use Exec.
+func (c *Conn) ExecTx(xs ...Sequence) error {
+	tx, err := c.DB.Begin()
+	if err != nil {
+		return err
+	}
+	if err := execSequences(tx, xs); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx.
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+func execSequences(e execer, xs []Sequence) (err error) {
 	for _, x := range xs {
 		for _, s := range x.SQL() {
-			_, err = c.DB.Exec(s)
+			if err = checkNUL(x, s); err != nil {
+				return err
+			}
+			_, err = e.Exec(s)
 			if err != nil {
 				return fmt.Errorf("%v: %v", x.String(), err)
 			}
@@ -67,58 +139,447 @@ func (c *Conn) Exec(xs ...Sequence) (err error) {
 	return
 }
 
-// CreateDatabase creates a named database and owner, writer, and reader users.
-// The name will be truncated to 63 bytes, and then again to 56 bytes for the
-// generated user names.
-func (c *Conn) CreateDatabase(name string) (dd *DatabaseDescriptor, err error) {
+// CreateDatabase creates a named database with admin, write, and read group
+// roles and owner, writer, and reader users in them, from DefaultTemplate. The
+// groups hold privileges on schemas, or on public when there are none, and the
+// schemas are owned by the admin group. The name will be truncated to 63 bytes,
+// and then again to 56 bytes for the generated role names.
+func (c *Conn) CreateDatabase(name string, schemas ...string) (*DatabaseDescriptor, error) {
+	return c.CreateDatabaseFromTemplate(name, DefaultTemplate.WithSchemas(schemas...), false)
+}
+
+// CreateDatabaseFromTemplate creates a named database and a NOLOGIN group role
+// holding the privileges of each role of a template, with a login user in each
+// group. The owner user acts as the owner group, so objects it creates belong to
+// the group. The name will be truncated to 63 bytes, and then again to fit the
+// generated role names.
+//
+// It may be rerun: an existing database is kept and the grants are applied
+// again. Existing users keep their passwords and are returned without one,
+// unless rotate is set, in which case they get new passwords once every other
+// step has succeeded. It runs the plan of PlanCreateDatabase, so when a step
+// fails the database and roles created by this call are dropped again.
+func (c *Conn) CreateDatabaseFromTemplate(name string, t *Template, rotate bool) (*DatabaseDescriptor, error) {
+	dd, p, err := c.planCreateDatabase(name, t, true, rotate)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Run(p); err != nil {
+		return nil, err
+	}
+	return dd, nil
+}
+
+// PlanCreateDatabase returns the plan CreateDatabaseFromTemplate runs for a
+// database, without running it. Passwords are shown as ********, they are
+// generated when the database is created. The reverse of the plan undoes it.
+func (c *Conn) PlanCreateDatabase(name string, t *Template, rotate bool) (*Plan, error) {
+	_, p, err := c.planCreateDatabase(name, t, false, rotate)
+	return p, err
+}
+
+// planCreateDatabase returns a descriptor of a database and the plan creating
+// it. Passwords are generated and sent as verifiers when generate is set, and
+// are placeholders otherwise. Existing users are left without a password in
+// the descriptor unless rotate is set.
+func (c *Conn) planCreateDatabase(name string, t *Template, generate, rotate bool) (*DatabaseDescriptor, *Plan, error) {
+	if err := t.Validate(); err != nil {
+		return nil, nil, err
+	}
+	t = t.withDefaultSchemas()
+	dd, ps := provisions(name, t)
+	dd.Host, dd.Port = c.Host, c.Port
+	name = dd.Database.Name
+
+	var names []string
+	for _, p := range ps {
+		names = append(names, p.user.Name, p.group.Name)
+	}
+	s := &databaseState{existing: map[string]bool{}, tables: map[string][]string{}, rotate: rotate}
+	var err error
+	if s.exists, err = c.databaseExists(name); err != nil {
+		return nil, nil, err
+	}
+	users, err := c.existingUsers(names...)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, u := range users {
+		s.existing[u.Name] = true
+	}
+
+	method := ""
+	if generate {
+		if method, err = c.PasswordEncryption(); err != nil {
+			return nil, nil, err
+		}
+		pw, err := genPasswords(len(ps), 30)
+		if err != nil {
+			return nil, nil, err
+		}
+		for i, p := range ps {
+			p.user.Password = pw[i]
+		}
+	}
+	for _, p := range ps {
+		if s.existing[p.user.Name] && !rotate {
+			p.user.Password = ""
+		}
+	}
+
+	if s.exists {
+		cm, err := c.connect(name, c.User)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer cm.Close()
+		if s.tables, err = cm.roleTables(ps); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	p, err := createDatabasePlan(c.database(), c.User, dd.Database, t, ps, s, method)
+	if err != nil {
+		return nil, nil, err
+	}
+	return dd, p, nil
+}
+
+// provisions returns a descriptor of a database created from a template, with
+// placeholder passwords, and the users and group roles of its roles. The name
+// will be truncated to 63 bytes. The template must be valid.
+func provisions(name string, t *Template) (*DatabaseDescriptor, []provision) {
 	name = truncateBytes(name, 63)
-	uname := truncateBytes(name, 56) // 63 - 7 to fit user names
+	dd := &DatabaseDescriptor{Database: &Database{name}}
+	var ps []provision
+	for _, r := range t.Roles {
+		u := &User{userName(name, r.Suffix), "********"}
+		g := &User{Name: groupName(name, r.group())}
+		dd.setUser(r.Suffix, u)
+		ps = append(ps, provision{r, u, g})
+	}
+	return dd, ps
+}
+
+// databaseState is what a plan creating a database finds on the server.
+type databaseState struct {
+	exists bool
+	// existing users and group roles by name
+	existing map[string]bool
+	// tables of each role that exist, by role suffix
+	tables map[string][]string
+	// rotate sets new passwords on the existing users
+	rotate bool
+}
+
+// fresh reports whether a sequence on roles undoes with the plan: when the
+// database is new, or when one of the roles is.
+func (s *databaseState) fresh(roles ...*User) bool {
+	if !s.exists {
+		return true
+	}
+	for _, r := range roles {
+		if !s.existing[r.Name] {
+			return true
+		}
+	}
+	return false
+}
+
+// createDatabasePlan returns the plan creating a database from a template and
+// its provisions, run by master from the maintenance database. Passwords are
+// sent as verifiers for the encryption method, or as they are without one.
+//
+// Sequences on the database and roles that existed before are kept, so the
+// reverse of the plan only undoes what the plan creates. The passwords of
+// existing users are set last, in one transaction, and only when rotating.
+func createDatabasePlan(maintenance string, master *User, d *Database, t *Template, ps []provision, s *databaseState, method string) (*Plan, error) {
+	owner := ps[0]
+	for _, p := range ps {
+		if p.role.Owner {
+			owner = p
+		}
+	}
 
-	pw, err := genPasswords(3, 30)
+	roleSeqs, passwords, err := createRoleSequences(d, ps, s.existing, method, s.rotate, s.fresh)
 	if err != nil {
-		return
+		return nil, err
+	}
+
+	// the owner group creates the schemas so it owns them and the objects in
+	// them, by way of the owner user when it is new, or of the master user
+	// otherwise, as the password of an existing owner user is not known.
+	// Schema privileges are granted inside the database, by the master user
+	// and then by the owner group for the objects it owns.
+	as, role := owner.user, (*User)(nil)
+	if s.existing[owner.user.Name] {
+		as, role = master, owner.group
+		roleSeqs = append(roleSeqs, &kept{&GrantRoles{[]*User{owner.group}, master}})
+	}
+	var schemas, limit []Sequence
+	for _, sc := range t.schemas() {
+		schemas = append(schemas, keepUnless(&Schema{sc}, s.fresh()))
+	}
+	if t.ConnectionLimit != nil {
+		limit = append(limit, keepUnless(&DatabaseConnectionLimit{d, *t.ConnectionLimit}, s.fresh()))
+	}
+
+	p := &Plan{}
+	if !s.exists {
+		p.Steps = append(p.Steps, &Step{maintenance, master, nil, true, []Sequence{d}})
+	}
+	p.Steps = append(p.Steps,
+		&Step{maintenance, master, nil, false, append(roleSeqs, limit...)},
+		&Step{d.Name, as, role, false, schemas},
+		&Step{d.Name, master, nil, false, []Sequence{
+			&RevokeAllPublic{d, t.schemas()},
+			keepUnless(&GrantOwner{t.schemas(), owner.group}, s.fresh(owner.group)),
+		}},
+		&Step{d.Name, as, role, false, grantSequences(d, ps, s.tables, s.fresh)},
+	)
+	if len(passwords) > 0 {
+		p.Steps = append(p.Steps, &Step{maintenance, master, nil, false, passwords})
+	}
+	return p, nil
+}
+
+// keepUnless returns x, or x kept when the plan does not undo it.
+func keepUnless(x Sequence, undo bool) Sequence {
+	if undo {
+		return x
 	}
+	return &kept{x}
+}
+
+// provision pairs a role of a template with its user and group role.
+type provision struct {
+	role  *RoleTemplate
+	user  *User
+	group *User
+}
 
-	dd = &DatabaseDescriptor{
-		Host:     c.Host,
-		Port:     c.Port,
-		Database: &Database{name},
-		Admin:    &User{uname + "-admin", pw[0]},
-		Writer:   &User{uname + "-writer", pw[1]},
-		Reader:   &User{uname + "-reader", pw[2]},
+// DropDatabase drops a named database created by CreateDatabase along with its
+// owner, writer, and reader users and their alternates. Other connections to the
+// database are terminated, and objects the users own elsewhere are reassigned to
+// the Conn user.
+func (c *Conn) DropDatabase(name string) error {
+	return c.DropDatabaseFromTemplate(name, DefaultTemplate)
+}
+
+// DropDatabaseFromTemplate drops a named database created from a template along
+// with the users of its roles and their alternates, and then its group roles.
+// Users added to the groups with AddUser are dropped as members. It runs the
+// plan of PlanDropDatabase.
+func (c *Conn) DropDatabaseFromTemplate(name string, t *Template) error {
+	p, err := c.PlanDropDatabase(name, t)
+	if err != nil {
+		return err
 	}
+	return c.Run(p)
+}
 
-	err = c.execCreateDatabase(dd)
+// PlanDropDatabase returns the plan DropDatabaseFromTemplate runs for a
+// database, without running it. It is the reverse of creating the existing
+// roles of the database and then the database, so the database and every grant
+// inside it go first.
+func (c *Conn) PlanDropDatabase(name string, t *Template) (*Plan, error) {
+	name = truncateBytes(name, 63)
+
+	var names []string
+	for _, r := range t.Roles {
+		names = append(names, userName(name, r.Suffix), alternateName(name, r.Suffix))
+	}
+	users, err := c.existingUsers(names...)
 	if err != nil {
-		return
+		return nil, err
+	}
+
+	// users added with AddUser, found among the group members by name so
+	// members added by other means are left alone
+	var groups []*User
+	for _, r := range t.Roles {
+		g := &User{Name: groupName(name, r.group())}
+		found, err := c.existingUsers(g.Name)
+		if err != nil {
+			return nil, err
+		}
+		if len(found) == 0 {
+			continue
+		}
+		groups = append(groups, g)
+
+		members, err := c.groupMembers(g)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range members {
+			if addedNumber(name, r.group(), m.Name) > 0 {
+				users = append(users, m)
+			}
+		}
 	}
 
-	c2, err := NewConn(c.Port, c.Host, dd.Admin.Name, dd.Admin.Password)
+	var roles []Sequence
+	for _, g := range groups {
+		roles = append(roles, &GroupRole{g})
+	}
+	for _, u := range users {
+		roles = append(roles, u)
+	}
+	created := &Plan{[]*Step{
+		{c.database(), c.User, nil, true, roles},
+		{c.database(), c.User, nil, true, []Sequence{&Database{name}}},
+	}}
+	return created.Reverse(), nil
+}
+
+// databaseExists reports whether a database exists on the server.
+func (c *Conn) databaseExists(name string) (bool, error) {
+	var exists bool
+	err := c.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)", name).Scan(&exists)
 	if err != nil {
-		return
+		return false, fmt.Errorf("find database %v: %v", name, err)
 	}
+	return exists, nil
+}
 
-	err = c2.execCreateDatabaseUserPrivs(dd)
-	return
+// existingUsers returns the users among names that exist on the server.
+func (c *Conn) existingUsers(names ...string) ([]*User, error) {
+	var users []*User
+	for _, name := range names {
+		var exists bool
+		err := c.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)", name).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("find user %v: %v", name, err)
+		}
+		if exists {
+			users = append(users, &User{Name: name})
+		}
+	}
+	return users, nil
+}
+
+// groupMembers returns the login users that are members of a group role.
+func (c *Conn) groupMembers(group *User) ([]*User, error) {
+	rows, err := c.DB.Query(`SELECT u.rolname
+FROM pg_auth_members m
+	JOIN pg_roles g ON g.oid = m.roleid
+	JOIN pg_roles u ON u.oid = m.member
+WHERE g.rolname = $1 AND u.rolcanlogin
+ORDER BY 1`, group.Name)
+	if err != nil {
+		return nil, fmt.Errorf("find members of %v: %v", group.Name, err)
+	}
+	defer rows.Close()
+
+	var users []*User
+	for rows.Next() {
+		u := &User{}
+		if err := rows.Scan(&u.Name); err != nil {
+			return nil, fmt.Errorf("find members of %v: %v", group.Name, err)
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// createRoleSequences returns the sequences creating the group roles and users
+// of a database that are not in existing, adding the users to their groups,
+// granting admin to the owner group, and setting connection limits and
+// settings, and, when rotate is set, the sequences setting new passwords on the
+// users in existing. The passwords are sent as verifiers for the encryption
+// method, or as they are without one. Sequences on roles that fresh reports
+// false for are kept.
+func createRoleSequences(d *Database, ps []provision, existing map[string]bool, method string, rotate bool, fresh func(...*User) bool) ([]Sequence, []Sequence, error) {
+	xs := []Sequence{&RevokeAllPublic{d, nil}}
+	var passwords []Sequence
+	for _, p := range ps {
+		if !existing[p.group.Name] {
+			xs = append(xs, &GroupRole{p.group})
+		}
+		v := p.user
+		if method != "" && (rotate || !existing[p.user.Name]) {
+			var err error
+			if v, err = encrypted(method, p.user); err != nil {
+				return nil, nil, err
+			}
+		}
+		if !existing[p.user.Name] {
+			xs = append(xs, v)
+		} else if rotate {
+			passwords = append(passwords, &Password{v})
+		}
+		xs = append(xs, keepUnless(&GrantRoles{[]*User{p.group}, p.user}, fresh(p.user, p.group)))
+		if p.role.Owner {
+			xs = append(xs,
+				keepUnless(&GrantAdmin{d, p.group, nil}, fresh(p.group)),
+				keepUnless(&SetRole{p.user, p.group}, fresh(p.user)))
+		}
+		settings, err := userSettings(p.user, p.role)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, x := range settings {
+			xs = append(xs, keepUnless(x, fresh(p.user)))
+		}
+	}
+	return xs, passwords, nil
+}
+
+// grantSequences returns the sequences granting the privileges of each role,
+// except the owner's, to its group, on the tables of the role that exist.
+// They run as the owner group in the database. Sequences on groups that fresh
+// reports false for are kept.
+func grantSequences(d *Database, ps []provision, tables map[string][]string, fresh func(...*User) bool) []Sequence {
+	var owner *User
+	for _, p := range ps {
+		if p.role.Owner {
+			owner = p.group
+		}
+	}
+
+	xs := []Sequence{&RevokeAllPublic{d, nil}}
+	for _, p := range ps {
+		if p.role.Owner {
+			continue
+		}
+		xs = append(xs, keepUnless(&GrantRole{d, p.role, p.group, owner, tables[p.role.Suffix]}, fresh(p.group)))
+	}
+	return xs
 }
 
-func (c *Conn) execCreateDatabase(dd *DatabaseDescriptor) error {
-	return c.Exec(
-		dd.Database,
-		&RevokeAllPublic{dd.Database},
-		dd.Admin,
-		&GrantAdmin{dd.Database, dd.Admin},
-		dd.Writer,
-		dd.Reader)
+// roleTables returns the tables of each role that exist in the connected
+// database, by role suffix.
+func (c *Conn) roleTables(ps []provision) (map[string][]string, error) {
+	tables := map[string][]string{}
+	for _, p := range ps {
+		if p.role.Owner {
+			continue
+		}
+		t, err := c.existingTables(p.role.tables()...)
+		if err != nil {
+			return nil, err
+		}
+		tables[p.role.Suffix] = t
+	}
+	return tables, nil
 }
 
-func (c *Conn) execCreateDatabaseUserPrivs(dd *DatabaseDescriptor) error {
-	return c.Exec(
-		&RevokeAllPublic{dd.Database},
-		&GrantAccess{dd.Database, dd.Writer},
-		&GrantWrite{dd.Writer},
-		&GrantAccess{dd.Database, dd.Reader},
-		&GrantRead{dd.Reader})
+// existingTables returns the schema qualified tables among names that exist in
+// the connected database.
+func (c *Conn) existingTables(names ...string) ([]string, error) {
+	var tables []string
+	for _, name := range names {
+		var exists bool
+		err := c.DB.QueryRow("SELECT to_regclass($1) IS NOT NULL", qualifiedName(name)).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("find table %v: %v", name, err)
+		}
+		if exists {
+			tables = append(tables, name)
+		}
+	}
+	return tables, nil
 }
 
 type Sequence interface {
@@ -128,14 +589,15 @@ type Sequence interface {
 
 // User is a Postgres user.
 type User struct {
-	Name     string
-	Password string
+	Name     string `json:"name"`
+	Password string `json:"password,omitempty"`
 }
 
-// SQL returns the command to create this user.
+// SQL returns the command to create this user. Conn methods set Password to a
+// verifier from EncryptPassword so the password itself is never sent.
 func (u *User) SQL() []string {
 	return []string{
-		fmt.Sprintf("CREATE USER %q WITH ENCRYPTED PASSWORD '%v'", u.Name, u.Password),
+		fmt.Sprintf("CREATE USER %v WITH ENCRYPTED PASSWORD %v", QuoteIdentifier(u.Name), QuoteLiteral(u.Password)),
 	}
 }
 
@@ -144,15 +606,21 @@ func (u *User) String() string {
 	return fmt.Sprintf("create user %v", u.Name)
 }
 
+// Revert returns the commands to drop the user, reassigning the objects it
+// owns in the current database to the current user.
+func (u *User) Revert() []string {
+	return dropRole(u, "USER")
+}
+
 // Database is a Postgres database.
 type Database struct {
-	Name string
+	Name string `json:"name"`
 }
 
 // SQL returns the command to create this database.
 func (d *Database) SQL() []string {
 	return []string{
-		fmt.Sprintf("CREATE DATABASE %q", d.Name),
+		fmt.Sprintf("CREATE DATABASE %v", QuoteIdentifier(d.Name)),
 	}
 }
 
@@ -161,99 +629,208 @@ func (d *Database) String() string {
 	return fmt.Sprintf("create database %v", d.Name)
 }
 
-// GrantAccess is a grant of access on a database to a user.
-type GrantAccess struct {
+// Revert returns the commands to terminate the connections to the database
+// and drop it.
+func (d *Database) Revert() []string {
+	return append((&TerminateBackends{d}).SQL(), (&DropDatabase{d}).SQL()...)
+}
+
+// GrantAdmin is a grant of admin on a database and its schemas to a user.
+type GrantAdmin struct {
 	On *Database
 	To *User
+	// Schemas defaults to public
+	Schemas []string
 }
 
 // SQL returns the command to create this grant.
-func (g *GrantAccess) SQL() []string {
+func (g *GrantAdmin) SQL() []string {
+	to := QuoteIdentifier(g.To.Name)
+	ss := []string{
+		fmt.Sprintf("GRANT ALL PRIVILEGES ON DATABASE %v TO %v WITH GRANT OPTION", QuoteIdentifier(g.On.Name), to),
+	}
+	for _, s := range schemaList(g.Schemas) {
+		ss = append(ss,
+			fmt.Sprintf("GRANT ALL PRIVILEGES ON SCHEMA %v TO %v WITH GRANT OPTION", s, to),
+			fmt.Sprintf("GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA %v TO %v WITH GRANT OPTION", s, to))
+	}
+	return ss
+}
+
+// String returns a string suitable for error messages.
+func (g *GrantAdmin) String() string {
+	return fmt.Sprintf("grant admin on %v to %v", g.On.Name, g.To.Name)
+}
+
+// Revert returns the commands to revoke this grant, and the grants made with
+// its grant option.
+func (g *GrantAdmin) Revert() []string {
+	to := QuoteIdentifier(g.To.Name)
+	ss := []string{
+		fmt.Sprintf("REVOKE ALL PRIVILEGES ON DATABASE %v FROM %v CASCADE", QuoteIdentifier(g.On.Name), to),
+	}
+	for _, s := range schemaList(g.Schemas) {
+		ss = append(ss,
+			fmt.Sprintf("REVOKE ALL PRIVILEGES ON SCHEMA %v FROM %v CASCADE", s, to),
+			fmt.Sprintf("REVOKE ALL PRIVILEGES ON ALL TABLES IN SCHEMA %v FROM %v CASCADE", s, to))
+	}
+	return ss
+}
+
+// forRole returns the FOR ROLE clause of ALTER DEFAULT PRIVILEGES for a user,
+// or nothing for the current user.
+func forRole(u *User) string {
+	if u == nil {
+		return ""
+	}
+	return " FOR ROLE " + QuoteIdentifier(u.Name)
+}
+
+// schemaList returns quoted schema names, or PUBLIC when there are none.
+func schemaList(schemas []string) []string {
+	if len(schemas) == 0 {
+		return []string{"PUBLIC"}
+	}
+	quoted := make([]string, len(schemas))
+	for i, s := range schemas {
+		quoted[i] = QuoteIdentifier(s)
+	}
+	return quoted
+}
+
+// RevokeAllPublic is a revocation of all privs of PUBLIC on a database and its
+// schemas.
+type RevokeAllPublic struct {
+	On *Database
+	// Schemas defaults to public
+	Schemas []string
+}
+
+// SQL returns the commands to produce this revocation.
+func (r *RevokeAllPublic) SQL() []string {
+	var ss []string
+	for _, s := range schemaList(r.Schemas) {
+		ss = append(ss, fmt.Sprintf("REVOKE ALL PRIVILEGES ON SCHEMA %v FROM PUBLIC CASCADE", s))
+	}
+	return append(ss, fmt.Sprintf("REVOKE ALL PRIVILEGES ON DATABASE %v FROM PUBLIC CASCADE", QuoteIdentifier(r.On.Name)))
+}
+
+// String returns a string suitable for error messages.
+func (r *RevokeAllPublic) String() string {
+	return fmt.Sprintf("revoke all public on %v", r.On.Name)
+}
+
+// Schema is a schema in the connected database, created by and owned by the
+// Conn user. The public schema always exists and is left alone.
+type Schema struct {
+	Name string
+}
+
+// SQL returns the command to create this schema.
+func (s *Schema) SQL() []string {
+	if s.Name == "public" {
+		return nil
+	}
 	return []string{
-		fmt.Sprintf("GRANT CONNECT ON DATABASE %q TO %q", g.On.Name, g.To.Name),
-		fmt.Sprintf("GRANT USAGE ON SCHEMA PUBLIC TO %q", g.To.Name),
+		fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %v", QuoteIdentifier(s.Name)),
 	}
 }
 
 // String returns a string suitable for error messages.
-func (g *GrantAccess) String() string {
-	return fmt.Sprintf("grant access on %v to %v", g.On.Name, g.To.Name)
+func (s *Schema) String() string {
+	return fmt.Sprintf("create schema %v", s.Name)
 }
 
-// GrantAdmin is a grant of admin on a database to a user.
-type GrantAdmin struct {
+// Revert returns the command to drop the schema, which fails while it holds
+// objects.
+func (s *Schema) Revert() []string {
+	if s.Name == "public" {
+		return nil
+	}
+	return []string{
+		fmt.Sprintf("DROP SCHEMA IF EXISTS %v", QuoteIdentifier(s.Name)),
+	}
+}
+
+// TerminateBackends is a termination of all other connections to a database.
+type TerminateBackends struct {
 	On *Database
-	To *User
 }
 
-// SQL returns the command to create this grant.
-func (g *GrantAdmin) SQL() []string {
+// SQL returns the command to terminate the connections.
+func (t *TerminateBackends) SQL() []string {
 	return []string{
-		fmt.Sprintf("GRANT ALL PRIVILEGES ON DATABASE %q TO %q WITH GRANT OPTION", g.On.Name, g.To.Name),
-		fmt.Sprintf("GRANT ALL PRIVILEGES ON SCHEMA PUBLIC TO %q WITH GRANT OPTION", g.To.Name),
-		fmt.Sprintf("GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA PUBLIC TO %q WITH GRANT OPTION", g.To.Name),
+		fmt.Sprintf("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = %v AND pid <> pg_backend_pid()", QuoteLiteral(t.On.Name)),
 	}
 }
 
 // String returns a string suitable for error messages.
-func (g *GrantAdmin) String() string {
-	return fmt.Sprintf("grant admin on %v to %v", g.On.Name, g.To.Name)
+func (t *TerminateBackends) String() string {
+	return fmt.Sprintf("terminate backends on %v", t.On.Name)
 }
 
-// GrantRead is a grant of read to a user.
-type GrantRead struct {
-	To *User
+// DropDatabase is a removal of a database.
+type DropDatabase struct {
+	Database *Database
 }
 
-// SQL returns the command to create this grant.
-func (g *GrantRead) SQL() []string {
+// SQL returns the command to drop this database.
+func (d *DropDatabase) SQL() []string {
 	return []string{
-		fmt.Sprintf("GRANT SELECT ON ALL TABLES IN SCHEMA PUBLIC TO %q", g.To.Name),
-		fmt.Sprintf("ALTER DEFAULT PRIVILEGES IN SCHEMA PUBLIC GRANT SELECT ON TABLES TO %q", g.To.Name),
+		fmt.Sprintf("DROP DATABASE IF EXISTS %v", QuoteIdentifier(d.Database.Name)),
 	}
 }
 
 // String returns a string suitable for error messages.
-func (g *GrantRead) String() string {
-	return fmt.Sprintf("grant read to %v", g.To.Name)
+func (d *DropDatabase) String() string {
+	return fmt.Sprintf("drop database %v", d.Database.Name)
 }
 
-// GrantWrite is a grant of write on a database to a user.
-type GrantWrite struct {
+// GrantRoles is a grant of membership in the roles of users to a user.
+type GrantRoles struct {
+	Of []*User
 	To *User
 }
 
 // SQL returns the command to create this grant.
-func (g *GrantWrite) SQL() []string {
-	priv := "SELECT,INSERT,UPDATE,DELETE,REFERENCES"
+func (g *GrantRoles) SQL() []string {
 	return []string{
-		fmt.Sprintf("GRANT %v ON ALL TABLES IN SCHEMA PUBLIC TO %q", priv, g.To.Name),
-		fmt.Sprintf("GRANT ALL PRIVILEGES ON ALL FUNCTIONS IN SCHEMA PUBLIC TO %q", g.To.Name),
-		fmt.Sprintf("ALTER DEFAULT PRIVILEGES IN SCHEMA PUBLIC GRANT %v ON TABLES TO %q", priv, g.To.Name),
+		fmt.Sprintf("GRANT %v TO %v", userList(g.Of), QuoteIdentifier(g.To.Name)),
 	}
 }
 
 // String returns a string suitable for error messages.
-func (g *GrantWrite) String() string {
-	return fmt.Sprintf("grant write to %v", g.To.Name)
+func (g *GrantRoles) String() string {
+	return fmt.Sprintf("grant roles %v to %v", userList(g.Of), g.To.Name)
 }
 
-// RevokeAllPublic is a revocation of all privs in the public schema.
-type RevokeAllPublic struct {
-	On *Database
+// Revert returns the command to revoke this grant.
+func (g *GrantRoles) Revert() []string {
+	return []string{
+		fmt.Sprintf("REVOKE %v FROM %v", userList(g.Of), QuoteIdentifier(g.To.Name)),
+	}
 }
 
-// SQL returns the commands to produce this revocation.
-func (r *RevokeAllPublic) SQL() []string {
+// dropRole returns the commands to drop a USER or ROLE. The current user joins
+// the role to take over the objects it owns in the current database, and its
+// privileges there are revoked.
+func dropRole(u *User, kind string) []string {
+	name := QuoteIdentifier(u.Name)
 	return []string{
-		"REVOKE ALL PRIVILEGES ON SCHEMA PUBLIC FROM PUBLIC CASCADE",
-		fmt.Sprintf("REVOKE ALL PRIVILEGES ON DATABASE %q FROM PUBLIC CASCADE", r.On.Name),
+		fmt.Sprintf("GRANT %v TO CURRENT_USER", name),
+		fmt.Sprintf("REASSIGN OWNED BY %v TO CURRENT_USER", name),
+		fmt.Sprintf("DROP OWNED BY %v", name),
+		fmt.Sprintf("DROP %v IF EXISTS %v", kind, name),
 	}
 }
 
-// String returns a string suitable for error messages.
-func (r *RevokeAllPublic) String() string {
-	return fmt.Sprintf("revoke all public on %v", r.On.Name)
+// userList returns the quoted names of users separated by commas.
+func userList(users []*User) string {
+	names := make([]string, len(users))
+	for i, u := range users {
+		names[i] = QuoteIdentifier(u.Name)
+	}
+	return strings.Join(names, ", ")
 }
 
 // truncateBytes truncates string s to length n bytes. The returned string may be
@@ -266,47 +843,11 @@ func truncateBytes(s string, n int) string {
 	return s
 }
 
-// genPassword generates a password of length l
-func genPassword(l int) (p string, err error) {
-	// url non-encode characters: [0-9a-zA-Z$.+!*(),_-]
-	allow := &unicode.RangeTable{
-		R16: []unicode.Range16{
-			{0x0030, 0x0039, 1}, // '0' - '9'
-			{0x0021, 0x0021, 1}, // '!' - '!'
-			{0x0024, 0x0024, 1}, // '$' - '$'
-			{0x0028, 0x002e, 1}, // '(' - '.'
-			{0x0041, 0x005a, 1}, // 'A' - 'Z'
-			{0x005f, 0x005f, 1}, // '_' - '_'
-			{0x0061, 0x007a, 1}, // 'a' - 'z'
-		},
-	}
-
-	strip := func(r rune) rune {
-		if unicode.Is(allow, r) {
-			return r
-		}
-		return -1
-	}
-
-	for len(p) < l {
-		b := make([]byte, l*2)
-		_, err = rand.Read(b)
-		if err != nil {
-			err = fmt.Errorf("generate password: %v", err)
-			return
-		}
-
-		p += strings.Map(strip, string(b))
-	}
-	p = p[:l]
-	return
-}
-
 // genPasswords generates n passwords of length l
 func genPasswords(n, l int) (p []string, err error) {
 	p = make([]string, n)
 	for i := 0; i < len(p); i++ {
-		p[i], err = genPassword(l)
+		p[i], err = password.Postgres.WithLength(l).Generate()
 		if err != nil {
 			return
 		}
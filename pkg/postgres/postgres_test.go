@@ -1,6 +1,10 @@
 package postgres
 
 import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
 	"testing"
 
 	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
@@ -30,22 +34,8 @@ func TestDatabase(t *testing.T) {
 	}
 }
 
-func TestGrantAccess(t *testing.T) {
-	g := &GrantAccess{&Database{"foo"}, &User{"baz", dc}}
-	ss := g.SQL()
-	x := []string{
-		"GRANT CONNECT ON DATABASE \"foo\" TO \"baz\"",
-		"GRANT USAGE ON SCHEMA PUBLIC TO \"baz\"",
-	}
-	for i, s := range ss {
-		if s != x[i] {
-			t.Errorf("Expected %#v got %#v\n", x, s)
-		}
-	}
-}
-
 func TestGrantAdmin(t *testing.T) {
-	g := &GrantAdmin{&Database{"foo"}, &User{"baz", dc}}
+	g := &GrantAdmin{&Database{"foo"}, &User{"baz", dc}, nil}
 	ss := g.SQL()
 	x := []string{
 		"GRANT ALL PRIVILEGES ON DATABASE \"foo\" TO \"baz\" WITH GRANT OPTION",
@@ -59,32 +49,28 @@ func TestGrantAdmin(t *testing.T) {
 	}
 }
 
-func TestGrantRead(t *testing.T) {
-	g := &GrantRead{&User{"foo", dc}}
-	ss := g.SQL()
-	x := []string{
-		"GRANT SELECT ON ALL TABLES IN SCHEMA PUBLIC TO \"foo\"",
-		"ALTER DEFAULT PRIVILEGES IN SCHEMA PUBLIC GRANT SELECT ON TABLES TO \"foo\"",
+func TestSchema(t *testing.T) {
+	if ss := (&Schema{"public"}).SQL(); len(ss) != 0 {
+		t.Errorf("Expected public to be left alone, got %#v", ss)
 	}
-	for i, s := range ss {
-		if s != x[i] {
-			t.Errorf("Expected %#v got %#v\n", x, s)
-		}
+	x := `CREATE SCHEMA IF NOT EXISTS "app"`
+	if ss := (&Schema{"app"}).SQL(); len(ss) != 1 || ss[0] != x {
+		t.Errorf("Expected %v, got %#v", x, ss)
 	}
 }
 
-func TestGrantWrite(t *testing.T) {
-	g := &GrantWrite{&User{"foo", dc}}
-	ss := g.SQL()
-	x := []string{
-		"GRANT SELECT,INSERT,UPDATE,DELETE,REFERENCES ON ALL TABLES IN SCHEMA PUBLIC TO \"foo\"",
-		"GRANT ALL PRIVILEGES ON ALL FUNCTIONS IN SCHEMA PUBLIC TO \"foo\"",
-		"ALTER DEFAULT PRIVILEGES IN SCHEMA PUBLIC GRANT SELECT,INSERT,UPDATE,DELETE,REFERENCES ON TABLES TO \"foo\"",
-	}
-	for i, s := range ss {
-		if s != x[i] {
-			t.Errorf("Expected %#v got %#v\n", x, s)
-		}
+// undoAll reports every sequence as undone with its plan.
+func undoAll(...*User) bool {
+	return true
+}
+
+// defaultProvisions pairs the roles of DefaultTemplate with the users of dd and
+// their groups.
+func defaultProvisions(dd *DatabaseDescriptor) []provision {
+	return []provision{
+		{DefaultTemplate.Roles[0], dd.Admin, &User{Name: "db_admin"}},
+		{DefaultTemplate.Roles[1], dd.Writer, &User{Name: "db_write"}},
+		{DefaultTemplate.Roles[2], dd.Reader, &User{Name: "db_read"}},
 	}
 }
 
@@ -94,33 +80,53 @@ func TestExecCreateDatabase(t *testing.T) {
 		t.Fatalf("Failed to mock: %v\n", err)
 	}
 
-	ex := "^CREATE DATABASE \"db\""
-	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectBegin()
 
-	ex = "REVOKE ALL PRIVILEGES ON SCHEMA PUBLIC FROM PUBLIC CASCADE"
+	ex := "REVOKE ALL PRIVILEGES ON SCHEMA PUBLIC FROM PUBLIC CASCADE"
 	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
 
 	ex = "REVOKE ALL PRIVILEGES ON DATABASE \"db\" FROM PUBLIC CASCADE"
 	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
 
-	ex = "CREATE USER \"db-admin\" WITH ENCRYPTED PASSWORD 'admin'"
+	ex = "CREATE ROLE \"db_admin\" NOLOGIN"
+	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ex = regexp.QuoteMeta("CREATE USER \"db-admin\" WITH ENCRYPTED PASSWORD 'SCRAM-SHA-256$4096:") + ".+'"
+	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ex = "GRANT \"db_admin\" TO \"db-admin\""
+	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ex = "GRANT ALL PRIVILEGES ON DATABASE \"db\" TO \"db_admin\" WITH GRANT OPTION"
+	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ex = "GRANT ALL PRIVILEGES ON SCHEMA PUBLIC TO \"db_admin\" WITH GRANT OPTION"
+	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ex = "GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA PUBLIC TO \"db_admin\" WITH GRANT OPTION"
 	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
 
-	ex = "GRANT ALL PRIVILEGES ON DATABASE \"db\" TO \"db-admin\" WITH GRANT OPTION"
+	ex = "ALTER ROLE \"db-admin\" SET ROLE \"db_admin\""
 	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
 
-	ex = "GRANT ALL PRIVILEGES ON SCHEMA PUBLIC TO \"db-admin\" WITH GRANT OPTION"
+	ex = "CREATE ROLE \"db_write\" NOLOGIN"
 	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
 
-	ex = "GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA PUBLIC TO \"db-admin\" WITH GRANT OPTION"
+	ex = regexp.QuoteMeta("CREATE USER \"db-writer\" WITH ENCRYPTED PASSWORD 'SCRAM-SHA-256$4096:") + ".+'"
 	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
 
-	ex = "CREATE USER \"db-writer\" WITH ENCRYPTED PASSWORD 'writer'"
+	ex = "GRANT \"db_write\" TO \"db-writer\""
 	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
 
-	ex = "CREATE USER \"db-reader\" WITH ENCRYPTED PASSWORD 'reader'"
+	ex = "GRANT \"db_read\" TO \"db-reader\""
 	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
 
+	// the existing reader keeps its password unless rotating, which comes last
+	ex = regexp.QuoteMeta("ALTER USER \"db-reader\" WITH ENCRYPTED PASSWORD 'SCRAM-SHA-256$4096:") + ".+'"
+	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectCommit()
+
 	dd := &DatabaseDescriptor{
 		Host:     "test",
 		Port:     0,
@@ -130,9 +136,17 @@ func TestExecCreateDatabase(t *testing.T) {
 		Reader:   &User{"db-reader", "reader"},
 	}
 
-	c := &Conn{"dummy", 0, &User{dc, dc}, db}
+	c := &Conn{"dummy", 0, &User{dc, dc}, db, Options{}}
 
-	if err := c.execCreateDatabase(dd); err != nil {
+	existing := map[string]bool{"db-reader": true, "db_read": true}
+	if _, passwords, err := createRoleSequences(dd.Database, defaultProvisions(dd), existing, SCRAMSHA256, false, undoAll); err != nil || len(passwords) > 0 {
+		t.Fatalf("Expected existing users to keep their passwords, got %v, %v", passwords, err)
+	}
+	xs, passwords, err := createRoleSequences(dd.Database, defaultProvisions(dd), existing, SCRAMSHA256, true, undoAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ExecTx(append(xs, passwords...)...); err != nil {
 		t.Error(err)
 	}
 
@@ -141,59 +155,559 @@ func TestExecCreateDatabase(t *testing.T) {
 	}
 }
 
+func TestCreateDatabasePlanRerun(t *testing.T) {
+	master := &User{"master", dc}
+	dd := &DatabaseDescriptor{
+		Database: &Database{"db"},
+		Admin:    &User{"db-admin", ""},
+		Writer:   &User{"db-writer", ""},
+		Reader:   &User{"db-reader", ""},
+	}
+	existing := map[string]bool{}
+	for _, name := range []string{"db-admin", "db_admin", "db-writer", "db_write", "db-reader", "db_read"} {
+		existing[name] = true
+	}
+
+	for _, rotate := range []bool{false, true} {
+		s := &databaseState{exists: true, existing: existing, tables: map[string][]string{}, rotate: rotate}
+		p, err := createDatabasePlan("postgres", master, dd.Database, DefaultTemplate.withDefaultSchemas(), defaultProvisions(dd), s, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var passwords []string
+		for _, step := range p.Steps {
+			for _, x := range step.Sequences {
+				if _, ok := x.(*Password); ok {
+					passwords = append(passwords, x.String())
+				}
+			}
+		}
+		if !rotate && len(passwords) > 0 {
+			t.Errorf("Expected existing users to keep their passwords, got %v", passwords)
+		}
+		if rotate {
+			last := p.Steps[len(p.Steps)-1]
+			if len(passwords) != 3 || len(last.Sequences) != 3 || last.NoTx {
+				t.Errorf("Expected the passwords to be set last in a transaction, got %v", passwords)
+			}
+		}
+
+		// the password of the existing owner user is not known
+		for _, i := range []int{1, 3} {
+			if step := p.Steps[i]; step.As != master || step.Role == nil || step.Role.Name != "db_admin" {
+				t.Errorf("Expected step %d on %v to run as master acting as db_admin, got %v", i, step.Database, step.As.Name)
+			}
+		}
+	}
+}
+
 func TestExecCreateDatabaseUserPrivs(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
 		t.Fatalf("Failed to mock: %v\n", err)
 	}
 
+	mock.ExpectBegin()
+
 	ex := "REVOKE ALL PRIVILEGES ON SCHEMA PUBLIC FROM PUBLIC CASCADE"
 	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
 
 	ex = "REVOKE ALL PRIVILEGES ON DATABASE \"db\" FROM PUBLIC CASCADE"
 	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
 
-	ex = "GRANT CONNECT ON DATABASE \"db\" TO \"db-writer\""
-	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
+	for _, ex := range []string{
+		`GRANT CONNECT ON DATABASE "db" TO "db_write"`,
+		`GRANT USAGE ON SCHEMA "public" TO "db_write"`,
+		`GRANT SELECT,INSERT,UPDATE,DELETE,REFERENCES ON ALL TABLES IN SCHEMA "public" TO "db_write"`,
+		`GRANT USAGE,SELECT,UPDATE ON ALL SEQUENCES IN SCHEMA "public" TO "db_write"`,
+		`GRANT ALL PRIVILEGES ON ALL FUNCTIONS IN SCHEMA "public" TO "db_write"`,
+		`ALTER DEFAULT PRIVILEGES FOR ROLE "db_admin" IN SCHEMA "public" GRANT SELECT,INSERT,UPDATE,DELETE,REFERENCES ON TABLES TO "db_write"`,
+		`ALTER DEFAULT PRIVILEGES FOR ROLE "db_admin" IN SCHEMA "public" GRANT USAGE,SELECT,UPDATE ON SEQUENCES TO "db_write"`,
+		`ALTER DEFAULT PRIVILEGES FOR ROLE "db_admin" IN SCHEMA "public" GRANT ALL PRIVILEGES ON FUNCTIONS TO "db_write"`,
+		`ALTER DEFAULT PRIVILEGES FOR ROLE "db_admin" IN SCHEMA "public" GRANT USAGE ON TYPES TO "db_write"`,
+		`GRANT CONNECT ON DATABASE "db" TO "db_read"`,
+		`GRANT USAGE ON SCHEMA "public" TO "db_read"`,
+		`GRANT SELECT ON ALL TABLES IN SCHEMA "public" TO "db_read"`,
+		`GRANT SELECT ON ALL SEQUENCES IN SCHEMA "public" TO "db_read"`,
+		`ALTER DEFAULT PRIVILEGES FOR ROLE "db_admin" IN SCHEMA "public" GRANT SELECT ON TABLES TO "db_read"`,
+		`ALTER DEFAULT PRIVILEGES FOR ROLE "db_admin" IN SCHEMA "public" GRANT SELECT ON SEQUENCES TO "db_read"`,
+		`ALTER DEFAULT PRIVILEGES FOR ROLE "db_admin" IN SCHEMA "public" GRANT USAGE ON TYPES TO "db_read"`,
+	} {
+		mock.ExpectExec(regexp.QuoteMeta(ex)).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
 
-	ex = "GRANT USAGE ON SCHEMA PUBLIC TO \"db-writer\""
-	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
 
-	ex = "GRANT SELECT,INSERT,UPDATE,DELETE,REFERENCES ON ALL TABLES IN SCHEMA PUBLIC TO \"db-writer\""
-	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
+	dd := &DatabaseDescriptor{
+		Host:     "test",
+		Port:     0,
+		Database: &Database{"db"},
+		Admin:    &User{"db-admin", "admin"},
+		Writer:   &User{"db-writer", "writer"},
+		Reader:   &User{"db-reader", "reader"},
+	}
 
-	ex = "GRANT ALL PRIVILEGES ON ALL FUNCTIONS IN SCHEMA PUBLIC TO \"db-writer\""
-	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
+	c := &Conn{"dummy", 0, &User{dc, dc}, db, Options{}}
 
-	ex = "ALTER DEFAULT PRIVILEGES IN SCHEMA PUBLIC GRANT SELECT,INSERT,UPDATE,DELETE,REFERENCES ON TABLES TO \"db-writer\""
-	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
+	if err := c.ExecTx(grantSequences(dd.Database, defaultProvisions(dd), nil, undoAll)...); err != nil {
+		t.Error(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
 
-	ex = "GRANT CONNECT ON DATABASE \"db\" TO \"db-reader\""
+func TestCreateDatabaseRollback(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	ex := regexp.QuoteMeta("SELECT EXISTS (SELECT 1 FROM pg_database WHERE datname = $1)")
+	mock.ExpectQuery(ex).WithArgs("db").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	ex = regexp.QuoteMeta("SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)")
+	for _, name := range []string{"db-admin", "db_admin", "db-writer", "db_write", "db-reader", "db_read"} {
+		mock.ExpectQuery(ex).WithArgs(name).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	}
+
+	mock.ExpectQuery("SHOW password_encryption").WillReturnRows(sqlmock.NewRows([]string{"password_encryption"}).AddRow("scram-sha-256"))
+
+	mock.ExpectExec("^CREATE DATABASE \"db\"").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	mock.ExpectBegin()
+	mock.ExpectExec("REVOKE ALL PRIVILEGES ON SCHEMA PUBLIC FROM PUBLIC CASCADE").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("REVOKE ALL PRIVILEGES ON DATABASE \"db\" FROM PUBLIC CASCADE").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("CREATE ROLE \"db_admin\" NOLOGIN").WillReturnError(fmt.Errorf("permission denied to create role"))
+	mock.ExpectRollback()
+
+	ex = regexp.QuoteMeta("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = 'db' AND pid <> pg_backend_pid()")
 	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DROP DATABASE IF EXISTS \"db\"").WillReturnResult(sqlmock.NewResult(0, 0))
 
-	ex = "GRANT USAGE ON SCHEMA PUBLIC TO \"db-reader\""
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+	dd, err := c.CreateDatabase("db")
+	if err == nil {
+		t.Errorf("Expected an error, got %#v", dd)
+	}
+	if dd != nil {
+		t.Errorf("Expected no descriptor, got %#v", dd)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDropDatabase(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	ex := regexp.QuoteMeta("SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)")
+	mock.ExpectQuery(ex).WithArgs("db-admin").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(ex).WithArgs("db-admin-b").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(ex).WithArgs("db-writer").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(ex).WithArgs("db-writer-b").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(ex).WithArgs("db-reader").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(ex).WithArgs("db-reader-b").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	members := regexp.QuoteMeta("SELECT u.rolname\nFROM pg_auth_members m")
+	mock.ExpectQuery(ex).WithArgs("db_admin").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(members).WithArgs("db_admin").WillReturnRows(sqlmock.NewRows([]string{"rolname"}).AddRow("db-admin").AddRow("master"))
+	mock.ExpectQuery(ex).WithArgs("db_write").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(members).WithArgs("db_write").WillReturnRows(sqlmock.NewRows([]string{"rolname"}).AddRow("db-write-2"))
+	mock.ExpectQuery(ex).WithArgs("db_read").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	ex = regexp.QuoteMeta("SELECT pg_terminate_backend(pid) FROM pg_stat_activity WHERE datname = 'db' AND pid <> pg_backend_pid()")
 	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
 
-	ex = "GRANT SELECT ON ALL TABLES IN SCHEMA PUBLIC TO \"db-reader\""
+	ex = "DROP DATABASE IF EXISTS \"db\""
 	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
 
-	ex = "ALTER DEFAULT PRIVILEGES IN SCHEMA PUBLIC GRANT SELECT ON TABLES TO \"db-reader\""
+	for _, r := range []struct{ name, kind string }{
+		{"db-write-2", "USER"},
+		{"db-reader", "USER"},
+		{"db-admin", "USER"},
+		{"db_write", "ROLE"},
+		{"db_admin", "ROLE"},
+	} {
+		for _, ex := range []string{
+			`GRANT "` + r.name + `" TO CURRENT_USER`,
+			`REASSIGN OWNED BY "` + r.name + `" TO CURRENT_USER`,
+			`DROP OWNED BY "` + r.name + `"`,
+			`DROP ` + r.kind + ` IF EXISTS "` + r.name + `"`,
+		} {
+			mock.ExpectExec(regexp.QuoteMeta(ex)).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+	}
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+	if err := c.DropDatabase("db"); err != nil {
+		t.Error(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRotatePassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	mock.ExpectQuery("SHOW password_encryption").WillReturnRows(sqlmock.NewRows([]string{"password_encryption"}).AddRow("on"))
+
+	ex := "ALTER USER \"db-writer\" WITH ENCRYPTED PASSWORD 'md5[0-9a-f]{32}'"
 	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
 
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+	old := &User{"db-writer", dc}
+	u, err := c.RotatePassword(old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != old.Name || u.Password == old.Password || len(u.Password) != 30 {
+		t.Errorf("Expected a new 30 character password for %v, got %#v", old.Name, u)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRotateDatabaseCredentialsDual(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	ex := regexp.QuoteMeta("SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)")
+
+	mock.ExpectQuery("SHOW password_encryption").WillReturnRows(sqlmock.NewRows([]string{"password_encryption"}).AddRow("scram-sha-256"))
+
+	// admin is primary and has no alternate yet
+	mock.ExpectQuery(ex).WithArgs("db-admin-b").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectBegin()
+	mock.ExpectExec("CREATE USER \"db-admin-b\" WITH ENCRYPTED PASSWORD 'SCRAM-SHA-256.+'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("GRANT \"db_admin\" TO \"db-admin-b\"").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER ROLE \"db-admin-b\" SET ROLE \"db_admin\"").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("COMMENT ON ROLE \"db-admin\" IS 'dfm:active=db-admin-b'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	// writer is primary and has an alternate
+	mock.ExpectQuery(ex).WithArgs("db-writer-b").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectExec("ALTER USER \"db-writer-b\" WITH ENCRYPTED PASSWORD 'SCRAM-SHA-256.+'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("COMMENT ON ROLE \"db-writer\" IS 'dfm:active=db-writer-b'").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	// reader is alternate and switches back
+	mock.ExpectExec("ALTER USER \"db-reader\" WITH ENCRYPTED PASSWORD 'SCRAM-SHA-256.+'").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("COMMENT ON ROLE \"db-reader\" IS 'dfm:active=db-reader'").WillReturnResult(sqlmock.NewResult(0, 0))
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
 	dd := &DatabaseDescriptor{
-		Host:     "test",
-		Port:     0,
 		Database: &Database{"db"},
-		Admin:    &User{"db-admin", "admin"},
-		Writer:   &User{"db-writer", "writer"},
-		Reader:   &User{"db-reader", "reader"},
+		Admin:    &User{Name: "db-admin"},
+		Writer:   &User{Name: "db-writer"},
+		Reader:   &User{Name: "db-reader-b"},
 	}
 
-	c := &Conn{"dummy", 0, &User{dc, dc}, db}
+	next, err := c.RotateDatabaseCredentials(dd, DefaultTemplate, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, x := range []struct{ got, want string }{
+		{next.Admin.Name, "db-admin-b"},
+		{next.Writer.Name, "db-writer-b"},
+		{next.Reader.Name, "db-reader"},
+	} {
+		if x.got != x.want {
+			t.Errorf("Expected %v got %v", x.want, x.got)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRotateDatabaseCredentialsPartial(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	mock.ExpectQuery("SHOW password_encryption").WillReturnRows(sqlmock.NewRows([]string{"password_encryption"}).AddRow("scram-sha-256"))
+	mock.ExpectExec("ALTER USER \"db-admin\" WITH ENCRYPTED PASSWORD").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER USER \"db-writer\" WITH ENCRYPTED PASSWORD").WillReturnError(fmt.Errorf("permission denied"))
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+	dd := &DatabaseDescriptor{
+		Database: &Database{"db"},
+		Admin:    &User{Name: "db-admin"},
+		Writer:   &User{Name: "db-writer"},
+		Reader:   &User{Name: "db-reader"},
+	}
+
+	next, err := c.RotateDatabaseCredentials(dd, DefaultTemplate, false)
+	if err == nil {
+		t.Fatal("Expected the writer to fail to rotate")
+	}
+	if next == nil || next.Admin == nil || next.Admin.Password == "" {
+		t.Fatalf("Expected the rotated admin with its new password, got %#v", next)
+	}
+	if next.Writer != nil || next.Reader != nil {
+		t.Errorf("Expected only the admin to be rotated, got %#v", next)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAddUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	ex := regexp.QuoteMeta("SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)")
+	mock.ExpectQuery(ex).WithArgs("db_admin").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	members := regexp.QuoteMeta("SELECT u.rolname\nFROM pg_auth_members m")
+	mock.ExpectQuery(members).WithArgs("db_admin").WillReturnRows(sqlmock.NewRows([]string{"rolname"}).
+		AddRow("db-admin").AddRow("db-admin-2").AddRow("db-admin-x").AddRow("ops-admin-7"))
+	mock.ExpectQuery(ex).WithArgs("db-admin-3").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	ex = regexp.QuoteMeta("SELECT has_database_privilege($1, $2, 'CREATE WITH GRANT OPTION')")
+	mock.ExpectQuery(ex).WithArgs("db_admin", "db").WillReturnRows(sqlmock.NewRows([]string{"has"}).AddRow(true))
+
+	mock.ExpectQuery("SHOW password_encryption").WillReturnRows(sqlmock.NewRows([]string{"password_encryption"}).AddRow("scram-sha-256"))
+
+	mock.ExpectBegin()
+	ex = regexp.QuoteMeta("CREATE USER \"db-admin-3\" WITH ENCRYPTED PASSWORD 'SCRAM-SHA-256$4096:") + ".+'"
+	mock.ExpectExec(ex).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("GRANT \"db_admin\" TO \"db-admin-3\"").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("ALTER ROLE \"db-admin-3\" SET ROLE \"db_admin\"").WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+	u, err := c.AddUser("db", DefaultTemplate, "admin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "db-admin-3" || len(u.Password) != 30 {
+		t.Errorf("Expected db-admin-3 with a password, got %#v", u)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAddedNumber(t *testing.T) {
+	long := strings.Repeat("d", 60)
+	testCases := []struct {
+		name string
+		want int
+	}{
+		{"db-write-2", 2},
+		{"db-write-12", 12},
+		{"db-write", 0},
+		{"db-write-1", 0},
+		{"db-write-b", 0},
+		{"db-read-2", 0},
+		{"dbx-write-2", 0},
+		{userName(long, "write-123"), 123},
+	}
+	for _, tC := range testCases {
+		database := "db"
+		if strings.HasPrefix(tC.name, "dd") {
+			database = long
+		}
+		if n := addedNumber(database, "write", tC.name); n != tC.want {
+			t.Errorf("Expected %d for %v, got %d", tC.want, tC.name, n)
+		}
+	}
+}
+
+func TestAddUserNoGroup(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	ex := regexp.QuoteMeta("SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)")
+	mock.ExpectQuery(ex).WithArgs("db_write").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+	if u, err := c.AddUser("db", DefaultTemplate, "write"); err == nil {
+		t.Errorf("Expected an error, got %#v", u)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDescribeDatabase(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	ex := regexp.QuoteMeta("SELECT COALESCE(shobj_description(oid, 'pg_authid'), '') FROM pg_roles WHERE rolname = $1")
+	mock.ExpectQuery(ex).WithArgs("db-admin").WillReturnRows(sqlmock.NewRows([]string{"comment"}).AddRow("dfm:active=db-admin-b"))
+	mock.ExpectQuery(ex).WithArgs("db-writer").WillReturnRows(sqlmock.NewRows([]string{"comment"}).AddRow(""))
+	mock.ExpectQuery(ex).WithArgs("db-reader").WillReturnRows(sqlmock.NewRows([]string{"comment"}).AddRow("dfm:active=db-reader"))
 
-	if err := c.execCreateDatabaseUserPrivs(dd); err != nil {
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+	dd, err := c.DescribeDatabase("db", DefaultTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dd.Admin.Name != "db-admin-b" || dd.Writer.Name != "db-writer" || dd.Reader.Name != "db-reader" {
+		t.Errorf("Unexpected active users %v %v %v", dd.Admin.Name, dd.Writer.Name, dd.Reader.Name)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDescribeDatabaseTemplate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	tmpl, err := LoadTemplate(strings.NewReader(analyticsTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ex := regexp.QuoteMeta("SELECT COALESCE(shobj_description(oid, 'pg_authid'), '') FROM pg_roles WHERE rolname = $1")
+	mock.ExpectQuery(ex).WithArgs("db-admin").WillReturnRows(sqlmock.NewRows([]string{"comment"}).AddRow(""))
+	mock.ExpectQuery(ex).WithArgs("db-migrator").WillReturnRows(sqlmock.NewRows([]string{"comment"}).AddRow("dfm:active=db-migrator-b"))
+	mock.ExpectQuery(ex).WithArgs("db-analytics").WillReturnRows(sqlmock.NewRows([]string{"comment"}).AddRow(""))
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+	dd, err := c.DescribeDatabase("db", tmpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dd.Writer != nil || dd.Reader != nil || len(dd.Users) != 2 {
+		t.Fatalf("Expected the admin and the template users, got %#v", dd)
+	}
+	if dd.Admin.Name != "db-admin" || dd.Users[0].Name != "db-migrator-b" || dd.Users[1].Name != "db-analytics" {
+		t.Errorf("Unexpected active users %v %v %v", dd.Admin.Name, dd.Users[0].Name, dd.Users[1].Name)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestListDatabases(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	rows := sqlmock.NewRows([]string{"datname", "owner", "encoding", "size"}).
+		AddRow("db", "db-admin", "UTF8", 7954963).
+		AddRow("rdsadmin", "rdsadmin", "UTF8", nil)
+	mock.ExpectQuery("FROM pg_database d").WillReturnRows(rows)
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+	dbs, err := c.ListDatabases()
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := []*DatabaseInfo{
+		{Name: "db", Owner: "db-admin", Encoding: "UTF8", Size: 7954963},
+		{Name: "rdsadmin", Owner: "rdsadmin", Encoding: "UTF8"},
+	}
+	if !reflect.DeepEqual(dbs, x) {
+		t.Errorf("Expected %#v got %#v\n", x, dbs)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Error(err)
 	}
+}
+
+func TestListRoles(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	rows := sqlmock.NewRows([]string{"rolname", "rolcanlogin", "rolsuper", "rolcreatedb", "rolcreaterole", "rolconnlimit", "member_of"}).
+		AddRow("db-admin", true, false, false, false, -1, "{}").
+		AddRow("db-admin-b", true, false, false, false, -1, "{db-admin}")
+	mock.ExpectQuery("FROM pg_roles r").WillReturnRows(rows)
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+	roles, err := c.ListRoles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := []*Role{
+		{Name: "db-admin", Login: true, ConnLimit: -1, MemberOf: []string{}},
+		{Name: "db-admin-b", Login: true, ConnLimit: -1, MemberOf: []string{"db-admin"}},
+	}
+	if !reflect.DeepEqual(roles, x) {
+		t.Errorf("Expected %#v got %#v\n", x, roles)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestGrants(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	rows := sqlmock.NewRows([]string{"nspname", "rolname", "privilege_type", "is_grantable"}).
+		AddRow("public", "db-admin", "CREATE", true).
+		AddRow("public", "db-reader", "USAGE", false)
+	mock.ExpectQuery("FROM pg_namespace n").WillReturnRows(rows)
+
+	rows = sqlmock.NewRows([]string{"nspname", "relname", "rolname", "privilege_type", "is_grantable"}).
+		AddRow("public", "saiyans", "db-reader", "SELECT", false)
+	mock.ExpectQuery(regexp.QuoteMeta("aclexplode(COALESCE(c.relacl, acldefault('r', c.relowner)))")).WillReturnRows(rows)
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+	grants, err := c.grants()
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := []*Grant{
+		{Schema: "public", Role: "db-admin", Privilege: "CREATE", Grantable: true},
+		{Schema: "public", Role: "db-reader", Privilege: "USAGE"},
+		{Schema: "public", Table: "saiyans", Role: "db-reader", Privilege: "SELECT"},
+	}
+	if !reflect.DeepEqual(grants, x) {
+		t.Errorf("Expected %#v got %#v\n", x, grants)
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Error(err)
@@ -0,0 +1,35 @@
+package postgres
+
+import (
+	"fmt"
+	"strings"
+)
+
+// QuoteIdentifier quotes a name for use as an identifier in SQL. Embedded double
+// quotes are doubled. Postgres cannot store a NUL byte, so one is kept as it is
+// and the statement is rejected when it is run, rather than cutting the name
+// short to another one.
+func QuoteIdentifier(name string) string {
+	return `"` + strings.Replace(name, `"`, `""`, -1) + `"`
+}
+
+// QuoteLiteral quotes a string for use as a literal in SQL. Embedded single
+// quotes are doubled. A string containing backslashes is written as an escape
+// string with doubled backslashes, so it reads the same whatever the server's
+// standard_conforming_strings setting. A NUL byte is kept as in QuoteIdentifier.
+func QuoteLiteral(s string) string {
+	s = strings.Replace(s, `'`, `''`, -1)
+	if strings.Contains(s, `\`) {
+		return `E'` + strings.Replace(s, `\`, `\\`, -1) + `'`
+	}
+	return `'` + s + `'`
+}
+
+// checkNUL returns an error when a command of a sequence contains a NUL byte,
+// which Postgres cannot store in a name or a string.
+func checkNUL(x Sequence, sql string) error {
+	if strings.IndexByte(sql, 0) >= 0 {
+		return fmt.Errorf("%v: contains a NUL byte", x.String())
+	}
+	return nil
+}
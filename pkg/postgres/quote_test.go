@@ -0,0 +1,191 @@
+package postgres
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"testing/quick"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+// unquoteIdentifier reads a quoted identifier the way the Postgres lexer does
+// and fails if anything follows the closing quote.
+func unquoteIdentifier(q string) (string, error) {
+	if len(q) < 2 || q[0] != '"' {
+		return "", errors.New("missing opening quote")
+	}
+	var b bytes.Buffer
+	for i := 1; i < len(q); i++ {
+		if q[i] != '"' {
+			b.WriteByte(q[i])
+			continue
+		}
+		if i+1 < len(q) && q[i+1] == '"' {
+			b.WriteByte('"')
+			i++
+			continue
+		}
+		if i != len(q)-1 {
+			return "", errors.New("identifier ends before the end of the input")
+		}
+		return b.String(), nil
+	}
+	return "", errors.New("missing closing quote")
+}
+
+// unquoteLiteral reads a quoted literal the way the Postgres lexer does, with
+// standard_conforming_strings on, and fails if anything follows the closing quote.
+func unquoteLiteral(q string) (string, error) {
+	escape := strings.HasPrefix(q, "E'")
+	if escape {
+		q = q[1:]
+	}
+	if len(q) < 2 || q[0] != '\'' {
+		return "", errors.New("missing opening quote")
+	}
+	var b bytes.Buffer
+	for i := 1; i < len(q); i++ {
+		switch {
+		case escape && q[i] == '\\':
+			if i+1 == len(q) {
+				return "", errors.New("dangling backslash")
+			}
+			i++
+			b.WriteByte(q[i])
+		case q[i] != '\'':
+			b.WriteByte(q[i])
+		case i+1 < len(q) && q[i+1] == '\'':
+			b.WriteByte('\'')
+			i++
+		case i != len(q)-1:
+			return "", errors.New("literal ends before the end of the input")
+		default:
+			return b.String(), nil
+		}
+	}
+	return "", errors.New("missing closing quote")
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	testCases := []struct {
+		name, quoted string
+	}{
+		{name: "db-admin", quoted: `"db-admin"`},
+		{name: `a"b`, quoted: `"a""b"`},
+		{name: `a\b`, quoted: `"a\b"`},
+		{name: `x"; DROP DATABASE "y`, quoted: `"x""; DROP DATABASE ""y"`},
+		{name: "a\x00b", quoted: "\"a\x00b\""},
+		{name: "", quoted: `""`},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.name, func(t *testing.T) {
+			if q := QuoteIdentifier(tC.name); q != tC.quoted {
+				t.Errorf("Expected %#v got %#v\n", tC.quoted, q)
+			}
+		})
+	}
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	testCases := []struct {
+		s, quoted string
+	}{
+		{s: "baz", quoted: `'baz'`},
+		{s: `it's`, quoted: `'it''s'`},
+		{s: `a\b`, quoted: `E'a\\b'`},
+		{s: `\'; DROP USER x; --`, quoted: `E'\\''; DROP USER x; --'`},
+		{s: "a\x00b", quoted: "'a\x00b'"},
+		{s: "", quoted: `''`},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.s, func(t *testing.T) {
+			if q := QuoteLiteral(tC.s); q != tC.quoted {
+				t.Errorf("Expected %#v got %#v\n", tC.quoted, q)
+			}
+		})
+	}
+}
+
+func TestQuoteIdentifierRoundTrip(t *testing.T) {
+	f := func(name string) bool {
+		s, err := unquoteIdentifier(QuoteIdentifier(name))
+		return err == nil && s == name
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 10000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQuoteLiteralRoundTrip(t *testing.T) {
+	f := func(s string) bool {
+		u, err := unquoteLiteral(QuoteLiteral(s))
+		return err == nil && u == s
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 10000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQuoteRoundTripSQLCharacters(t *testing.T) {
+	// random strings rarely contain quotes, so also build them from SQL syntax
+	parts := []string{`"`, `'`, `\`, `;`, `--`, `/*`, `*/`, `$$`, "\x00", " ", "a", "é"}
+	f := func(picks []uint8) bool {
+		var b bytes.Buffer
+		for _, p := range picks {
+			b.WriteString(parts[int(p)%len(parts)])
+		}
+		s := b.String()
+
+		name, err := unquoteIdentifier(QuoteIdentifier(s))
+		if err != nil || name != s {
+			return false
+		}
+		lit, err := unquoteLiteral(QuoteLiteral(s))
+		return err == nil && lit == s
+	}
+	if err := quick.Check(f, &quick.Config{MaxCount: 10000}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSequencesQuoteUserInput(t *testing.T) {
+	evil := &User{`x" WITH SUPERUSER --`, `p'; DROP DATABASE postgres; --`}
+	ss := evil.SQL()
+	x := `CREATE USER "x"" WITH SUPERUSER --" WITH ENCRYPTED PASSWORD 'p''; DROP DATABASE postgres; --'`
+	if ss[0] != x {
+		t.Errorf("Expected %#v got %#v\n", x, ss[0])
+	}
+
+	p := &Password{evil}
+	ss = p.SQL()
+	x = `ALTER USER "x"" WITH SUPERUSER --" WITH ENCRYPTED PASSWORD 'p''; DROP DATABASE postgres; --'`
+	if ss[0] != x {
+		t.Errorf("Expected %#v got %#v\n", x, ss[0])
+	}
+}
+
+func TestExecRejectsNUL(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+	// cut at the NUL, the name would be that of another database
+	if err := c.Exec(&Database{"prod\x00x"}); err == nil {
+		t.Errorf("Expected a name with a NUL byte to be rejected")
+	}
+	p := &Plan{[]*Step{{"postgres", c.User, nil, true, []Sequence{&Database{"prod\x00x"}}}}}
+	if err := p.Reverse().Write(&bytes.Buffer{}); err == nil {
+		t.Errorf("Expected a plan with a NUL byte to be rejected")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,52 @@
+package postgres
+
+//go:generate go run gen_rdsca.go
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RDSCABundleEnv overrides the path of the RDS CA bundle.
+const RDSCABundleEnv = "DFM_RDS_CA_BUNDLE"
+
+// RDSRootCert returns the path of the RDS CA bundle built into dfm, which is
+// written to ~/.dfm/rds-ca-bundle.pem when that is missing or differs, unless
+// $DFM_RDS_CA_BUNDLE names a file to use instead. The bundle is refreshed by
+// running go generate, which fetches it from AWS into rdsca_bundle.go.
+func RDSRootCert() (string, error) {
+	if path := os.Getenv(RDSCABundleEnv); path != "" {
+		return path, nil
+	}
+	if !strings.Contains(rdsCABundle, "-----BEGIN CERTIFICATE-----") {
+		return "", fmt.Errorf("rds ca bundle is not built in, run go generate ./pkg/postgres or set %v", RDSCABundleEnv)
+	}
+
+	home := os.Getenv("HOME")
+	if home == "" {
+		home = os.Getenv("USERPROFILE")
+	}
+	if home == "" {
+		return "", fmt.Errorf("rds ca bundle: no home directory, set %v", RDSCABundleEnv)
+	}
+	path := filepath.Join(home, ".dfm", "rds-ca-bundle.pem")
+	if b, err := ioutil.ReadFile(path); err == nil && string(b) == rdsCABundle {
+		return path, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("rds ca bundle: %v", err)
+	}
+	// write then rename so a concurrent reader never sees a partial bundle
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, []byte(rdsCABundle), 0644); err != nil {
+		return "", fmt.Errorf("rds ca bundle: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("rds ca bundle: %v", err)
+	}
+	return path, nil
+}
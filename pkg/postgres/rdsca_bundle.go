@@ -0,0 +1,5 @@
+package postgres
+
+// rdsCABundle is the PEM encoded CA bundle for all RDS regions. It is empty
+// until go generate runs gen_rdsca.go, which replaces this file.
+const rdsCABundle = ``
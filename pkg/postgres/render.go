@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Passwords is how a rendered script shows the passwords of the users it
+// creates.
+type Passwords int
+
+const (
+	// RedactPasswords shows passwords as ********, for reviewing a script.
+	RedactPasswords Passwords = iota
+	// PasswordVariables substitutes psql variables for passwords, named after
+	// the users as in foobaz_admin_password, to set with psql -v.
+	PasswordVariables
+)
+
+// NewDatabaseDescriptor returns a descriptor of a database to create from a
+// template, with its user names and placeholder passwords. The name will be
+// truncated as in CreateDatabaseFromTemplate.
+func NewDatabaseDescriptor(name string, t *Template) (*DatabaseDescriptor, error) {
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	dd, _ := provisions(name, t)
+	return dd, nil
+}
+
+// RenderCreateDatabase writes the psql script creating the database of a
+// descriptor from a template without a connection, for review before it runs
+// on a server. It is the plan CreateDatabaseFromTemplate runs on a server
+// without the database or its roles, starting from the postgres database as
+// master. User names are taken from the descriptor, and passwords are never
+// written.
+func RenderCreateDatabase(w io.Writer, dd *DatabaseDescriptor, t *Template, master string, pw Passwords) error {
+	if err := t.Validate(); err != nil {
+		return err
+	}
+	t = t.withDefaultSchemas()
+	_, ps := provisions(dd.Database.Name, t)
+
+	// users of roles other than admin, writer, and reader are in dd.Users in
+	// the order of the template roles
+	n := 0
+	for _, p := range ps {
+		var u *User
+		switch p.role.Suffix {
+		case "admin":
+			u = dd.Admin
+		case "writer":
+			u = dd.Writer
+		case "reader":
+			u = dd.Reader
+		default:
+			if n < len(dd.Users) {
+				u = dd.Users[n]
+			}
+			n++
+		}
+		if u != nil {
+			p.user.Name = u.Name
+		}
+	}
+
+	s := &databaseState{existing: map[string]bool{}, tables: map[string][]string{}}
+	p, err := createDatabasePlan("postgres", &User{Name: master}, &Database{truncateBytes(dd.Database.Name, 63)}, t, ps, s, "")
+	if err != nil {
+		return err
+	}
+	return RenderPlan(w, p, pw)
+}
+
+// RenderPlan writes a plan as a psql script like WriteScript, for plans whose
+// users have placeholder passwords, such as those of PlanAddUser.
+func RenderPlan(w io.Writer, p *Plan, pw Passwords) error {
+	if pw == PasswordVariables {
+		for _, st := range p.Steps {
+			for i, x := range st.Sequences {
+				switch u := x.(type) {
+				case *User:
+					st.Sequences[i] = &passwordVariable{u, u}
+				case *Password:
+					st.Sequences[i] = &passwordVariable{u, u.User}
+				}
+			}
+		}
+	}
+	return p.WriteScript(w)
+}
+
+// PasswordVariable returns the name of the psql variable holding the password
+// of a user in scripts rendered with PasswordVariables.
+func PasswordVariable(user string) string {
+	b := []byte(user + "_password")
+	for i, c := range b {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9') {
+			b[i] = '_'
+		}
+	}
+	return string(b)
+}
+
+// passwordVariable is a sequence setting the password of a user, with the
+// psql variable of PasswordVariable in place of its placeholder password.
+type passwordVariable struct {
+	Sequence
+	user *User
+}
+
+// SQL returns the commands of the sequence with the psql variable.
+func (v *passwordVariable) SQL() []string {
+	var ss []string
+	for _, s := range v.Sequence.SQL() {
+		ss = append(ss, strings.Replace(s, QuoteLiteral(v.user.Password), fmt.Sprintf(":'%v'", PasswordVariable(v.user.Name)), 1))
+	}
+	return ss
+}
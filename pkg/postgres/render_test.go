@@ -0,0 +1,116 @@
+package postgres
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+	"testing"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestRenderCreateDatabase(t *testing.T) {
+	dd, err := NewDatabaseDescriptor("db", DefaultTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	if err := RenderCreateDatabase(&b, dd, DefaultTemplate, "master", PasswordVariables); err != nil {
+		t.Fatal(err)
+	}
+	s := b.String()
+
+	for _, x := range []string{
+		"\\set ON_ERROR_STOP on\n-- on postgres as master\n\\connect \"postgres\" \"master\"\n-- create database db\nCREATE DATABASE \"db\";\n",
+		`CREATE USER "db-admin" WITH ENCRYPTED PASSWORD :'db_admin_password';`,
+		`CREATE USER "db-reader" WITH ENCRYPTED PASSWORD :'db_reader_password';`,
+		"\\connect \"db\" \"db-admin\"\nBEGIN;\n",
+	} {
+		if !strings.Contains(s, x) {
+			t.Errorf("Expected %v in the script", x)
+		}
+	}
+	if strings.Contains(s, "********") {
+		t.Errorf("Expected no placeholder passwords")
+	}
+	if strings.Count(s, "BEGIN;") != strings.Count(s, "COMMIT;") {
+		t.Errorf("Expected each transaction to commit")
+	}
+}
+
+func TestRenderCreateDatabaseRedacted(t *testing.T) {
+	dd, err := NewDatabaseDescriptor("db", DefaultTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dd.Writer.Password = "secret"
+
+	var b bytes.Buffer
+	if err := RenderCreateDatabase(&b, dd, DefaultTemplate, "master", RedactPasswords); err != nil {
+		t.Fatal(err)
+	}
+	if s := b.String(); strings.Contains(s, "secret") || !strings.Contains(s, `CREATE USER "db-writer" WITH ENCRYPTED PASSWORD '********';`) {
+		t.Errorf("Expected redacted passwords, got %v", s)
+	}
+}
+
+func TestRenderPlanAddUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	ex := regexp.QuoteMeta("SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)")
+	mock.ExpectQuery(ex).WithArgs("db_write").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	members := regexp.QuoteMeta("SELECT u.rolname\nFROM pg_auth_members m")
+	mock.ExpectQuery(members).WithArgs("db_write").WillReturnRows(sqlmock.NewRows([]string{"rolname"}).AddRow("db-writer"))
+	mock.ExpectQuery(ex).WithArgs("db-write-2").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	ex = regexp.QuoteMeta("SELECT has_database_privilege($1, $2, 'CREATE WITH GRANT OPTION')")
+	mock.ExpectQuery(ex).WithArgs("db_write", "db").WillReturnRows(sqlmock.NewRows([]string{"has"}).AddRow(false))
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+	limit := 5
+	tmpl := &Template{Roles: []*RoleTemplate{
+		{Suffix: "admin", Owner: true},
+		{Suffix: "writer", Group: "write", Privileges: []string{"SELECT"},
+			ConnectionLimit: &limit, Settings: map[string]string{"statement_timeout": "30s"}},
+	}}
+
+	p, u, err := c.PlanAddUser("db", tmpl, "write")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Name != "db-write-2" {
+		t.Errorf("Expected db-write-2, got %v", u.Name)
+	}
+
+	var b bytes.Buffer
+	if err := RenderPlan(&b, p, PasswordVariables); err != nil {
+		t.Fatal(err)
+	}
+	x := "\\set ON_ERROR_STOP on\n-- on postgres as master, in a transaction\n\\connect \"postgres\" \"master\"\nBEGIN;\n" +
+		"-- create user db-write-2\nCREATE USER \"db-write-2\" WITH ENCRYPTED PASSWORD :'db_write_2_password';\n"
+	if s := b.String(); !strings.HasPrefix(s, x) || !strings.Contains(s, `GRANT "db_write" TO "db-write-2";`) || strings.Contains(s, "SET ROLE") {
+		t.Errorf("Expected the script adding db-write-2, got %v", s)
+	}
+	for _, x := range []string{
+		`ALTER ROLE "db-write-2" CONNECTION LIMIT 5;`,
+		`ALTER ROLE "db-write-2" SET statement_timeout = '30s';`,
+	} {
+		if s := b.String(); !strings.Contains(s, x) {
+			t.Errorf("Expected %v in %v", x, s)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPasswordVariable(t *testing.T) {
+	if v := PasswordVariable("foo-baz.admin"); v != "foo_baz_admin_password" {
+		t.Errorf("Expected foo_baz_admin_password got %v", v)
+	}
+}
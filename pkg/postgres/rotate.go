@@ -0,0 +1,265 @@
+package postgres
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// activePrefix marks the comment recording which of a user and its alternate is in use.
+const activePrefix = "dfm:active="
+
+// userName returns the name of the user generated for a role on a database.
+// The database name is truncated to 56 bytes, 63 - 7 to fit the default user
+// names, or shorter for longer suffixes.
+func userName(database, role string) string {
+	n := 56
+	if l := 62 - len(role); l < n {
+		n = l
+	}
+	return truncateBytes(database, n) + "-" + role
+}
+
+// alternateName returns the name of the alternate user for a role on a database,
+// two bytes shorter than userName to fit the -b.
+func alternateName(database, role string) string {
+	n := 54
+	if l := 60 - len(role); l < n {
+		n = l
+	}
+	return truncateBytes(database, n) + "-" + role + "-b"
+}
+
+// RotatePassword sets a new generated password on a user and returns the user
+// with its new password.
+func (c *Conn) RotatePassword(u *User) (*User, error) {
+	method, err := c.PasswordEncryption()
+	if err != nil {
+		return nil, err
+	}
+	return c.rotatePassword(u, method)
+}
+
+func (c *Conn) rotatePassword(u *User, method string) (*User, error) {
+	pw, err := genPasswords(1, 30)
+	if err != nil {
+		return nil, err
+	}
+
+	next := &User{u.Name, pw[0]}
+	v, err := encrypted(method, next)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Exec(&Password{v}); err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// RotateDatabaseCredentials sets new generated passwords on the users of a
+// database created from a template and returns a descriptor with the new
+// passwords. When a user fails to rotate, the descriptor of the users rotated
+// before it is returned with the error, as their old passwords no longer work.
+//
+// With dual set, each role has a second login user in the same group role. The
+// user not currently in use gets the new password and becomes the active user,
+// so applications keep working with the old password until they switch.
+func (c *Conn) RotateDatabaseCredentials(dd *DatabaseDescriptor, t *Template, dual bool) (*DatabaseDescriptor, error) {
+	next := &DatabaseDescriptor{
+		Host:     dd.Host,
+		Port:     dd.Port,
+		Database: dd.Database,
+	}
+
+	method, err := c.PasswordEncryption()
+	if err != nil {
+		return nil, err
+	}
+
+	_, ps := provisions(dd.Database.Name, t)
+	current := dd.templateUsers(t)
+	for i, p := range ps {
+		if current[i] == nil {
+			return next, fmt.Errorf("database %v has no %v user", dd.Database.Name, p.role.Suffix)
+		}
+		var u *User
+		if dual {
+			u, err = c.rotateAlternate(dd.Database, p, current[i], method)
+		} else {
+			u, err = c.rotatePassword(current[i], method)
+		}
+		if err != nil {
+			return next, err
+		}
+		next.setUser(p.role.Suffix, u)
+	}
+	return next, nil
+}
+
+// rotateAlternate sets a new password on whichever of a role's user and its
+// alternate is not current, creating the alternate when needed, and marks it active.
+func (c *Conn) rotateAlternate(d *Database, p provision, current *User, method string) (*User, error) {
+	primary := &User{Name: p.user.Name}
+	alternate := alternateName(d.Name, p.role.Suffix)
+
+	pw, err := genPasswords(1, 30)
+	if err != nil {
+		return nil, err
+	}
+
+	if current.Name != primary.Name {
+		next := &User{primary.Name, pw[0]}
+		v, err := encrypted(method, next)
+		if err != nil {
+			return nil, err
+		}
+		if err := c.Exec(&Password{v}, &ActiveUser{primary, next}); err != nil {
+			return nil, err
+		}
+		return next, nil
+	}
+
+	next := &User{alternate, pw[0]}
+	v, err := encrypted(method, next)
+	if err != nil {
+		return nil, err
+	}
+	existing, err := c.existingUsers(alternate)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing) == 0 {
+		// the alternate is another member of the group, as AddUser creates
+		xs := []Sequence{v, &GrantRoles{[]*User{p.group}, next}}
+		if p.role.Owner {
+			xs = append(xs, &SetRole{next, p.group})
+		}
+		settings, serr := userSettings(next, p.role)
+		if serr != nil {
+			return nil, serr
+		}
+		xs = append(xs, settings...)
+		err = c.ExecTx(append(xs, &ActiveUser{primary, next})...)
+	} else {
+		err = c.Exec(&Password{v}, &ActiveUser{primary, next})
+	}
+	if err != nil {
+		return nil, err
+	}
+	return next, nil
+}
+
+// DescribeDatabase returns a descriptor of the users in use for a database
+// created from a template, without passwords.
+func (c *Conn) DescribeDatabase(name string, t *Template) (*DatabaseDescriptor, error) {
+	dd, ps := provisions(name, t)
+	dd.Host, dd.Port = c.Host, c.Port
+	dd.Admin, dd.Writer, dd.Reader, dd.Users = nil, nil, nil, nil
+
+	for _, p := range ps {
+		active, err := c.activeUser(p.user.Name)
+		if err != nil {
+			return nil, err
+		}
+		dd.setUser(p.role.Suffix, &User{Name: active})
+	}
+	return dd, nil
+}
+
+// activeUser returns the name of the user in use of a user created by
+// CreateDatabase, the user itself or its alternate after a dual rotation.
+func (c *Conn) activeUser(primary string) (string, error) {
+	var comment string
+	err := c.DB.QueryRow(
+		"SELECT COALESCE(shobj_description(oid, 'pg_authid'), '') FROM pg_roles WHERE rolname = $1",
+		primary).Scan(&comment)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("user %v not found", primary)
+	}
+	if err != nil {
+		return "", fmt.Errorf("describe user %v: %v", primary, err)
+	}
+	if strings.HasPrefix(comment, activePrefix) {
+		return strings.TrimPrefix(comment, activePrefix), nil
+	}
+	return primary, nil
+}
+
+// OpenOwner connects to a database created from a template as its owner user
+// in use, the owner user or its alternate after a dual rotation, with the
+// password of that user, and returns the connection and the user. The
+// database is that of the options, which need no user.
+func OpenOwner(o Options, t *Template, password string) (*Conn, *User, error) {
+	r := t.owner()
+	if r == nil {
+		r = t.Roles[0]
+	}
+	database := truncateBytes(o.Database, 63)
+	primary := userName(database, r.Suffix)
+
+	var first error
+	for _, name := range []string{primary, alternateName(database, r.Suffix)} {
+		o.User, o.Password = name, password
+		c, err := Open(o)
+		if err != nil {
+			return nil, nil, err
+		}
+		active, err := c.activeUser(primary)
+		if err != nil {
+			c.Close()
+			if first == nil {
+				first = err
+			}
+			continue
+		}
+		if active != name {
+			c.Close()
+			return nil, nil, fmt.Errorf("the password is that of %v, the active owner user is %v", name, active)
+		}
+		return c, &User{name, password}, nil
+	}
+	return nil, nil, first
+}
+
+// Password is a change of password for a user.
+type Password struct {
+	User *User
+}
+
+// SQL returns the command to change the password.
+func (p *Password) SQL() []string {
+	return []string{
+		fmt.Sprintf("ALTER USER %v WITH ENCRYPTED PASSWORD %v", QuoteIdentifier(p.User.Name), QuoteLiteral(p.User.Password)),
+	}
+}
+
+// String returns a string suitable for error messages.
+func (p *Password) String() string {
+	return fmt.Sprintf("set password of %v", p.User.Name)
+}
+
+// ActiveUser is a record of which of a user and its alternate is in use.
+type ActiveUser struct {
+	Of     *User
+	Active *User
+}
+
+// SQL returns the command to record the active user.
+func (a *ActiveUser) SQL() []string {
+	return []string{
+		fmt.Sprintf("COMMENT ON ROLE %v IS %v", QuoteIdentifier(a.Of.Name), QuoteLiteral(activePrefix+a.Active.Name)),
+	}
+}
+
+// String returns a string suitable for error messages.
+func (a *ActiveUser) String() string {
+	return fmt.Sprintf("set active user of %v to %v", a.Of.Name, a.Active.Name)
+}
+
+// Revert returns the command to remove the record, making the user active.
+func (a *ActiveUser) Revert() []string {
+	return []string{
+		fmt.Sprintf("COMMENT ON ROLE %v IS NULL", QuoteIdentifier(a.Of.Name)),
+	}
+}
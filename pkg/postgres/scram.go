@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// Password encryption methods, as reported by the password_encryption setting.
+const (
+	SCRAMSHA256 = "scram-sha-256"
+	MD5         = "md5"
+)
+
+const (
+	scramIterations = 4096
+	scramSaltLen    = 16
+)
+
+// PasswordEncryption returns the password encryption method of the server.
+// Servers that predate SCRAM report on or off, which mean MD5.
+func (c *Conn) PasswordEncryption() (string, error) {
+	var method string
+	if err := c.DB.QueryRow("SHOW password_encryption").Scan(&method); err != nil {
+		return "", fmt.Errorf("show password_encryption: %v", err)
+	}
+	if method == SCRAMSHA256 {
+		return SCRAMSHA256, nil
+	}
+	return MD5, nil
+}
+
+// EncryptPassword returns the verifier of a user's password for an encryption
+// method. Postgres stores a verifier given in place of a password as is, so the
+// password itself never reaches the server, its logs, or pg_stat_statements.
+//
+// The password is used as is. Postgres normalises non-ASCII passwords with
+// SASLprep before SCRAM hashing, so those may not match.
+func EncryptPassword(method, user, password string) (string, error) {
+	switch method {
+	case SCRAMSHA256:
+		salt := make([]byte, scramSaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", err
+		}
+		return scramVerifier(password, salt, scramIterations), nil
+	case MD5:
+		return md5Verifier(user, password), nil
+	default:
+		return "", fmt.Errorf("unknown password encryption %v", method)
+	}
+}
+
+// scramVerifier returns the SCRAM-SHA-256 verifier of a password, as described
+// in RFC 5802 and stored by Postgres in pg_authid.
+func scramVerifier(password string, salt []byte, iterations int) string {
+	salted := pbkdf2.Key([]byte(password), salt, iterations, sha256.Size, sha256.New)
+	clientKey := hmacSHA256(salted, "Client Key")
+	storedKey := sha256.Sum256(clientKey)
+	serverKey := hmacSHA256(salted, "Server Key")
+
+	b64 := base64.StdEncoding.EncodeToString
+	return fmt.Sprintf("SCRAM-SHA-256$%d:%s$%s:%s", iterations, b64(salt), b64(storedKey[:]), b64(serverKey))
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+// md5Verifier returns the MD5 verifier of a user's password.
+func md5Verifier(user, password string) string {
+	sum := md5.Sum([]byte(password + user))
+	return "md5" + hex.EncodeToString(sum[:])
+}
+
+// encrypted returns a copy of u with its password replaced by its verifier.
+func encrypted(method string, u *User) (*User, error) {
+	v, err := EncryptPassword(method, u.Name, u.Password)
+	if err != nil {
+		return nil, err
+	}
+	return &User{u.Name, v}, nil
+}
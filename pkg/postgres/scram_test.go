@@ -0,0 +1,76 @@
+package postgres
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestScramVerifier(t *testing.T) {
+	salt := []byte{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+	x := "SCRAM-SHA-256$4096:AAECAwQFBgcICQoLDA0ODw==$zHCdol2044/ZyWzPLi7oxApCkamKw9Z+E4U/QApd/5Y=:dd5peBOitVnLNFu7VmwP+HiDaaw4OUCv396eVCWhYiE="
+	if v := scramVerifier("pencil", salt, 4096); v != x {
+		t.Errorf("Expected %#v got %#v\n", x, v)
+	}
+}
+
+func TestEncryptPassword(t *testing.T) {
+	testCases := []struct {
+		method string
+		match  *regexp.Regexp
+	}{
+		{method: SCRAMSHA256, match: regexp.MustCompile(`^SCRAM-SHA-256\$4096:[A-Za-z0-9+/]{22}==\$[A-Za-z0-9+/]{43}=:[A-Za-z0-9+/]{43}=$`)},
+		{method: MD5, match: regexp.MustCompile(`^md520c46e3762c864548e296b33c3406aa9$`)},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.method, func(t *testing.T) {
+			v, err := EncryptPassword(tC.method, "user", "pencil")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tC.match.MatchString(v) {
+				t.Errorf("Expected %v to match %v", v, tC.match)
+			}
+			if strings.Contains(v, "pencil") {
+				t.Errorf("Expected no plaintext password in %v", v)
+			}
+		})
+	}
+
+	if _, err := EncryptPassword("password", "user", "pencil"); err == nil {
+		t.Errorf("Expected an error for an unknown method")
+	}
+}
+
+func TestPasswordEncryption(t *testing.T) {
+	testCases := []struct {
+		setting, method string
+	}{
+		{setting: "scram-sha-256", method: SCRAMSHA256},
+		{setting: "md5", method: MD5},
+		{setting: "on", method: MD5},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.setting, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("Failed to mock: %v\n", err)
+			}
+			mock.ExpectQuery("SHOW password_encryption").WillReturnRows(sqlmock.NewRows([]string{"password_encryption"}).AddRow(tC.setting))
+
+			c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+			method, err := c.PasswordEncryption()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if method != tC.method {
+				t.Errorf("Expected %v got %v", tC.method, method)
+			}
+		})
+	}
+}
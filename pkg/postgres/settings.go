@@ -0,0 +1,193 @@
+package postgres
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+)
+
+// settingPattern matches configuration parameter names, optionally qualified
+// with an extension prefix, as in auto_explain.log_min_duration.
+var settingPattern = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)?$`)
+
+// SetConnectionLimit sets the limit on the concurrent connections of a user,
+// -1 for unlimited.
+func (c *Conn) SetConnectionLimit(user string, limit int) error {
+	if limit < -1 {
+		return fmt.Errorf("connection limit %d must be -1 or more", limit)
+	}
+	return c.Exec(&ConnectionLimit{&User{Name: user}, limit})
+}
+
+// SetRoleSettings sets configuration parameters of a user, such as
+// statement_timeout or idle_in_transaction_session_timeout, in one
+// transaction. An empty value resets the parameter to the server default. The
+// settings apply to sessions the user opens afterwards.
+func (c *Conn) SetRoleSettings(user string, settings map[string]string) error {
+	xs, err := roleSettings(&User{Name: user}, settings)
+	if err != nil {
+		return err
+	}
+	return c.ExecTx(xs...)
+}
+
+// CheckDatabaseUser returns an error unless user is a member, directly or
+// through its alternate, of a group role of a database created from t.
+func (c *Conn) CheckDatabaseUser(database string, t *Template, user string) error {
+	database = truncateBytes(database, 63)
+	users, err := c.existingUsers(user)
+	if err != nil {
+		return err
+	}
+	if len(users) == 0 {
+		return fmt.Errorf("user %v not found", user)
+	}
+	for _, r := range t.Roles {
+		g := groupName(database, r.group())
+		groups, err := c.existingUsers(g)
+		if err != nil {
+			return err
+		}
+		if len(groups) == 0 {
+			continue
+		}
+		var member bool
+		if err := c.DB.QueryRow("SELECT pg_has_role($1, $2, 'MEMBER')", user, g).Scan(&member); err != nil {
+			return fmt.Errorf("find membership of %v in %v: %v", user, g, err)
+		}
+		if member {
+			return nil
+		}
+	}
+	return fmt.Errorf("user %v is not a user of database %v", user, database)
+}
+
+// SetDatabaseConnectionLimit sets the limit on the concurrent connections to a
+// database, -1 for unlimited.
+func (c *Conn) SetDatabaseConnectionLimit(database string, limit int) error {
+	if limit < -1 {
+		return fmt.Errorf("connection limit %d must be -1 or more", limit)
+	}
+	return c.Exec(&DatabaseConnectionLimit{&Database{truncateBytes(database, 63)}, limit})
+}
+
+// userSettings returns the sequences applying the connection limit and
+// settings of a template role to one of its users.
+func userSettings(u *User, r *RoleTemplate) ([]Sequence, error) {
+	var xs []Sequence
+	if r.ConnectionLimit != nil {
+		xs = append(xs, &ConnectionLimit{u, *r.ConnectionLimit})
+	}
+	settings, err := roleSettings(u, r.Settings)
+	if err != nil {
+		return nil, err
+	}
+	return append(xs, settings...), nil
+}
+
+// roleSettings returns the sequences setting parameters of a user, in name order.
+func roleSettings(u *User, settings map[string]string) ([]Sequence, error) {
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var xs []Sequence
+	for _, name := range names {
+		if err := checkSetting(name); err != nil {
+			return nil, err
+		}
+		xs = append(xs, &RoleSetting{u, name, settings[name]})
+	}
+	return xs, nil
+}
+
+// checkSetting checks that a setting has a valid parameter name. Values are
+// quoted, and checked by the server.
+func checkSetting(name string) error {
+	if !settingPattern.MatchString(name) {
+		return fmt.Errorf("invalid setting name %q", name)
+	}
+	return nil
+}
+
+// ConnectionLimit is a limit on the concurrent connections of a user.
+type ConnectionLimit struct {
+	User  *User
+	Limit int
+}
+
+// SQL returns the command to set the limit.
+func (l *ConnectionLimit) SQL() []string {
+	return []string{
+		fmt.Sprintf("ALTER ROLE %v CONNECTION LIMIT %d", QuoteIdentifier(l.User.Name), l.Limit),
+	}
+}
+
+// String returns a string suitable for error messages.
+func (l *ConnectionLimit) String() string {
+	return fmt.Sprintf("set connection limit of %v to %d", l.User.Name, l.Limit)
+}
+
+// Revert returns the command to remove the limit.
+func (l *ConnectionLimit) Revert() []string {
+	return (&ConnectionLimit{l.User, -1}).SQL()
+}
+
+// DatabaseConnectionLimit is a limit on the concurrent connections to a database.
+type DatabaseConnectionLimit struct {
+	Database *Database
+	Limit    int
+}
+
+// SQL returns the command to set the limit.
+func (l *DatabaseConnectionLimit) SQL() []string {
+	return []string{
+		fmt.Sprintf("ALTER DATABASE %v CONNECTION LIMIT %d", QuoteIdentifier(l.Database.Name), l.Limit),
+	}
+}
+
+// String returns a string suitable for error messages.
+func (l *DatabaseConnectionLimit) String() string {
+	return fmt.Sprintf("set connection limit of %v to %d", l.Database.Name, l.Limit)
+}
+
+// Revert returns the command to remove the limit.
+func (l *DatabaseConnectionLimit) Revert() []string {
+	return (&DatabaseConnectionLimit{l.Database, -1}).SQL()
+}
+
+// RoleSetting is a configuration parameter of a user, set when it connects, or
+// reset to the server default when Value is empty.
+type RoleSetting struct {
+	User  *User
+	Name  string
+	Value string
+}
+
+// SQL returns the command to set the parameter.
+func (r *RoleSetting) SQL() []string {
+	if r.Value == "" {
+		return []string{
+			fmt.Sprintf("ALTER ROLE %v RESET %v", QuoteIdentifier(r.User.Name), r.Name),
+		}
+	}
+	return []string{
+		fmt.Sprintf("ALTER ROLE %v SET %v = %v", QuoteIdentifier(r.User.Name), r.Name, QuoteLiteral(r.Value)),
+	}
+}
+
+// String returns a string suitable for error messages.
+func (r *RoleSetting) String() string {
+	return fmt.Sprintf("set %v of %v", r.Name, r.User.Name)
+}
+
+// Revert returns the command to reset the parameter. A reset cannot be undone,
+// the previous value is unknown.
+func (r *RoleSetting) Revert() []string {
+	if r.Value == "" {
+		return nil
+	}
+	return (&RoleSetting{r.User, r.Name, ""}).SQL()
+}
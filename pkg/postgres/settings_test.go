@@ -0,0 +1,159 @@
+package postgres
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+func TestRoleSetting(t *testing.T) {
+	testCases := []struct {
+		desc    string
+		setting *RoleSetting
+		sql     string
+	}{
+		{
+			desc:    "Set",
+			setting: &RoleSetting{&User{"db-writer", dc}, "statement_timeout", "30s"},
+			sql:     `ALTER ROLE "db-writer" SET statement_timeout = '30s'`,
+		},
+		{
+			desc:    "Quoted Value",
+			setting: &RoleSetting{&User{"db-writer", dc}, "search_path", "app, 'x'"},
+			sql:     `ALTER ROLE "db-writer" SET search_path = 'app, ''x'''`,
+		},
+		{
+			desc:    "Reset",
+			setting: &RoleSetting{&User{"db-writer", dc}, "idle_in_transaction_session_timeout", ""},
+			sql:     `ALTER ROLE "db-writer" RESET idle_in_transaction_session_timeout`,
+		},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if ss := tC.setting.SQL(); len(ss) != 1 || ss[0] != tC.sql {
+				t.Errorf("Expected %v, got %#v", tC.sql, ss)
+			}
+		})
+	}
+}
+
+func TestSetRoleSettings(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	mock.ExpectBegin()
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER ROLE "db-writer" SET idle_in_transaction_session_timeout = '1min'`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER ROLE "db-writer" SET statement_timeout = '30s'`)).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+	err = c.SetRoleSettings("db-writer", map[string]string{
+		"statement_timeout":                   "30s",
+		"idle_in_transaction_session_timeout": "1min",
+	})
+	if err != nil {
+		t.Error(err)
+	}
+
+	if err := c.SetRoleSettings("db-writer", map[string]string{"work_mem = '1GB'; --": "x"}); err == nil {
+		t.Errorf("Expected an invalid setting name to fail")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCheckDatabaseUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	ex := regexp.QuoteMeta("SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)")
+	member := regexp.QuoteMeta("SELECT pg_has_role($1, $2, 'MEMBER')")
+	mock.ExpectQuery(ex).WithArgs("db-writer-b").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(ex).WithArgs("db_admin").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(member).WithArgs("db-writer-b", "db_admin").WillReturnRows(sqlmock.NewRows([]string{"member"}).AddRow(false))
+	mock.ExpectQuery(ex).WithArgs("db_write").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	mock.ExpectQuery(member).WithArgs("db-writer-b", "db_write").WillReturnRows(sqlmock.NewRows([]string{"member"}).AddRow(true))
+
+	mock.ExpectQuery(ex).WithArgs("other-writer").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+	for _, g := range []string{"db_admin", "db_write", "db_read"} {
+		mock.ExpectQuery(ex).WithArgs(g).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery(member).WithArgs("other-writer", g).WillReturnRows(sqlmock.NewRows([]string{"member"}).AddRow(false))
+	}
+
+	mock.ExpectQuery(ex).WithArgs("nobody").WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+	if err := c.CheckDatabaseUser("db", DefaultTemplate, "db-writer-b"); err != nil {
+		t.Error(err)
+	}
+	if err := c.CheckDatabaseUser("db", DefaultTemplate, "other-writer"); err == nil {
+		t.Errorf("Expected a user of another database to fail")
+	}
+	if err := c.CheckDatabaseUser("db", DefaultTemplate, "nobody"); err == nil {
+		t.Errorf("Expected a missing user to fail")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDatabaseConnectionLimit(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	mock.ExpectExec(regexp.QuoteMeta(`ALTER DATABASE "db" CONNECTION LIMIT 50`)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	c := &Conn{"dummy", 0, &User{"master", dc}, db, Options{}}
+
+	if err := c.SetDatabaseConnectionLimit("db", 50); err != nil {
+		t.Error(err)
+	}
+	if err := c.SetDatabaseConnectionLimit("db", -2); err == nil {
+		t.Errorf("Expected a limit below -1 to fail")
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLoadTemplateSettings(t *testing.T) {
+	tmpl, err := LoadTemplate(strings.NewReader(`
+connection_limit: 100
+roles:
+  - suffix: admin
+    owner: true
+  - suffix: api
+    privileges: [SELECT]
+    connection_limit: 20
+    settings:
+      statement_timeout: 30s
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := tmpl.ConnectionLimit; l == nil || *l != 100 {
+		t.Errorf("Expected database connection limit 100, got %v", l)
+	}
+	if v := tmpl.Roles[1].Settings["statement_timeout"]; v != "30s" {
+		t.Errorf("Expected statement_timeout 30s, got %v", v)
+	}
+
+	if tmpl, err := LoadTemplate(strings.NewReader("roles: [{suffix: a, owner: true, settings: {\"bad name\": x}}]")); err == nil {
+		t.Errorf("Expected an error, got %#v", tmpl)
+	}
+}
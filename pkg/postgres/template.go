@@ -0,0 +1,493 @@
+package postgres
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// RoleTemplate describes a group role and a user created with each database,
+// named after the database and Suffix, as in foobaz-writer.
+type RoleTemplate struct {
+	Suffix string `yaml:"suffix"`
+	// Group is the suffix of the NOLOGIN group role holding the privileges,
+	// as in foobaz_write, defaults to Suffix. The user is a member of the
+	// group, and Conn.AddUser adds more members.
+	Group string `yaml:"group,omitempty"`
+	// Owner makes the user the admin of the database, holding all privileges
+	// with grant option. The owner grants the privileges of the other roles.
+	Owner bool `yaml:"owner,omitempty"`
+	// Schemas the privileges apply to, defaults to the template schemas or
+	// public
+	Schemas []string `yaml:"schemas,omitempty"`
+	// Privileges on tables, such as SELECT or INSERT, or ALL
+	Privileges []string `yaml:"privileges,omitempty"`
+	// Tables limits Privileges to the named tables, qualified with a schema or
+	// found in each of Schemas. Tables that do not exist yet are skipped until
+	// the database is created again.
+	Tables []string `yaml:"tables,omitempty"`
+	// SequencePrivileges on sequences, USAGE, SELECT, UPDATE or ALL
+	SequencePrivileges []string `yaml:"sequence_privileges,omitempty"`
+	// FunctionPrivileges on functions, EXECUTE or ALL
+	FunctionPrivileges []string `yaml:"function_privileges,omitempty"`
+	// TypePrivileges on types, USAGE or ALL. Postgres cannot grant on all
+	// existing types, so these apply to types the owner creates later.
+	TypePrivileges []string `yaml:"type_privileges,omitempty"`
+	// DefaultPrivileges on tables the owner creates later. Sequences,
+	// functions and types the owner creates later get the privileges above.
+	DefaultPrivileges []string `yaml:"default_privileges,omitempty"`
+	// ConnectionLimit of the user, unlimited when not set
+	ConnectionLimit *int `yaml:"connection_limit,omitempty"`
+	// Settings of the user, such as statement_timeout, applied when it connects
+	Settings map[string]string `yaml:"settings,omitempty"`
+}
+
+// Template is the set of users created with each database.
+type Template struct {
+	// Schemas created in each database, owned by the owner role. Roles
+	// without schemas of their own get privileges on all of them.
+	Schemas []string `yaml:"schemas,omitempty"`
+	// ConnectionLimit of the database, unlimited when not set
+	ConnectionLimit *int            `yaml:"connection_limit,omitempty"`
+	Roles           []*RoleTemplate `yaml:"roles"`
+}
+
+// DefaultTemplate creates an owner, a writer, and a reader.
+var DefaultTemplate = &Template{
+	Roles: []*RoleTemplate{
+		{
+			Suffix: "admin",
+			Group:  "admin",
+			Owner:  true,
+		},
+		{
+			Suffix:             "writer",
+			Group:              "write",
+			Privileges:         []string{"SELECT", "INSERT", "UPDATE", "DELETE", "REFERENCES"},
+			SequencePrivileges: []string{"USAGE", "SELECT", "UPDATE"},
+			FunctionPrivileges: []string{"ALL"},
+			TypePrivileges:     []string{"USAGE"},
+			DefaultPrivileges:  []string{"SELECT", "INSERT", "UPDATE", "DELETE", "REFERENCES"},
+		},
+		{
+			Suffix:             "reader",
+			Group:              "read",
+			Privileges:         []string{"SELECT"},
+			SequencePrivileges: []string{"SELECT"},
+			TypePrivileges:     []string{"USAGE"},
+			DefaultPrivileges:  []string{"SELECT"},
+		},
+	},
+}
+
+var (
+	suffixPattern       = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,19}$`)
+	tablePrivileges     = []string{"ALL", "SELECT", "INSERT", "UPDATE", "DELETE", "TRUNCATE", "REFERENCES", "TRIGGER"}
+	sequencePrivileges  = []string{"ALL", "USAGE", "SELECT", "UPDATE"}
+	functionPrivileges  = []string{"ALL", "EXECUTE"}
+	typePrivileges      = []string{"ALL", "USAGE"}
+	errTemplateNoOwner  = fmt.Errorf("template needs exactly one owner role")
+	errTemplateNoRoles  = fmt.Errorf("template has no roles")
+	errTemplateTooMany  = fmt.Errorf("template has more than one owner role")
+	errOwnerPrivileges  = fmt.Errorf("owner role holds all privileges, remove its privileges and tables")
+	errTablesPrivileges = fmt.Errorf("tables need privileges")
+)
+
+// LoadTemplate reads a YAML template and validates it.
+func LoadTemplate(r io.Reader) (*Template, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	t := &Template{}
+	if err := yaml.UnmarshalStrict(b, t); err != nil {
+		return nil, fmt.Errorf("template: %v", err)
+	}
+	if err := t.Validate(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// LoadTemplateFile reads a YAML template from a file and validates it.
+func LoadTemplateFile(path string) (*Template, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return LoadTemplate(f)
+}
+
+// Validate checks that a template has exactly one owner, unique suffixes and
+// groups that are valid in role names, and known privileges.
+func (t *Template) Validate() error {
+	if len(t.Roles) == 0 {
+		return errTemplateNoRoles
+	}
+	for _, s := range t.Schemas {
+		if s == "" {
+			return fmt.Errorf("empty schema name")
+		}
+	}
+	if t.ConnectionLimit != nil && *t.ConnectionLimit < -1 {
+		return fmt.Errorf("database connection limit %d must be -1 or more", *t.ConnectionLimit)
+	}
+
+	owners := 0
+	suffixes := map[string]bool{}
+	groups := map[string]bool{}
+	for _, r := range t.Roles {
+		if !suffixPattern.MatchString(r.Suffix) {
+			return fmt.Errorf("role suffix %q must be 1 to 20 lowercase letters, digits, - or _", r.Suffix)
+		}
+		if suffixes[r.Suffix] {
+			return fmt.Errorf("role suffix %q is repeated", r.Suffix)
+		}
+		suffixes[r.Suffix] = true
+		if r.Group != "" && !suffixPattern.MatchString(r.Group) {
+			return fmt.Errorf("role group %q must be 1 to 20 lowercase letters, digits, - or _", r.Group)
+		}
+		if groups[r.group()] {
+			return fmt.Errorf("role group %q is repeated", r.group())
+		}
+		groups[r.group()] = true
+
+		if err := r.validate(); err != nil {
+			return fmt.Errorf("role %v: %v", r.Suffix, err)
+		}
+		if r.Owner {
+			owners++
+		}
+	}
+
+	switch {
+	case owners == 0:
+		return errTemplateNoOwner
+	case owners > 1:
+		return errTemplateTooMany
+	}
+	return nil
+}
+
+func (r *RoleTemplate) validate() error {
+	if r.Owner && (len(r.Privileges) > 0 || len(r.Tables) > 0 || len(r.SequencePrivileges) > 0 ||
+		len(r.FunctionPrivileges) > 0 || len(r.TypePrivileges) > 0 || len(r.DefaultPrivileges) > 0) {
+		return errOwnerPrivileges
+	}
+	if len(r.Tables) > 0 && len(r.Privileges) == 0 {
+		return errTablesPrivileges
+	}
+	if err := checkPrivileges(r.Privileges, tablePrivileges); err != nil {
+		return err
+	}
+	if err := checkPrivileges(r.DefaultPrivileges, tablePrivileges); err != nil {
+		return err
+	}
+	if err := checkPrivileges(r.SequencePrivileges, sequencePrivileges); err != nil {
+		return err
+	}
+	if err := checkPrivileges(r.FunctionPrivileges, functionPrivileges); err != nil {
+		return err
+	}
+	if err := checkPrivileges(r.TypePrivileges, typePrivileges); err != nil {
+		return err
+	}
+	for _, s := range r.Schemas {
+		if s == "" {
+			return fmt.Errorf("empty schema name")
+		}
+	}
+	for _, t := range r.Tables {
+		if t == "" || strings.HasPrefix(t, ".") || strings.HasSuffix(t, ".") {
+			return fmt.Errorf("invalid table name %q", t)
+		}
+	}
+	if r.ConnectionLimit != nil && *r.ConnectionLimit < -1 {
+		return fmt.Errorf("connection limit %d must be -1 or more", *r.ConnectionLimit)
+	}
+	for name := range r.Settings {
+		if err := checkSetting(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// group returns the suffix of the group role of the role.
+func (r *RoleTemplate) group() string {
+	if r.Group == "" {
+		return r.Suffix
+	}
+	return r.Group
+}
+
+// schemas returns the schemas of the role, defaulting to public.
+func (r *RoleTemplate) schemas() []string {
+	if len(r.Schemas) == 0 {
+		return []string{"public"}
+	}
+	return r.Schemas
+}
+
+// tables returns the schema qualified tables of the role.
+func (r *RoleTemplate) tables() []string {
+	var qualified []string
+	for _, t := range r.Tables {
+		if strings.Contains(t, ".") {
+			qualified = append(qualified, t)
+			continue
+		}
+		for _, s := range r.schemas() {
+			qualified = append(qualified, s+"."+t)
+		}
+	}
+	return qualified
+}
+
+// owner returns the owner role of a template.
+func (t *Template) owner() *RoleTemplate {
+	for _, r := range t.Roles {
+		if r.Owner {
+			return r
+		}
+	}
+	return nil
+}
+
+// WithSchemas returns a copy of a template with its schemas replaced, or the
+// template itself when there are none.
+func (t *Template) WithSchemas(schemas ...string) *Template {
+	if len(schemas) == 0 {
+		return t
+	}
+	return &Template{Schemas: schemas, ConnectionLimit: t.ConnectionLimit, Roles: t.Roles}
+}
+
+// withDefaultSchemas returns a copy of a template in which roles without
+// schemas have the template schemas.
+func (t *Template) withDefaultSchemas() *Template {
+	if len(t.Schemas) == 0 {
+		return t
+	}
+	t2 := &Template{Schemas: t.Schemas, ConnectionLimit: t.ConnectionLimit}
+	for _, r := range t.Roles {
+		if len(r.Schemas) == 0 {
+			r2 := *r
+			r2.Schemas = t.Schemas
+			r = &r2
+		}
+		t2.Roles = append(t2.Roles, r)
+	}
+	return t2
+}
+
+// schemas returns the schemas of a template and of all its roles, in order.
+func (t *Template) schemas() []string {
+	var schemas []string
+	seen := map[string]bool{}
+	add := func(ss []string) {
+		for _, s := range ss {
+			if !seen[s] {
+				seen[s] = true
+				schemas = append(schemas, s)
+			}
+		}
+	}
+	add(t.Schemas)
+	for _, r := range t.Roles {
+		add(r.schemas())
+	}
+	return schemas
+}
+
+func checkPrivileges(privs, known []string) error {
+	for _, p := range privs {
+		ok := false
+		for _, k := range known {
+			if strings.ToUpper(p) == k {
+				ok = true
+			}
+		}
+		if !ok {
+			return fmt.Errorf("unknown privilege %v", p)
+		}
+	}
+	return nil
+}
+
+// privilegeList returns privileges in SQL, with ALL as ALL PRIVILEGES.
+func privilegeList(privs []string) string {
+	upper := make([]string, len(privs))
+	for i, p := range privs {
+		upper[i] = strings.ToUpper(p)
+		if upper[i] == "ALL" {
+			return "ALL PRIVILEGES"
+		}
+	}
+	return strings.Join(upper, ",")
+}
+
+// qualifiedName quotes a schema qualified name.
+func qualifiedName(name string) string {
+	i := strings.Index(name, ".")
+	return QuoteIdentifier(name[:i]) + "." + QuoteIdentifier(name[i+1:])
+}
+
+// GrantOwner is a grant of all privileges on the schemas of a template, with
+// grant option, to the owner of a database.
+type GrantOwner struct {
+	Schemas []string
+	To      *User
+}
+
+// SQL returns the commands to create this grant.
+func (g *GrantOwner) SQL() []string {
+	var ss []string
+	for _, s := range g.Schemas {
+		ss = append(ss,
+			fmt.Sprintf("GRANT ALL PRIVILEGES ON SCHEMA %v TO %v WITH GRANT OPTION", QuoteIdentifier(s), QuoteIdentifier(g.To.Name)),
+			fmt.Sprintf("GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA %v TO %v WITH GRANT OPTION", QuoteIdentifier(s), QuoteIdentifier(g.To.Name)))
+	}
+	return ss
+}
+
+// String returns a string suitable for error messages.
+func (g *GrantOwner) String() string {
+	return fmt.Sprintf("grant owner on %v to %v", strings.Join(g.Schemas, ", "), g.To.Name)
+}
+
+// Revert returns the commands to revoke this grant, and the grants made with
+// its grant option.
+func (g *GrantOwner) Revert() []string {
+	var ss []string
+	for _, s := range g.Schemas {
+		ss = append(ss,
+			fmt.Sprintf("REVOKE ALL PRIVILEGES ON SCHEMA %v FROM %v CASCADE", QuoteIdentifier(s), QuoteIdentifier(g.To.Name)),
+			fmt.Sprintf("REVOKE ALL PRIVILEGES ON ALL TABLES IN SCHEMA %v FROM %v CASCADE", QuoteIdentifier(s), QuoteIdentifier(g.To.Name)))
+	}
+	return ss
+}
+
+// GrantRole is a grant of the privileges of a role template to a user, on the
+// existing objects of its schemas and on those the owner creates later.
+type GrantRole struct {
+	On    *Database
+	Role  *RoleTemplate
+	To    *User
+	Owner *User
+	// Tables are the existing tables among the role's tables
+	Tables []string
+}
+
+// SQL returns the commands to create this grant.
+func (g *GrantRole) SQL() []string {
+	r := g.Role
+	to := QuoteIdentifier(g.To.Name)
+	ss := []string{
+		fmt.Sprintf("GRANT CONNECT ON DATABASE %v TO %v", QuoteIdentifier(g.On.Name), to),
+	}
+	for _, s := range r.schemas() {
+		ss = append(ss, fmt.Sprintf("GRANT USAGE ON SCHEMA %v TO %v", QuoteIdentifier(s), to))
+	}
+
+	if len(r.Privileges) > 0 {
+		privs := privilegeList(r.Privileges)
+		if len(r.Tables) == 0 {
+			for _, s := range r.schemas() {
+				ss = append(ss, fmt.Sprintf("GRANT %v ON ALL TABLES IN SCHEMA %v TO %v", privs, QuoteIdentifier(s), to))
+			}
+		} else if len(g.Tables) > 0 {
+			tables := make([]string, len(g.Tables))
+			for i, t := range g.Tables {
+				tables[i] = qualifiedName(t)
+			}
+			ss = append(ss, fmt.Sprintf("GRANT %v ON TABLE %v TO %v", privs, strings.Join(tables, ", "), to))
+		}
+	}
+
+	for _, s := range r.schemas() {
+		schema := QuoteIdentifier(s)
+		if len(r.SequencePrivileges) > 0 {
+			ss = append(ss, fmt.Sprintf("GRANT %v ON ALL SEQUENCES IN SCHEMA %v TO %v", privilegeList(r.SequencePrivileges), schema, to))
+		}
+		if len(r.FunctionPrivileges) > 0 {
+			ss = append(ss, fmt.Sprintf("GRANT %v ON ALL FUNCTIONS IN SCHEMA %v TO %v", privilegeList(r.FunctionPrivileges), schema, to))
+		}
+
+		for _, d := range []struct {
+			objects string
+			privs   []string
+		}{
+			{"TABLES", r.DefaultPrivileges},
+			{"SEQUENCES", r.SequencePrivileges},
+			{"FUNCTIONS", r.FunctionPrivileges},
+			{"TYPES", r.TypePrivileges},
+		} {
+			if len(d.privs) > 0 {
+				ss = append(ss, fmt.Sprintf("ALTER DEFAULT PRIVILEGES%v IN SCHEMA %v GRANT %v ON %v TO %v",
+					forRole(g.Owner), schema, privilegeList(d.privs), d.objects, to))
+			}
+		}
+	}
+	return ss
+}
+
+// String returns a string suitable for error messages.
+func (g *GrantRole) String() string {
+	return fmt.Sprintf("grant %v on %v to %v", g.Role.Suffix, g.On.Name, g.To.Name)
+}
+
+// Revert returns the commands to revoke this grant. All privileges are revoked
+// from the user on the objects the grant covers.
+func (g *GrantRole) Revert() []string {
+	r := g.Role
+	to := QuoteIdentifier(g.To.Name)
+	ss := []string{
+		fmt.Sprintf("REVOKE CONNECT ON DATABASE %v FROM %v", QuoteIdentifier(g.On.Name), to),
+	}
+	if len(r.Privileges) > 0 && len(r.Tables) > 0 && len(g.Tables) > 0 {
+		tables := make([]string, len(g.Tables))
+		for i, t := range g.Tables {
+			tables[i] = qualifiedName(t)
+		}
+		ss = append(ss, fmt.Sprintf("REVOKE ALL PRIVILEGES ON TABLE %v FROM %v", strings.Join(tables, ", "), to))
+	}
+
+	for _, s := range r.schemas() {
+		schema := QuoteIdentifier(s)
+		ss = append(ss, fmt.Sprintf("REVOKE USAGE ON SCHEMA %v FROM %v", schema, to))
+		for _, o := range []struct {
+			objects string
+			privs   []string
+		}{
+			{"TABLES", r.Privileges},
+			{"SEQUENCES", r.SequencePrivileges},
+			{"FUNCTIONS", r.FunctionPrivileges},
+		} {
+			if len(o.privs) > 0 && (o.objects != "TABLES" || len(r.Tables) == 0) {
+				ss = append(ss, fmt.Sprintf("REVOKE ALL PRIVILEGES ON ALL %v IN SCHEMA %v FROM %v", o.objects, schema, to))
+			}
+		}
+		for _, d := range []struct {
+			objects string
+			privs   []string
+		}{
+			{"TABLES", r.DefaultPrivileges},
+			{"SEQUENCES", r.SequencePrivileges},
+			{"FUNCTIONS", r.FunctionPrivileges},
+			{"TYPES", r.TypePrivileges},
+		} {
+			if len(d.privs) > 0 {
+				ss = append(ss, fmt.Sprintf("ALTER DEFAULT PRIVILEGES%v IN SCHEMA %v REVOKE ALL PRIVILEGES ON %v FROM %v",
+					forRole(g.Owner), schema, d.objects, to))
+			}
+		}
+	}
+	return ss
+}
@@ -0,0 +1,206 @@
+package postgres
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	sqlmock "gopkg.in/DATA-DOG/go-sqlmock.v1"
+)
+
+const analyticsTemplate = `
+roles:
+  - suffix: admin
+    owner: true
+    schemas: [public, reporting]
+  - suffix: migrator
+    privileges: [ALL]
+    schemas: [public, reporting]
+    connection_limit: 1
+  - suffix: analytics
+    privileges: [select]
+    tables: [orders, reporting.daily]
+    default_privileges: [SELECT]
+`
+
+func TestLoadTemplate(t *testing.T) {
+	tmpl, err := LoadTemplate(strings.NewReader(analyticsTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tmpl.Roles) != 3 {
+		t.Fatalf("Expected 3 roles, got %d", len(tmpl.Roles))
+	}
+	if tmpl.owner().Suffix != "admin" {
+		t.Errorf("Expected owner admin, got %v", tmpl.owner().Suffix)
+	}
+	if l := tmpl.Roles[1].ConnectionLimit; l == nil || *l != 1 {
+		t.Errorf("Expected connection limit 1, got %v", l)
+	}
+	x := []string{"public.orders", "reporting.daily"}
+	if tables := tmpl.Roles[2].tables(); strings.Join(tables, " ") != strings.Join(x, " ") {
+		t.Errorf("Expected tables %v got %v", x, tables)
+	}
+	if schemas := tmpl.schemas(); strings.Join(schemas, " ") != "public reporting" {
+		t.Errorf("Expected schemas public reporting, got %v", schemas)
+	}
+}
+
+func TestLoadTemplateInvalid(t *testing.T) {
+	testCases := []struct {
+		desc, yaml string
+	}{
+		{desc: "Empty", yaml: "roles: []"},
+		{desc: "No Owner", yaml: "roles: [{suffix: reader, privileges: [SELECT]}]"},
+		{desc: "Two Owners", yaml: "roles: [{suffix: a, owner: true}, {suffix: b, owner: true}]"},
+		{desc: "Repeated Suffix", yaml: "roles: [{suffix: a, owner: true}, {suffix: a}]"},
+		{desc: "Bad Suffix", yaml: "roles: [{suffix: Admin, owner: true}]"},
+		{desc: "Long Suffix", yaml: "roles: [{suffix: " + strings.Repeat("a", 21) + ", owner: true}]"},
+		{desc: "Unknown Privilege", yaml: "roles: [{suffix: a, owner: true}, {suffix: b, privileges: [DROP]}]"},
+		{desc: "Function Privilege", yaml: "roles: [{suffix: a, owner: true}, {suffix: b, function_privileges: [SELECT]}]"},
+		{desc: "Owner Privileges", yaml: "roles: [{suffix: a, owner: true, privileges: [SELECT]}]"},
+		{desc: "Tables Without Privileges", yaml: "roles: [{suffix: a, owner: true}, {suffix: b, tables: [t]}]"},
+		{desc: "Connection Limit", yaml: "roles: [{suffix: a, owner: true, connection_limit: -2}]"},
+		{desc: "Unknown Field", yaml: "roles: [{suffix: a, owner: true, superuser: true}]"},
+	}
+
+	for _, tC := range testCases {
+		t.Run(tC.desc, func(t *testing.T) {
+			if tmpl, err := LoadTemplate(strings.NewReader(tC.yaml)); err == nil {
+				t.Errorf("Expected an error, got %#v", tmpl)
+			}
+		})
+	}
+}
+
+func TestDefaultTemplate(t *testing.T) {
+	if err := DefaultTemplate.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestTemplateWithSchemas(t *testing.T) {
+	tmpl, err := LoadTemplate(strings.NewReader(analyticsTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if DefaultTemplate.WithSchemas() != DefaultTemplate {
+		t.Errorf("Expected no schemas to keep the template")
+	}
+
+	d := tmpl.WithSchemas("app").withDefaultSchemas()
+	if s := d.schemas(); strings.Join(s, ",") != "app,public,reporting" {
+		t.Errorf("Expected app, public, and reporting, got %v", s)
+	}
+	if s := d.Roles[2].schemas(); strings.Join(s, ",") != "app" {
+		t.Errorf("Expected a role without schemas to get the template schemas, got %v", s)
+	}
+	if s := d.Roles[1].schemas(); strings.Join(s, ",") != "public,reporting" {
+		t.Errorf("Expected the role to keep its schemas, got %v", s)
+	}
+	if len(tmpl.Roles[2].Schemas) != 0 {
+		t.Errorf("Expected the template to be unchanged, got %v", tmpl.Roles[2].Schemas)
+	}
+}
+
+func TestUserName(t *testing.T) {
+	long := strings.Repeat("d", 63)
+	for _, suffix := range []string{"admin", "writer", "reader", "analytics", strings.Repeat("s", 20)} {
+		if n := userName(long, suffix); len(n) > 63 || !strings.HasSuffix(n, "-"+suffix) {
+			t.Errorf("Expected a name of at most 63 bytes ending in %v, got %v", suffix, n)
+		}
+		if n := alternateName(long, suffix); len(n) > 63 || !strings.HasSuffix(n, "-"+suffix+"-b") {
+			t.Errorf("Expected an alternate of at most 63 bytes ending in %v-b, got %v", suffix, n)
+		}
+	}
+	if n := userName(long, "admin"); n != long[:56]+"-admin" {
+		t.Errorf("Expected default user names to keep 56 bytes of the database, got %v", n)
+	}
+}
+
+func TestGrantRole(t *testing.T) {
+	tmpl, err := LoadTemplate(strings.NewReader(analyticsTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin := &User{"db-admin", dc}
+	g := &GrantRole{&Database{"db"}, tmpl.Roles[2], &User{"db-analytics", dc}, admin, []string{"reporting.daily"}}
+	x := []string{
+		`GRANT CONNECT ON DATABASE "db" TO "db-analytics"`,
+		`GRANT USAGE ON SCHEMA "public" TO "db-analytics"`,
+		`GRANT SELECT ON TABLE "reporting"."daily" TO "db-analytics"`,
+		`ALTER DEFAULT PRIVILEGES FOR ROLE "db-admin" IN SCHEMA "public" GRANT SELECT ON TABLES TO "db-analytics"`,
+	}
+	ss := g.SQL()
+	if strings.Join(ss, "\n") != strings.Join(x, "\n") {
+		t.Errorf("Expected %#v got %#v\n", x, ss)
+	}
+
+	g = &GrantRole{&Database{"db"}, tmpl.Roles[1], &User{"db-migrator", dc}, admin, nil}
+	x = []string{
+		`GRANT CONNECT ON DATABASE "db" TO "db-migrator"`,
+		`GRANT USAGE ON SCHEMA "public" TO "db-migrator"`,
+		`GRANT USAGE ON SCHEMA "reporting" TO "db-migrator"`,
+		`GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA "public" TO "db-migrator"`,
+		`GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA "reporting" TO "db-migrator"`,
+	}
+	ss = g.SQL()
+	if strings.Join(ss, "\n") != strings.Join(x, "\n") {
+		t.Errorf("Expected %#v got %#v\n", x, ss)
+	}
+}
+
+func TestExecCreateDatabaseUserPrivsTables(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("Failed to mock: %v\n", err)
+	}
+
+	tmpl, err := LoadTemplate(strings.NewReader(analyticsTemplate))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ex := regexp.QuoteMeta("SELECT to_regclass($1) IS NOT NULL")
+	mock.ExpectQuery(ex).WithArgs(`"public"."orders"`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery(ex).WithArgs(`"reporting"."daily"`).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	mock.ExpectBegin()
+	for _, ex := range []string{
+		`REVOKE ALL PRIVILEGES ON SCHEMA PUBLIC FROM PUBLIC CASCADE`,
+		`REVOKE ALL PRIVILEGES ON DATABASE "db" FROM PUBLIC CASCADE`,
+		`GRANT CONNECT ON DATABASE "db" TO "db_migrator"`,
+		`GRANT USAGE ON SCHEMA "public" TO "db_migrator"`,
+		`GRANT USAGE ON SCHEMA "reporting" TO "db_migrator"`,
+		`GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA "public" TO "db_migrator"`,
+		`GRANT ALL PRIVILEGES ON ALL TABLES IN SCHEMA "reporting" TO "db_migrator"`,
+		`GRANT CONNECT ON DATABASE "db" TO "db_analytics"`,
+		`GRANT USAGE ON SCHEMA "public" TO "db_analytics"`,
+		`GRANT SELECT ON TABLE "reporting"."daily" TO "db_analytics"`,
+		`ALTER DEFAULT PRIVILEGES FOR ROLE "db_admin" IN SCHEMA "public" GRANT SELECT ON TABLES TO "db_analytics"`,
+	} {
+		mock.ExpectExec(regexp.QuoteMeta(ex)).WillReturnResult(sqlmock.NewResult(0, 0))
+	}
+	mock.ExpectCommit()
+
+	c := &Conn{"dummy", 0, &User{"db-admin", dc}, db, Options{}}
+
+	ps := []provision{
+		{tmpl.Roles[0], &User{"db-admin", dc}, &User{Name: "db_admin"}},
+		{tmpl.Roles[1], &User{"db-migrator", dc}, &User{Name: "db_migrator"}},
+		{tmpl.Roles[2], &User{"db-analytics", dc}, &User{Name: "db_analytics"}},
+	}
+	tables, err := c.roleTables(ps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.ExecTx(grantSequences(&Database{"db"}, ps, tables, undoAll)...); err != nil {
+		t.Error(err)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,42 @@
+package secrets
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Dotenv writes secrets as dotenv variables, prefixed with the secret Name.
+type Dotenv struct {
+	W io.Writer
+}
+
+// Write writes HOST, PORT, DATABASE, USERNAME and PASSWORD variables for each secret.
+func (d *Dotenv) Write(secrets ...*Secret) error {
+	for _, s := range secrets {
+		prefix := ""
+		if s.Name != "" {
+			prefix = envName(s.Name) + "_"
+		}
+		vars := []struct{ key, value string }{
+			{"HOST", s.Host},
+			{"PORT", fmt.Sprint(s.Port)},
+			{"DATABASE", s.Database},
+			{"USERNAME", s.Username},
+			{"PASSWORD", s.Password},
+		}
+		for _, v := range vars {
+			_, err := fmt.Fprintf(d.W, "%v%v=%v\n", prefix, v.key, dotenvQuote(v.value))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// dotenvQuote double quotes a value, escaping characters dotenv parsers interpret
+func dotenvQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
@@ -0,0 +1,129 @@
+package secrets
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	fileMagic = "DFMSEC01"
+	saltSize  = 32
+	nonceSize = 24
+	keySize   = 32
+)
+
+// EncryptedFile stores secrets in a local file sealed with NaCl secretbox, using
+// a key derived from a passphrase with scrypt. Secrets are keyed by Name and
+// replace earlier secrets of the same Name.
+type EncryptedFile struct {
+	Path       string
+	Passphrase []byte
+}
+
+// Write adds secrets to the file, creating it when it does not exist.
+func (f *EncryptedFile) Write(secrets ...*Secret) error {
+	stored, err := f.Read()
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if stored == nil {
+		stored = map[string]*Secret{}
+	}
+	for _, s := range secrets {
+		stored[s.Name] = s
+	}
+
+	plain, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	sealed, err := seal(plain, f.Passphrase)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(f.Path, sealed, 0600)
+}
+
+// Read returns the secrets in the file keyed by Name.
+func (f *EncryptedFile) Read() (map[string]*Secret, error) {
+	sealed, err := ioutil.ReadFile(f.Path)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := open(sealed, f.Passphrase)
+	if err != nil {
+		return nil, fmt.Errorf("%v: %v", f.Path, err)
+	}
+
+	stored := map[string]*Secret{}
+	if err := json.Unmarshal(plain, &stored); err != nil {
+		return nil, fmt.Errorf("%v: %v", f.Path, err)
+	}
+	return stored, nil
+}
+
+// seal encrypts plain as magic, salt, nonce and secretbox
+func seal(plain, passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return nil, fmt.Errorf("encrypted file needs a passphrase")
+	}
+
+	var salt [saltSize]byte
+	var nonce [nonceSize]byte
+	if _, err := io.ReadFull(rand.Reader, salt[:]); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, err
+	}
+	key, err := deriveKey(passphrase, salt[:])
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(fileMagic)+saltSize+nonceSize+len(plain)+secretbox.Overhead)
+	out = append(out, fileMagic...)
+	out = append(out, salt[:]...)
+	out = append(out, nonce[:]...)
+	return secretbox.Seal(out, plain, &nonce, key), nil
+}
+
+// open reverses seal
+func open(sealed, passphrase []byte) ([]byte, error) {
+	header := len(fileMagic) + saltSize + nonceSize
+	if len(sealed) < header || !bytes.Equal(sealed[:len(fileMagic)], []byte(fileMagic)) {
+		return nil, fmt.Errorf("not a dfm secrets file")
+	}
+	salt := sealed[len(fileMagic) : len(fileMagic)+saltSize]
+	var nonce [nonceSize]byte
+	copy(nonce[:], sealed[len(fileMagic)+saltSize:header])
+
+	key, err := deriveKey(passphrase, salt)
+	if err != nil {
+		return nil, err
+	}
+	plain, ok := secretbox.Open(nil, sealed[header:], &nonce, key)
+	if !ok {
+		return nil, fmt.Errorf("decryption failed, wrong passphrase?")
+	}
+	return plain, nil
+}
+
+// deriveKey derives a secretbox key from a passphrase
+func deriveKey(passphrase, salt []byte) (*[keySize]byte, error) {
+	k, err := scrypt.Key(passphrase, salt, 1<<15, 8, 1, keySize)
+	if err != nil {
+		return nil, err
+	}
+	var key [keySize]byte
+	copy(key[:], k)
+	return &key, nil
+}
@@ -0,0 +1,49 @@
+package secrets
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+)
+
+// Kubernetes writes secrets as Kubernetes Secret manifests, one document per
+// secret named after the secret Name.
+type Kubernetes struct {
+	W         io.Writer
+	Namespace string
+}
+
+// Write writes a manifest for each secret.
+func (k *Kubernetes) Write(secrets ...*Secret) error {
+	for _, s := range secrets {
+		name := dnsName(s.Name)
+		if name == "" {
+			name = dnsName(s.Username)
+		}
+		if name == "" {
+			return fmt.Errorf("kubernetes secret for %v needs a name", s)
+		}
+
+		manifest := "---\napiVersion: v1\nkind: Secret\ntype: Opaque\nmetadata:\n"
+		manifest += fmt.Sprintf("  name: %v\n", name)
+		if k.Namespace != "" {
+			manifest += fmt.Sprintf("  namespace: %v\n", k.Namespace)
+		}
+		manifest += "data:\n"
+		data := []struct{ key, value string }{
+			{"host", s.Host},
+			{"port", fmt.Sprint(s.Port)},
+			{"database", s.Database},
+			{"username", s.Username},
+			{"password", s.Password},
+		}
+		for _, d := range data {
+			manifest += fmt.Sprintf("  %v: %v\n", d.key, base64.StdEncoding.EncodeToString([]byte(d.value)))
+		}
+
+		if _, err := io.WriteString(k.W, manifest); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// PgPass writes secrets to a PostgreSQL password file, replacing existing
+// entries for the same host, port, database and user.
+type PgPass struct {
+	Path string
+}
+
+// Write adds secrets to the password file, creating it when it does not exist.
+func (p *PgPass) Write(secrets ...*Secret) error {
+	existing, err := ioutil.ReadFile(p.Path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	entries := map[string]bool{}
+	lines := make([]string, 0, len(secrets))
+	for _, s := range secrets {
+		if s.Host == "" {
+			return fmt.Errorf("pgpass entry for %v needs a host", s.Username)
+		}
+		key := pgpassKey(s)
+		entries[key] = true
+		lines = append(lines, key+":"+pgpassEscape(s.Password))
+	}
+
+	var out bytes.Buffer
+	scanner := bufio.NewScanner(bytes.NewReader(existing))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if entries[pgpassLineKey(line)] {
+			continue
+		}
+		out.WriteString(line + "\n")
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for _, line := range lines {
+		out.WriteString(line + "\n")
+	}
+
+	// libpq ignores password files readable by group or others, so the file
+	// is replaced by a new one, which TempFile creates with mode 0600
+	f, err := ioutil.TempFile(filepath.Dir(p.Path), ".pgpass")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(out.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), p.Path)
+}
+
+// pgpassKey returns the hostname:port:database:username fields for a secret
+func pgpassKey(s *Secret) string {
+	database := s.Database
+	if database == "" {
+		database = "*"
+	}
+	fields := []string{s.Host, strconv.Itoa(s.Port), database, s.Username}
+	for i := range fields {
+		if fields[i] != "*" {
+			fields[i] = pgpassEscape(fields[i])
+		}
+	}
+	return strings.Join(fields, ":")
+}
+
+// pgpassLineKey returns the hostname:port:database:username fields of a password file line
+func pgpassLineKey(line string) string {
+	fields := 0
+	for i := 0; i < len(line); i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case ':':
+			fields++
+			if fields == 4 {
+				return line[:i]
+			}
+		}
+	}
+	return ""
+}
+
+// pgpassEscape escapes backslashes and colons in a password file field
+func pgpassEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `:`, `\:`).Replace(s)
+}
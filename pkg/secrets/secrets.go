@@ -0,0 +1,64 @@
+// Package secrets stores generated database credentials in places safer than a
+// terminal, such as an encrypted file, .pgpass, dotenv files, Kubernetes Secret
+// manifests or AWS Secrets Manager.
+//
+// Example:
+// sink := &PgPass{Path: "/home/user/.pgpass"}
+// err := sink.Write(&Secret{Host: "host", Port: 5432, Username: "user", Password: "password"})
+package secrets
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Secret is a set of credentials for a database user.
+type Secret struct {
+	Name     string
+	Engine   string
+	Host     string
+	Port     int
+	Database string
+	Username string
+	Password string
+}
+
+// String returns a string suitable for messages, without the password.
+func (s *Secret) String() string {
+	return fmt.Sprintf("%v@%v:%v/%v", s.Username, s.Host, s.Port, s.Database)
+}
+
+// SecretSink stores secrets.
+type SecretSink interface {
+	Write(secrets ...*Secret) error
+}
+
+// envName converts a name to an environment variable style name.
+func envName(name string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		}
+		return '_'
+	}, name)
+}
+
+// dnsName converts a name to a lowercase RFC 1123 name as used by Kubernetes objects.
+func dnsName(name string) string {
+	s := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		}
+		return '-'
+	}, name)
+	if len(s) > 253 {
+		s = s[:253]
+	}
+	return strings.Trim(s, "-.")
+}
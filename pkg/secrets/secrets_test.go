@@ -0,0 +1,207 @@
+package secrets
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+)
+
+var (
+	admin = &Secret{
+		Name:     "db-admin",
+		Engine:   "postgres",
+		Host:     "db.example.com",
+		Port:     5432,
+		Database: "db",
+		Username: "db-admin",
+		Password: `a$b\c:d"e`,
+	}
+	reader = &Secret{
+		Name:     "db-reader",
+		Engine:   "postgres",
+		Host:     "db.example.com",
+		Port:     5432,
+		Database: "db",
+		Username: "db-reader",
+		Password: "reader",
+	}
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "secrets")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v\n", err)
+	}
+	return dir
+}
+
+func TestEncryptedFile(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "secrets")
+	f := &EncryptedFile{Path: path, Passphrase: []byte("kakarot")}
+	if err := f.Write(admin); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Write(reader); err != nil {
+		t.Fatal(err)
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte(reader.Password)) {
+		t.Errorf("Expected file to be encrypted, found password in plaintext")
+	}
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected file mode 0600, got %v", info.Mode().Perm())
+	}
+
+	stored, err := f.Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != 2 {
+		t.Fatalf("Expected 2 secrets, got %d", len(stored))
+	}
+	if *stored[admin.Name] != *admin {
+		t.Errorf("Expected %#v got %#v\n", admin, stored[admin.Name])
+	}
+
+	wrong := &EncryptedFile{Path: path, Passphrase: []byte("vegeta")}
+	if _, err := wrong.Read(); err == nil {
+		t.Errorf("Expected wrong passphrase to fail")
+	}
+}
+
+func TestPgPass(t *testing.T) {
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "pgpass")
+	existing := "other.example.com:5432:*:someone:secret\ndb.example.com:5432:db:db-reader:old\n"
+	if err := ioutil.WriteFile(path, []byte(existing), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := &PgPass{Path: path}
+	if err := p.Write(admin, reader); err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := "other.example.com:5432:*:someone:secret\n" +
+		"db.example.com:5432:db:db-admin:a$b\\\\c\\:d\"e\n" +
+		"db.example.com:5432:db:db-reader:reader\n"
+	if string(b) != x {
+		t.Errorf("Expected %#v got %#v\n", x, string(b))
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m := fi.Mode().Perm(); m != 0600 {
+		t.Errorf("Expected mode 0600 got %o", m)
+	}
+
+	if err := p.Write(&Secret{Username: "nohost"}); err == nil {
+		t.Errorf("Expected an error for a secret without a host")
+	}
+}
+
+func TestDotenv(t *testing.T) {
+	var b bytes.Buffer
+	d := &Dotenv{W: &b}
+	if err := d.Write(admin); err != nil {
+		t.Fatal(err)
+	}
+
+	x := "DB_ADMIN_HOST=\"db.example.com\"\n" +
+		"DB_ADMIN_PORT=\"5432\"\n" +
+		"DB_ADMIN_DATABASE=\"db\"\n" +
+		"DB_ADMIN_USERNAME=\"db-admin\"\n" +
+		"DB_ADMIN_PASSWORD=\"a\\$b\\\\c:d\\\"e\"\n"
+	if b.String() != x {
+		t.Errorf("Expected %#v got %#v\n", x, b.String())
+	}
+}
+
+func TestKubernetes(t *testing.T) {
+	var b bytes.Buffer
+	k := &Kubernetes{W: &b, Namespace: "capsule-corp"}
+	if err := k.Write(admin, reader); err != nil {
+		t.Fatal(err)
+	}
+
+	out := b.String()
+	if n := strings.Count(out, "kind: Secret\n"); n != 2 {
+		t.Errorf("Expected 2 manifests, got %d", n)
+	}
+	for _, x := range []string{
+		"  name: db-admin\n",
+		"  namespace: capsule-corp\n",
+		"  password: " + base64.StdEncoding.EncodeToString([]byte(admin.Password)) + "\n",
+	} {
+		if !strings.Contains(out, x) {
+			t.Errorf("Expected manifest to contain %#v, got %v", x, out)
+		}
+	}
+}
+
+type mockSecretsManager struct {
+	secretsmanageriface.SecretsManagerAPI
+	secrets map[string]string
+	puts    int
+}
+
+func (m *mockSecretsManager) CreateSecret(input *secretsmanager.CreateSecretInput) (*secretsmanager.CreateSecretOutput, error) {
+	if _, ok := m.secrets[*input.Name]; ok {
+		return nil, awserr.New(secretsmanager.ErrCodeResourceExistsException, "exists", nil)
+	}
+	m.secrets[*input.Name] = *input.SecretString
+	return &secretsmanager.CreateSecretOutput{Name: input.Name}, nil
+}
+
+func (m *mockSecretsManager) PutSecretValue(input *secretsmanager.PutSecretValueInput) (*secretsmanager.PutSecretValueOutput, error) {
+	if _, ok := m.secrets[*input.SecretId]; !ok {
+		return nil, fmt.Errorf("secret %v does not exist", *input.SecretId)
+	}
+	m.puts++
+	m.secrets[*input.SecretId] = *input.SecretString
+	return &secretsmanager.PutSecretValueOutput{Name: input.SecretId}, nil
+}
+
+func TestSecretsManager(t *testing.T) {
+	client := &mockSecretsManager{secrets: map[string]string{
+		"dfm/db-reader": "{}",
+	}}
+	m := &SecretsManager{Client: client, Prefix: "dfm/"}
+	if err := m.Write(admin, reader); err != nil {
+		t.Fatal(err)
+	}
+
+	if client.puts != 1 {
+		t.Errorf("Expected existing secret to get a new version, got %d puts", client.puts)
+	}
+	x := `{"engine":"postgres","host":"db.example.com","port":5432,"dbname":"db","username":"db-reader","password":"reader"}`
+	if client.secrets["dfm/db-reader"] != x {
+		t.Errorf("Expected %#v got %#v\n", x, client.secrets["dfm/db-reader"])
+	}
+	if _, ok := client.secrets["dfm/db-admin"]; !ok {
+		t.Errorf("Expected secret dfm/db-admin to be created")
+	}
+}
@@ -0,0 +1,60 @@
+package secrets
+
+import (
+	"encoding/json"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager/secretsmanageriface"
+)
+
+// SecretsManager writes secrets to AWS Secrets Manager as Prefix followed by the
+// secret Name, in the JSON layout used for RDS credentials.
+type SecretsManager struct {
+	Client secretsmanageriface.SecretsManagerAPI
+	Prefix string
+}
+
+// secretString is the RDS credential layout understood by Secrets Manager rotation
+type secretString struct {
+	Engine   string `json:"engine,omitempty"`
+	Host     string `json:"host,omitempty"`
+	Port     int    `json:"port,omitempty"`
+	Database string `json:"dbname,omitempty"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Write creates each secret, or stores a new version when it already exists.
+func (m *SecretsManager) Write(secrets ...*Secret) error {
+	for _, s := range secrets {
+		value, err := json.Marshal(&secretString{
+			Engine:   s.Engine,
+			Host:     s.Host,
+			Port:     s.Port,
+			Database: s.Database,
+			Username: s.Username,
+			Password: s.Password,
+		})
+		if err != nil {
+			return err
+		}
+		name := aws.String(m.Prefix + s.Name)
+
+		_, err = m.Client.CreateSecret(&secretsmanager.CreateSecretInput{
+			Name:         name,
+			SecretString: aws.String(string(value)),
+		})
+		if awsErr, ok := err.(awserr.Error); ok && awsErr.Code() == secretsmanager.ErrCodeResourceExistsException {
+			_, err = m.Client.PutSecretValue(&secretsmanager.PutSecretValueInput{
+				SecretId:     name,
+				SecretString: aws.String(string(value)),
+			})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}